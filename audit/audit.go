@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+)
+
+// Audit actions.
+const (
+	ActionLoginSuccess     = "login.success"
+	ActionLoginFailure     = "login.failure"
+	ActionLoginLockout     = "login.lockout"
+	ActionLoginUnlock      = "login.unlock"
+	ActionLogout           = "logout"
+	ActionPermissionDenied = "permission.denied"
+	ActionUserRoleChange   = "user.role_change"
+	ActionUserDelete       = "user.delete"
+	ActionRoleCreate       = "role.create"
+	ActionRoleUpdate       = "role.update"
+	ActionRoleDelete       = "role.delete"
+	ActionCrawlSubmit      = "crawl.submit"
+	ActionCrawlResume      = "crawl.resume"
+	ActionDataDownload     = "data.download"
+	ActionDataDelete       = "data.delete"
+	ActionDataDeleteAll    = "data.delete_all"
+	ActionTrashRestore     = "trash.restore"
+	ActionOrgDelete        = "org.delete"
+	ActionRetentionPurge   = "retention.purge"
+)
+
+// Outcomes of audited actions.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+type contextKey string
+
+const requestIDContextKey contextKey = "request_id"
+
+// WithRequestID stores the ID of the request in the context, events recorded for the request carry it.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// RequestID returns the request ID stored by WithRequestID, or an empty string.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// Record appends an event to the audit trail. A failure to record is logged but doesn't
+// fail the action that is being audited.
+func Record(event models.AuditEvent) {
+	// cut to the sizes of the columns, the hash has to cover what is stored
+	event.Target = truncate(event.Target, 255)
+	event.Details = truncate(event.Details, 1024)
+	// the database keeps seconds, the hash has to cover what is stored
+	event.CreatedAt = time.Now().Truncate(time.Second)
+	if err := database.AppendAuditEvent(&event, Hash); err != nil {
+		log.Printf("Error recording audit event %s for %s: %v", event.Action, event.Target, err)
+	}
+}
+
+/*
+Hash returns the hex SHA-256 of the event's fields and PrevHash. The fields are encoded as JSON in a
+fixed order and the time as Unix seconds, so the hash doesn't depend on the time zone of the database.
+*/
+func Hash(event *models.AuditEvent) string {
+	encoded, _ := json.Marshal(struct {
+		PrevHash  string `json:"prev_hash"`
+		Action    string `json:"action"`
+		ActorID   int    `json:"actor_id"`
+		IP        string `json:"ip"`
+		RequestID string `json:"request_id"`
+		Target    string `json:"target"`
+		Outcome   string `json:"outcome"`
+		Details   string `json:"details"`
+		CreatedAt int64  `json:"created_at"`
+	}{event.PrevHash, event.Action, event.ActorID, event.IP, event.RequestID, event.Target, event.Outcome, event.Details, event.CreatedAt.Unix()})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verification is the result of Verify. BrokenAt is the ID of the first event that doesn't fit the chain.
+type Verification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int64  `json:"checked"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+/*
+Verify walks the audit trail from the first event and checks that every event links to the hash of
+the event before it and still has the hash it was stored with. The last event has to be the head of
+the chain, otherwise events were cut off at the end. The head is read first and only the events up
+to it are checked, so events appended while Verify runs don't break the chain.
+*/
+func Verify() (Verification, error) {
+	headID, headHash, err := database.GetAuditChainHead()
+	if err != nil {
+		return Verification{}, err
+	}
+	each := func(fn func(models.AuditEvent) error) error {
+		return database.EachAuditEvent(database.AuditFilter{UntilID: headID}, fn)
+	}
+	return verifyChain(each, headID, headHash)
+}
+
+// verifyChain checks the events passed to fn by each, oldest first, against each other and the head of the chain.
+func verifyChain(each func(fn func(models.AuditEvent) error) error, headID int64, headHash string) (Verification, error) {
+	var result Verification
+	var last models.AuditEvent
+	errBroken := errors.New("chain broken")
+
+	err := each(func(event models.AuditEvent) error {
+		switch {
+		case event.ID > headID:
+			return nil // appended after the head was read
+		case last.ID == 0 && event.PrevHash == "" && event.Hash == "":
+			return nil // recorded before the audit trail was chained
+		case event.PrevHash != last.Hash:
+			result.Reason = "previous hash doesn't match, an event before it was removed or changed"
+		case Hash(&event) != event.Hash:
+			result.Reason = "hash doesn't match, the event was changed"
+		default:
+			result.Checked++
+			last = event
+			return nil
+		}
+		result.BrokenAt = event.ID
+		return errBroken
+	})
+	if err == errBroken {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if headID != last.ID || headHash != last.Hash {
+		result.Reason = fmt.Sprintf("the chain ends at event %d, but the last event is %d", headID, last.ID)
+		result.BrokenAt = last.ID
+		return result, nil
+	}
+	result.Valid = true
+	return result, nil
+}
+
+// truncate cuts s to at most max characters, like a VARCHAR(max) column counts them.
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"GoGrab/models"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// chain returns n events linked like AppendAuditEvent links them, with IDs from 1.
+func chain(n int) []models.AuditEvent {
+	events := make([]models.AuditEvent, n)
+	prev := ""
+	for i := range events {
+		events[i] = models.AuditEvent{
+			ID:        int64(i + 1),
+			Action:    ActionLoginSuccess,
+			ActorID:   i + 1,
+			IP:        "192.0.2.1",
+			Target:    "user:alice",
+			Outcome:   OutcomeSuccess,
+			Details:   "via password",
+			PrevHash:  prev,
+			CreatedAt: time.Unix(1700000000+int64(i), 0),
+		}
+		events[i].Hash = Hash(&events[i])
+		prev = events[i].Hash
+	}
+	return events
+}
+
+func eachOf(events []models.AuditEvent) func(func(models.AuditEvent) error) error {
+	return func(fn func(models.AuditEvent) error) error {
+		for _, event := range events {
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func verify(t *testing.T, events []models.AuditEvent, headID int64, headHash string) Verification {
+	t.Helper()
+	result, err := verifyChain(eachOf(events), headID, headHash)
+	if err != nil {
+		t.Fatalf("verifyChain: %v", err)
+	}
+	return result
+}
+
+func TestVerifyChainValid(t *testing.T) {
+	events := chain(5)
+	result := verify(t, events, 5, events[4].Hash)
+	if !result.Valid || result.Checked != 5 {
+		t.Fatalf("got %+v, want a valid chain of 5 events", result)
+	}
+}
+
+func TestVerifyChainEmpty(t *testing.T) {
+	if result := verify(t, nil, 0, ""); !result.Valid {
+		t.Fatalf("got %+v, want an empty chain to be valid", result)
+	}
+}
+
+func TestVerifyChainDetectsChangedEvent(t *testing.T) {
+	events := chain(5)
+	head := events[4].Hash
+	events[2].Details = "via api key"
+
+	result := verify(t, events, 5, head)
+	if result.Valid || result.BrokenAt != 3 || !strings.Contains(result.Reason, "was changed") {
+		t.Fatalf("got %+v, want the chain broken at the changed event 3", result)
+	}
+}
+
+func TestVerifyChainDetectsRehashedEvent(t *testing.T) {
+	events := chain(5)
+	head := events[4].Hash
+	events[2].Outcome = OutcomeFailure
+	events[2].Hash = Hash(&events[2])
+
+	result := verify(t, events, 5, head)
+	if result.Valid || result.BrokenAt != 4 || !strings.Contains(result.Reason, "previous hash") {
+		t.Fatalf("got %+v, want the chain broken at event 4 after the rehashed one", result)
+	}
+}
+
+func TestVerifyChainDetectsRemovedEvent(t *testing.T) {
+	events := chain(5)
+	head := events[4].Hash
+	events = append(events[:1], events[2:]...)
+
+	result := verify(t, events, 5, head)
+	if result.Valid || result.BrokenAt != 3 {
+		t.Fatalf("got %+v, want the chain broken at event 3 after the removed one", result)
+	}
+}
+
+func TestVerifyChainDetectsCutOffEnd(t *testing.T) {
+	events := chain(5)
+	result := verify(t, events[:4], 5, events[4].Hash)
+	if result.Valid || result.BrokenAt != 4 || !strings.Contains(result.Reason, "chain ends at event 5") {
+		t.Fatalf("got %+v, want the missing last event to be reported", result)
+	}
+}
+
+func TestVerifyChainIgnoresEventsAfterHead(t *testing.T) {
+	events := chain(6)
+	result := verify(t, events, 5, events[4].Hash)
+	if !result.Valid || result.Checked != 5 {
+		t.Fatalf("got %+v, want the event appended after the head to be ignored", result)
+	}
+}
+
+func TestVerifyChainSkipsUnchainedEvents(t *testing.T) {
+	events := chain(3)
+	for i := range events {
+		events[i].ID += 2
+	}
+	unchained := []models.AuditEvent{{ID: 1, Action: ActionLogout}, {ID: 2, Action: ActionLogout}}
+	events = append(unchained, events...)
+
+	result := verify(t, events, 5, events[4].Hash)
+	if !result.Valid || result.Checked != 3 {
+		t.Fatalf("got %+v, want the events before the chain to be skipped", result)
+	}
+}
+
+func TestVerifyChainDetectsUnchainedEventInside(t *testing.T) {
+	events := chain(3)
+	head := events[2].Hash
+	events[1].PrevHash, events[1].Hash = "", ""
+
+	result := verify(t, events, 3, head)
+	if result.Valid || result.BrokenAt != 2 {
+		t.Fatalf("got %+v, want an event without hash inside the chain to break it", result)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"too long", 3, "too"},
+		{"ääää", 2, "ää"},
+		{"日本語のテキスト", 3, "日本語"},
+	}
+	for _, test := range tests {
+		got := truncate(test.in, test.max)
+		if got != test.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.in, test.max, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"GoGrab/models"
+	"errors"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrInvalidAccessToken is returned for access tokens that are malformed, expired, badly signed or meant for someone else.
+var ErrInvalidAccessToken = errors.New("invalid access token")
+
+// AccessTokenIssuer returns the iss claim of access tokens, auth.issuer ("gograb" by default).
+func AccessTokenIssuer() string {
+	return settings.Issuer
+}
+
+// AccessTokenAudience returns the aud claim of access tokens, auth.audience ("gograb-api" by default).
+func AccessTokenAudience() string {
+	return settings.Audience
+}
+
+/*
+ParseAccessToken verifies the signature and expiry of an access token and that it was issued by
+this GoGrab for its API, so a token signed with a shared key for another service isn't accepted.
+Whether its session is still active is up to the caller.
+*/
+func ParseAccessToken(tokenString string) (*models.Claims, error) {
+	claims := &models.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, AccessTokenKeyFunc)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidAccessToken
+	}
+	if !claims.VerifyIssuer(AccessTokenIssuer(), true) || !claims.VerifyAudience(AccessTokenAudience(), true) {
+		return nil, ErrInvalidAccessToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"GoGrab/config"
+	"GoGrab/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// useSettings changes the authentication settings for the test.
+func useSettings(t *testing.T, change func(cfg *config.AuthConfig)) {
+	t.Helper()
+	previous := settings
+	cfg := config.Default().Auth
+	change(&cfg)
+	Configure(cfg)
+	t.Cleanup(func() { Configure(previous) })
+}
+
+// signTestToken signs claims for user 1 with HS256, which needs no keys in the database.
+func signTestToken(t *testing.T, issuer string, audience jwt.ClaimStrings, expiresIn time.Duration) string {
+	t.Helper()
+	claims := &models.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   "1",
+			ID:        "session",
+			Issuer:    issuer,
+			Audience:  audience,
+		},
+		Role: "user",
+	}
+	token, err := SignAccessToken(claims)
+	if err != nil {
+		t.Fatalf("SignAccessToken: %v", err)
+	}
+	return token
+}
+
+func TestParseAccessToken(t *testing.T) {
+	useSettings(t, func(cfg *config.AuthConfig) {
+		cfg.SigningAlgorithm, cfg.SecretKey = "HS256", "test-secret"
+	})
+
+	claims, err := ParseAccessToken(signTestToken(t, "gograb", jwt.ClaimStrings{"gograb-api"}, time.Minute))
+	if err != nil || claims.Subject != "1" || claims.Role != "user" {
+		t.Fatalf("got %+v, %v, want the claims of a valid token", claims, err)
+	}
+
+	tests := []struct {
+		name      string
+		issuer    string
+		audience  jwt.ClaimStrings
+		expiresIn time.Duration
+	}{
+		{"no issuer", "", jwt.ClaimStrings{"gograb-api"}, time.Minute},
+		{"other issuer", "other-service", jwt.ClaimStrings{"gograb-api"}, time.Minute},
+		{"no audience", "gograb", nil, time.Minute},
+		{"other audience", "gograb", jwt.ClaimStrings{"other-api"}, time.Minute},
+		{"expired", "gograb", jwt.ClaimStrings{"gograb-api"}, -time.Minute},
+	}
+	for _, test := range tests {
+		token := signTestToken(t, test.issuer, test.audience, test.expiresIn)
+		if _, err := ParseAccessToken(token); !errors.Is(err, ErrInvalidAccessToken) {
+			t.Errorf("%s: got %v, want ErrInvalidAccessToken", test.name, err)
+		}
+	}
+
+	token := signTestToken(t, "gograb", jwt.ClaimStrings{"gograb-api"}, time.Minute)
+	settings.SecretKey = "another-secret"
+	if _, err := ParseAccessToken(token); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("got %v for a token signed with another key, want ErrInvalidAccessToken", err)
+	}
+}
+
+func TestParseAccessTokenConfiguredIssuer(t *testing.T) {
+	useSettings(t, func(cfg *config.AuthConfig) {
+		cfg.SigningAlgorithm, cfg.SecretKey = "HS256", "test-secret"
+		cfg.Issuer, cfg.Audience = "https://gograb.example.com", "scraper"
+	})
+
+	if _, err := ParseAccessToken(signTestToken(t, "https://gograb.example.com", jwt.ClaimStrings{"scraper", "other"}, time.Minute)); err != nil {
+		t.Errorf("got %v, want a token of the configured issuer and audience accepted", err)
+	}
+	if _, err := ParseAccessToken(signTestToken(t, "gograb", jwt.ClaimStrings{"gograb-api"}, time.Minute)); err == nil {
+		t.Error("a token with the default issuer and audience was accepted")
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so keys are easy to recognize, e.g. by secret scanners.
+const APIKeyPrefix = "gg_"
+
+// ErrInvalidAPIKey is returned for malformed, unknown, expired or revoked API keys.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// validScopes lists the scopes an API key can be granted.
+var validScopes = []string{models.ScopeCrawl, models.ScopeReadData, models.ScopeDeleteData}
+
+// IsAPIKey reports whether a bearer token looks like an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidScope reports whether scope is one of the known API key scopes.
+func ValidScope(scope string) bool {
+	for _, valid := range validScopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+CreateAPIKey generates a new API key for the user and stores its hash.
+The key has the form gg_<prefix>_<secret>; the prefix identifies the key and is stored in clear,
+the full key is returned only here and can't be recovered later. A nil expiresAt never expires.
+*/
+func CreateAPIKey(userID int, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	prefixBytes := make([]byte, 4)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", nil, err
+	}
+
+	prefix := hex.EncodeToString(prefixBytes)
+	rawKey := APIKeyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   HashToken(rawKey),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := database.CreateAPIKey(key); err != nil {
+		return "", nil, err
+	}
+	return rawKey, key, nil
+}
+
+// AuthenticateAPIKey looks up an API key and checks that it is valid, then records its use.
+func AuthenticateAPIKey(rawKey string) (*models.APIKey, error) {
+	// split gg_<prefix>_<secret> to find the key by its prefix
+	parts := strings.SplitN(strings.TrimPrefix(rawKey, APIKeyPrefix), "_", 2)
+	if !IsAPIKey(rawKey) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := database.GetAPIKeyByPrefix(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(HashToken(rawKey))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := database.TouchAPIKey(key.ID); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
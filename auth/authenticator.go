@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidCredentials is returned when a backend knows the user but the password is wrong,
+	// or no backend knows the user.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUserNotFound is returned by a backend that doesn't know the user, the next backend is asked then.
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// Authenticator checks a username and password against one user store.
+type Authenticator interface {
+	// Name identifies the backend in auth.backends and the logs.
+	Name() string
+	// Authenticate returns the GoGrab user for the credentials, provisioning it if the backend does that.
+	// It returns ErrUserNotFound if the backend doesn't know the user and ErrInvalidCredentials for a wrong password.
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// LocalAuthenticator checks passwords against the bcrypt hashes in the Users table.
+type LocalAuthenticator struct{}
+
+func (LocalAuthenticator) Name() string { return models.AuthSourceLocal }
+
+func (LocalAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	user, err := database.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	// users of other sources are left to their backend
+	if user.ID == 0 || user.Password == "" || (user.AuthSource != "" && user.AuthSource != models.AuthSourceLocal) {
+		return nil, ErrUserNotFound
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+var (
+	authenticatorsOnce sync.Once
+	authenticators     []Authenticator
+	authenticatorsErr  error
+)
+
+/*
+Authenticators returns the backends of auth.backends in the order they are asked, "local" by default.
+With "ldap,local" directory users log in with their directory password and local users, like a
+break-glass admin, still work; "ldap" alone turns local passwords off.
+*/
+func Authenticators() ([]Authenticator, error) {
+	authenticatorsOnce.Do(func() {
+		for _, name := range settings.Backends {
+			switch name {
+			case models.AuthSourceLocal:
+				authenticators = append(authenticators, LocalAuthenticator{})
+			case models.AuthSourceLDAP:
+				backend, err := NewLDAPAuthenticator(NewLDAPConfig(settings.LDAP), nil)
+				if err != nil {
+					authenticatorsErr = err
+					return
+				}
+				authenticators = append(authenticators, backend)
+			default:
+				authenticatorsErr = fmt.Errorf("unknown authentication backend %q in auth.backends", name)
+				return
+			}
+		}
+	})
+	return authenticators, authenticatorsErr
+}
+
+/*
+Authenticate asks the configured backends in order until one knows the user. A wrong password ends
+the search, so a local account can't be used to get around the directory. A backend that fails,
+e.g. an unreachable directory, is skipped so the next one can serve as fallback; if no backend
+answered, its error is returned.
+*/
+func Authenticate(username, password string) (*models.User, error) {
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	backends, err := Authenticators()
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, backend := range backends {
+		user, err := backend.Authenticate(username, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrInvalidCredentials):
+			return nil, err
+		case errors.Is(err, ErrUserNotFound):
+			continue
+		default:
+			log.Printf("Authentication backend %s failed: %v", backend.Name(), err)
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrInvalidCredentials
+}
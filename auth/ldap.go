@@ -0,0 +1,401 @@
+package auth
+
+import (
+	"GoGrab/config"
+	"GoGrab/database"
+	"GoGrab/models"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	defaultLDAPPoolSize = 5
+	defaultLDAPTimeout  = 5 * time.Second
+)
+
+// ldapRoleMapping maps a directory group, by DN or by its CN, to a GoGrab role.
+type ldapRoleMapping struct {
+	Group string
+	Role  string
+}
+
+// LDAPConfig holds the LDAP settings as used by the backend, see NewLDAPConfig.
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	CACertFile         string
+	InsecureSkipVerify bool
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+	GroupAttribute     string
+	GroupBaseDN        string
+	GroupFilter        string
+	// RoleMapping is in priority order, the first mapped group of a user decides the role
+	RoleMapping []ldapRoleMapping
+	// DefaultRole is given to new users without a mapped group; empty refuses them
+	DefaultRole string
+	PoolSize    int
+	Timeout     time.Duration
+}
+
+/*
+NewLDAPConfig turns the auth.ldap settings into the backend's settings. The group base DN defaults
+to the base DN, the role mapping holds semicolon separated group=role pairs with groups by DN or CN,
+e.g. "gograb-admins=admin;cn=staff,ou=groups,dc=example,dc=com=user", and the default role "none"
+refuses new users without a mapped group.
+*/
+func NewLDAPConfig(cfg config.LDAPConfig) LDAPConfig {
+	ldapConfig := LDAPConfig{
+		URL:                cfg.URL,
+		StartTLS:           cfg.StartTLS,
+		CACertFile:         cfg.CACert,
+		InsecureSkipVerify: cfg.TLSInsecure,
+		BindDN:             cfg.BindDN,
+		BindPassword:       cfg.BindPassword,
+		BaseDN:             cfg.BaseDN,
+		UserFilter:         cfg.UserFilter,
+		GroupAttribute:     cfg.GroupAttribute,
+		GroupBaseDN:        cfg.GroupBaseDN,
+		GroupFilter:        cfg.GroupFilter,
+		DefaultRole:        cfg.DefaultRole,
+		PoolSize:           cfg.PoolSize,
+		Timeout:            cfg.Timeout,
+	}
+	if ldapConfig.GroupBaseDN == "" {
+		ldapConfig.GroupBaseDN = ldapConfig.BaseDN
+	}
+	if ldapConfig.DefaultRole == "none" {
+		ldapConfig.DefaultRole = ""
+	}
+	for _, pair := range strings.Split(cfg.RoleMapping, ";") {
+		// group DNs contain "=" themselves, the role comes after the last one
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			continue
+		}
+		ldapConfig.RoleMapping = append(ldapConfig.RoleMapping, ldapRoleMapping{
+			Group: strings.TrimSpace(pair[:i]),
+			Role:  strings.TrimSpace(pair[i+1:]),
+		})
+	}
+	return ldapConfig
+}
+
+// LDAPDirectory checks a user's password against a directory and returns the DNs of the user's groups.
+// It returns ErrUserNotFound for unknown users and ErrInvalidCredentials for a wrong password.
+// The pooled LDAP client implements it; tests and local setups can plug in a stand-in.
+type LDAPDirectory interface {
+	Verify(username, password string) (groups []string, err error)
+}
+
+// ldapUserStore is where the LDAP backend finds and provisions GoGrab users, the database outside of tests.
+type ldapUserStore interface {
+	GetUserByUsername(username string) (*models.User, error)
+	CreateExternalUser(username, role, source string) error
+	UpdateUserRole(userID int, role string) (bool, error)
+	RoleExists(name string) (bool, error)
+}
+
+type databaseUserStore struct{}
+
+func (databaseUserStore) GetUserByUsername(username string) (*models.User, error) {
+	return database.GetUserByUsername(username)
+}
+
+func (databaseUserStore) CreateExternalUser(username, role, source string) error {
+	return database.CreateExternalUser(username, role, source)
+}
+
+func (databaseUserStore) UpdateUserRole(userID int, role string) (bool, error) {
+	return database.UpdateUserRole(userID, role)
+}
+
+func (databaseUserStore) RoleExists(name string) (bool, error) { return RoleExists(name) }
+
+// LDAPAuthenticator logs in directory users with an LDAP bind and provisions them with the role mapped from their groups.
+type LDAPAuthenticator struct {
+	config    LDAPConfig
+	directory LDAPDirectory
+	users     ldapUserStore
+}
+
+// NewLDAPAuthenticator returns an LDAP backend. Without a directory it connects to the configured URL with a connection pool.
+func NewLDAPAuthenticator(config LDAPConfig, directory LDAPDirectory) (*LDAPAuthenticator, error) {
+	if directory == nil {
+		pool, err := newLDAPPool(config)
+		if err != nil {
+			return nil, err
+		}
+		directory = pool
+	}
+	return &LDAPAuthenticator{config: config, directory: directory, users: databaseUserStore{}}, nil
+}
+
+func (a *LDAPAuthenticator) Name() string { return models.AuthSourceLDAP }
+
+/*
+Authenticate binds as the user and returns the GoGrab user, creating it on the first login.
+The directory is in charge of the role of its users, a mapped group updates it on every login.
+Users of other sources are left to their backend, so a directory entry with the same name
+can't take over a local account.
+*/
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	// an LDAP bind with an empty password is an anonymous bind and would always succeed
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	user, err := a.users.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID != 0 && user.AuthSource != models.AuthSourceLDAP {
+		return nil, ErrUserNotFound
+	}
+
+	groups, err := a.directory.Verify(username, password)
+	if err != nil {
+		return nil, err
+	}
+	role := a.mapRole(groups)
+
+	if user.ID == 0 {
+		if role == "" {
+			role = a.config.DefaultRole
+		}
+		if role == "" {
+			log.Printf("LDAP user %s has no mapped group, refusing the login", username)
+			return nil, ErrInvalidCredentials
+		}
+		if err := a.users.CreateExternalUser(username, role, models.AuthSourceLDAP); err != nil {
+			return nil, err
+		}
+		log.Printf("Provisioned user %s with role %s from LDAP", username, role)
+		return a.users.GetUserByUsername(username)
+	}
+
+	if role != "" && role != user.Role {
+		if _, err := a.users.UpdateUserRole(user.ID, role); err != nil {
+			return nil, err
+		}
+		log.Printf("Role of user %d changed from %s to %s by LDAP groups", user.ID, user.Role, role)
+		user.Role = role
+	}
+	return user, nil
+}
+
+// mapRole returns the role of the first mapping that matches one of the groups.
+func (a *LDAPAuthenticator) mapRole(groups []string) string {
+	for _, mapping := range a.config.RoleMapping {
+		for _, group := range groups {
+			if !groupMatches(mapping.Group, group) {
+				continue
+			}
+			exists, err := a.users.RoleExists(mapping.Role)
+			if err != nil || !exists {
+				log.Printf("LDAP role mapping %s=%s points to an unknown role", mapping.Group, mapping.Role)
+				break
+			}
+			return mapping.Role
+		}
+	}
+	return ""
+}
+
+// groupMatches compares a mapped group, given as DN or CN, with a group DN of the directory.
+func groupMatches(mapped, groupDN string) bool {
+	group, err := ldap.ParseDN(groupDN)
+	if err != nil || len(group.RDNs) == 0 {
+		return strings.EqualFold(mapped, groupDN)
+	}
+	if mappedDN, err := ldap.ParseDN(mapped); err == nil && len(mappedDN.RDNs) > 0 && strings.Contains(mapped, "=") {
+		return mappedDN.EqualFold(group)
+	}
+	for _, attribute := range group.RDNs[0].Attributes {
+		if strings.EqualFold(attribute.Type, "cn") && strings.EqualFold(attribute.Value, mapped) {
+			return true
+		}
+	}
+	return false
+}
+
+// ldapPool keeps up to PoolSize idle connections bound as the service account.
+type ldapPool struct {
+	config    LDAPConfig
+	tlsConfig *tls.Config
+	idle      chan *ldap.Conn
+}
+
+func newLDAPPool(config LDAPConfig) (*ldapPool, error) {
+	if config.URL == "" || config.BaseDN == "" {
+		return nil, errors.New("auth.ldap.url and auth.ldap.base_dn are required for the ldap backend")
+	}
+	parsed, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth.ldap.url: %v", err)
+	}
+	if parsed.Scheme == "ldaps" && config.StartTLS {
+		return nil, errors.New("auth.ldap.start_tls can't be used with an ldaps:// URL")
+	}
+	if parsed.Scheme == "ldap" && !config.StartTLS {
+		log.Printf("Warning: LDAP passwords are sent unencrypted, use ldaps:// or auth.ldap.start_tls")
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         parsed.Hostname(),
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CACertFile != "" {
+		pem, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading auth.ldap.ca_cert: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("auth.ldap.ca_cert contains no certificate")
+		}
+	}
+
+	size := config.PoolSize
+	if size < 1 {
+		size = 1
+	}
+	return &ldapPool{config: config, tlsConfig: tlsConfig, idle: make(chan *ldap.Conn, size)}, nil
+}
+
+// get returns an idle connection, or dials a new one.
+func (p *ldapPool) get() (*ldap.Conn, error) {
+	for {
+		select {
+		case conn := <-p.idle:
+			if !conn.IsClosing() {
+				return conn, nil
+			}
+		default:
+			return p.dial()
+		}
+	}
+}
+
+// put returns a connection bound as the service account to the pool, or closes it when the pool is full.
+func (p *ldapPool) put(conn *ldap.Conn) {
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (p *ldapPool) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(p.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.config.Timeout}),
+		ldap.DialWithTLSConfig(p.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.config.Timeout)
+	if p.config.StartTLS {
+		if err := conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %v", err)
+		}
+	}
+	if err := p.bindService(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// bindService binds as the service account, or anonymously without one.
+func (p *ldapPool) bindService(conn *ldap.Conn) error {
+	if p.config.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+		return fmt.Errorf("service account bind failed: %v", err)
+	}
+	return nil
+}
+
+/*
+Verify searches the user as service account and binds with the user's DN and password.
+The connection is bound as service account again before it goes back to the pool,
+connections with errors are closed.
+*/
+func (p *ldapPool) Verify(username, password string) ([]string, error) {
+	conn, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+
+	timeLimit := int(p.config.Timeout.Seconds())
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, timeLimit, false,
+		fmt.Sprintf(p.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{p.config.GroupAttribute}, nil,
+	))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("LDAP user search failed: %v", err)
+	}
+	if len(result.Entries) == 0 {
+		p.put(conn)
+		return nil, ErrUserNotFound
+	}
+	if len(result.Entries) > 1 {
+		p.put(conn)
+		return nil, fmt.Errorf("LDAP user filter matches several entries for %s", username)
+	}
+	entry := result.Entries[0]
+
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		err = ErrInvalidCredentials
+	}
+	// the connection is bound as the user now, or in an undefined state after a failed bind
+	if rebindErr := p.bindService(conn); rebindErr != nil {
+		conn.Close()
+		if err == nil {
+			err = rebindErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			err = fmt.Errorf("LDAP bind failed: %v", err)
+		}
+		p.put(conn)
+		return nil, err
+	}
+
+	groups := entry.GetAttributeValues(p.config.GroupAttribute)
+	if p.config.GroupFilter != "" {
+		result, err := conn.Search(ldap.NewSearchRequest(
+			p.config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, timeLimit, false,
+			fmt.Sprintf(p.config.GroupFilter, ldap.EscapeFilter(entry.DN)),
+			[]string{"dn"}, nil,
+		))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP group search failed: %v", err)
+		}
+		for _, group := range result.Entries {
+			groups = append(groups, group.DN)
+		}
+	}
+	p.put(conn)
+	return groups, nil
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"GoGrab/config"
+	"GoGrab/models"
+	"errors"
+	"testing"
+)
+
+// fakeDirectory stands in for an LDAP server, it knows users by name with their password and group DNs.
+type fakeDirectory struct {
+	users map[string]fakeDirectoryUser
+	binds int
+}
+
+type fakeDirectoryUser struct {
+	password string
+	groups   []string
+}
+
+func (d *fakeDirectory) Verify(username, password string) ([]string, error) {
+	d.binds++
+	user, ok := d.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if user.password != password {
+		return nil, ErrInvalidCredentials
+	}
+	return user.groups, nil
+}
+
+// fakeUserStore keeps GoGrab users in memory instead of the Users table.
+type fakeUserStore struct {
+	users map[string]*models.User
+	roles map[string]bool
+}
+
+func newFakeUserStore(users ...*models.User) *fakeUserStore {
+	store := &fakeUserStore{users: make(map[string]*models.User), roles: map[string]bool{"viewer": true, "user": true, "admin": true}}
+	for i, user := range users {
+		user.ID = i + 1
+		store.users[user.Username] = user
+	}
+	return store
+}
+
+func (s *fakeUserStore) GetUserByUsername(username string) (*models.User, error) {
+	if user, ok := s.users[username]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return &models.User{}, nil
+}
+
+func (s *fakeUserStore) CreateExternalUser(username, role, source string) error {
+	s.users[username] = &models.User{ID: len(s.users) + 1, Username: username, Role: role, AuthSource: source}
+	return nil
+}
+
+func (s *fakeUserStore) UpdateUserRole(userID int, role string) (bool, error) {
+	for _, user := range s.users {
+		if user.ID == userID {
+			user.Role = role
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeUserStore) RoleExists(name string) (bool, error) { return s.roles[name], nil }
+
+const (
+	adminsGroup = "cn=gograb-admins,ou=groups,dc=example,dc=com"
+	staffGroup  = "cn=staff,ou=groups,dc=example,dc=com"
+)
+
+func newTestLDAPAuthenticator(store *fakeUserStore, defaultRole string) (*LDAPAuthenticator, *fakeDirectory) {
+	directory := &fakeDirectory{users: map[string]fakeDirectoryUser{
+		"alice": {password: "alice-secret", groups: []string{staffGroup, adminsGroup}},
+		"bob":   {password: "bob-secret", groups: []string{staffGroup}},
+		"carol": {password: "carol-secret"},
+	}}
+	config := LDAPConfig{
+		RoleMapping: []ldapRoleMapping{
+			{Group: "gograb-admins", Role: "admin"},
+			{Group: staffGroup, Role: "viewer"},
+		},
+		DefaultRole: defaultRole,
+	}
+	authenticator, err := NewLDAPAuthenticator(config, directory)
+	if err != nil {
+		panic(err)
+	}
+	authenticator.users = store
+	return authenticator, directory
+}
+
+func TestLDAPAuthenticateProvisionsMappedRole(t *testing.T) {
+	store := newFakeUserStore()
+	authenticator, _ := newTestLDAPAuthenticator(store, "user")
+
+	user, err := authenticator.Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Role != "admin" || user.AuthSource != models.AuthSourceLDAP {
+		t.Errorf("got role %q from %q, want admin from ldap, the first mapping wins", user.Role, user.AuthSource)
+	}
+
+	user, err = authenticator.Authenticate("bob", "bob-secret")
+	if err != nil || user.Role != "viewer" {
+		t.Errorf("got %+v, %v, want bob mapped to viewer by the DN of his group", user, err)
+	}
+}
+
+func TestLDAPAuthenticateDefaultRole(t *testing.T) {
+	store := newFakeUserStore()
+	authenticator, _ := newTestLDAPAuthenticator(store, "user")
+	if user, err := authenticator.Authenticate("carol", "carol-secret"); err != nil || user.Role != "user" {
+		t.Errorf("got %+v, %v, want carol without mapped group to get the default role", user, err)
+	}
+
+	store = newFakeUserStore()
+	authenticator, _ = newTestLDAPAuthenticator(store, "")
+	if _, err := authenticator.Authenticate("carol", "carol-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got %v, want carol refused without a default role", err)
+	}
+	if _, ok := store.users["carol"]; ok {
+		t.Error("a refused user was provisioned")
+	}
+}
+
+func TestLDAPAuthenticateUpdatesRole(t *testing.T) {
+	store := newFakeUserStore(&models.User{Username: "bob", Role: "admin", AuthSource: models.AuthSourceLDAP})
+	authenticator, _ := newTestLDAPAuthenticator(store, "user")
+
+	user, err := authenticator.Authenticate("bob", "bob-secret")
+	if err != nil || user.Role != "viewer" || store.users["bob"].Role != "viewer" {
+		t.Errorf("got %+v, %v, want the role of bob updated to the mapped viewer", user, err)
+	}
+}
+
+func TestLDAPAuthenticateRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		users     []*models.User
+		username  string
+		password  string
+		want      error
+		wantBinds int
+	}{
+		{"wrong password", nil, "alice", "wrong", ErrInvalidCredentials, 1},
+		{"unknown user", nil, "mallory", "secret", ErrUserNotFound, 1},
+		{"empty password is an anonymous bind", nil, "alice", "", ErrInvalidCredentials, 0},
+		{"local user of the same name", []*models.User{{Username: "alice", Role: "user", AuthSource: models.AuthSourceLocal}}, "alice", "alice-secret", ErrUserNotFound, 0},
+	}
+	for _, test := range tests {
+		authenticator, directory := newTestLDAPAuthenticator(newFakeUserStore(test.users...), "user")
+		if _, err := authenticator.Authenticate(test.username, test.password); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+		if directory.binds != test.wantBinds {
+			t.Errorf("%s: %d binds, want %d", test.name, directory.binds, test.wantBinds)
+		}
+	}
+}
+
+func TestLDAPMapRoleSkipsUnknownRoles(t *testing.T) {
+	store := newFakeUserStore()
+	authenticator, _ := newTestLDAPAuthenticator(store, "user")
+	authenticator.config.RoleMapping = append([]ldapRoleMapping{{Group: "staff", Role: "deleted-role"}}, authenticator.config.RoleMapping...)
+
+	if role := authenticator.mapRole([]string{staffGroup}); role != "viewer" {
+		t.Errorf("got %q, want the mapping to an unknown role to be skipped", role)
+	}
+}
+
+func TestGroupMatches(t *testing.T) {
+	tests := []struct {
+		mapped, group string
+		want          bool
+	}{
+		{"gograb-admins", adminsGroup, true},
+		{"GoGrab-Admins", adminsGroup, true},
+		{adminsGroup, adminsGroup, true},
+		{"CN=gograb-admins, OU=groups, DC=example, DC=com", adminsGroup, true},
+		{"cn=gograb-admins,ou=other,dc=example,dc=com", adminsGroup, false},
+		{"staff", adminsGroup, false},
+		{"groups", adminsGroup, false},
+	}
+	for _, test := range tests {
+		if got := groupMatches(test.mapped, test.group); got != test.want {
+			t.Errorf("groupMatches(%q, %q) = %v, want %v", test.mapped, test.group, got, test.want)
+		}
+	}
+}
+
+func TestNewLDAPConfigRoleMapping(t *testing.T) {
+	cfg := config.Default().Auth.LDAP
+	cfg.BaseDN = "dc=example,dc=com"
+	cfg.RoleMapping = "gograb-admins=admin; cn=staff,ou=groups,dc=example,dc=com=user;broken;=user"
+	cfg.DefaultRole = "none"
+
+	ldapConfig := NewLDAPConfig(cfg)
+	want := []ldapRoleMapping{{"gograb-admins", "admin"}, {staffGroup, "user"}}
+	if len(ldapConfig.RoleMapping) != len(want) {
+		t.Fatalf("got mapping %v, want %v", ldapConfig.RoleMapping, want)
+	}
+	for i := range want {
+		if ldapConfig.RoleMapping[i] != want[i] {
+			t.Errorf("mapping %d is %v, want %v", i, ldapConfig.RoleMapping[i], want[i])
+		}
+	}
+	if ldapConfig.DefaultRole != "" || ldapConfig.UserFilter != "(uid=%s)" || ldapConfig.GroupBaseDN != cfg.BaseDN {
+		t.Errorf("got default role %q, filter %q and group base %q, want none, the uid filter and the base DN", ldapConfig.DefaultRole, ldapConfig.UserFilter, ldapConfig.GroupBaseDN)
+	}
+}
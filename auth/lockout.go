@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"GoGrab/audit"
+	"GoGrab/database"
+	"GoGrab/models"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	maxLoginBackoff = time.Minute
+	maxLoginLockout = 24 * time.Hour
+)
+
+/*
+LoginRetryAfter reports how long a login for the username from the IP has to wait, 0 if it may proceed.
+Every failed login makes the next attempt wait twice as long as the previous one, starting at
+auth.login_backoff and up to a minute; once the failures reach the lockout threshold the account or IP is locked out.
+*/
+func LoginRetryAfter(username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, subject := range loginSubjects(username, ip) {
+		failure, err := database.GetLoginFailure(subject.kind, subject.name)
+		if err != nil {
+			return 0, err
+		}
+		if failure == nil {
+			continue
+		}
+		if until := time.Until(loginAllowedAt(failure)); until > wait {
+			wait = until
+		}
+	}
+	return wait, nil
+}
+
+/*
+RecordLoginFailure counts a failed login for the username and the IP. Reaching the threshold of
+auth.login_account_threshold or auth.login_ip_threshold failures locks the account or IP out for
+auth.login_lockout, doubling with every further failure, and is recorded in the audit trail.
+*/
+func RecordLoginFailure(username, ip string) error {
+	for _, subject := range loginSubjects(username, ip) {
+		failure, err := database.AddLoginFailure(subject.kind, subject.name, settings.LoginFailureWindow)
+		if err != nil {
+			return err
+		}
+		if failure.Failures < subject.threshold {
+			continue
+		}
+
+		lockout := lockoutDuration(failure.Failures - subject.threshold)
+		if err := database.SetLoginLockout(subject.kind, subject.name, time.Now().Add(lockout)); err != nil {
+			return err
+		}
+		log.Printf("Locked out %s %s for %s after %d failed logins", subject.kind, subject.name, lockout, failure.Failures)
+		audit.Record(models.AuditEvent{
+			Action:  audit.ActionLoginLockout,
+			IP:      ip,
+			Target:  subject.kind + ":" + subject.name,
+			Outcome: audit.OutcomeDenied,
+			Details: fmt.Sprintf("%d failed logins, locked out for %s", failure.Failures, lockout),
+		})
+	}
+	return nil
+}
+
+// RecordLoginSuccess forgets the failed logins of the account. The IP keeps its count,
+// otherwise one valid account would let an attacker reset it.
+func RecordLoginSuccess(username string) error {
+	_, err := database.ClearLoginFailures(models.LoginFailureAccount, username)
+	return err
+}
+
+// UnlockLogin lifts the lockout of an account or IP on behalf of an admin and records it in the audit trail.
+func UnlockLogin(kind, subject string, adminID int, ip string) (bool, error) {
+	cleared, err := database.ClearLoginFailures(kind, subject)
+	if err != nil || !cleared {
+		return cleared, err
+	}
+	audit.Record(models.AuditEvent{
+		Action:  audit.ActionLoginUnlock,
+		ActorID: adminID,
+		IP:      ip,
+		Target:  kind + ":" + subject,
+		Outcome: audit.OutcomeSuccess,
+	})
+	return true, nil
+}
+
+type loginSubject struct {
+	kind      string
+	name      string
+	threshold int
+}
+
+func loginSubjects(username, ip string) []loginSubject {
+	return []loginSubject{
+		{models.LoginFailureAccount, username, settings.LoginAccountThreshold},
+		{models.LoginFailureIP, ip, settings.LoginIPThreshold},
+	}
+}
+
+// loginAllowedAt returns when the next login attempt is allowed: after the lockout if there is
+// one, otherwise after the backoff for the number of failures so far.
+func loginAllowedAt(failure *models.LoginFailure) time.Time {
+	if failure.LockedUntil != nil && failure.LockedUntil.After(time.Now()) {
+		return *failure.LockedUntil
+	}
+	backoff := settings.LoginBackoff
+	for i := 1; i < failure.Failures && backoff < maxLoginBackoff; i++ {
+		backoff *= 2
+	}
+	return failure.LastFailureAt.Add(min(backoff, maxLoginBackoff))
+}
+
+// lockoutDuration doubles the lockout for every failure past the threshold, up to a day.
+func lockoutDuration(pastThreshold int) time.Duration {
+	lockout := settings.LoginLockout
+	for i := 0; i < pastThreshold && lockout < maxLoginLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, maxLoginLockout)
+}
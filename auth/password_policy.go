@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// bcrypt only looks at the first 72 bytes, longer passwords are refused instead of silently truncated
+const maxPasswordBytes = 72
+
+// ErrWeakPassword wraps every reason a password is refused by the policy.
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+//go:embed breached_passwords.txt
+var breachedPasswordList string
+
+// breachedPasswords holds the bundled list of breached passwords, lowercase.
+var breachedPasswords = parseBreachedPasswords(breachedPasswordList)
+
+/*
+ValidatePassword checks a new password against the password policy: at least auth.password_min_length
+characters (10 by default) from at least auth.password_min_classes of lowercase, uppercase, digits and
+symbols (3 by default), not containing the username and not on the bundled breached-password list.
+Turning auth.password_breached_check off skips the list.
+*/
+func ValidatePassword(password, username string) error {
+	minLength := settings.PasswordMinLength
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("%w: it must be at least %d characters long", ErrWeakPassword, minLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: it must be at most %d bytes long", ErrWeakPassword, maxPasswordBytes)
+	}
+
+	minClasses := min(settings.PasswordMinClasses, 4)
+	if characterClasses(password) < minClasses {
+		return fmt.Errorf("%w: it must contain at least %d of lowercase letters, uppercase letters, digits and symbols", ErrWeakPassword, minClasses)
+	}
+
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		return fmt.Errorf("%w: it must not contain the username", ErrWeakPassword)
+	}
+	if settings.PasswordBreachedCheck && breachedPasswords[lower] {
+		return fmt.Errorf("%w: it is known from data breaches", ErrWeakPassword)
+	}
+	return nil
+}
+
+// characterClasses counts which of lowercase, uppercase, digits and symbols the password uses.
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+func parseBreachedPasswords(list string) map[string]bool {
+	passwords := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = true
+	}
+	return passwords
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"GoGrab/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// ErrInvalidResetToken is returned for unknown, expired or already used password reset tokens.
+var ErrInvalidResetToken = errors.New("invalid password reset token")
+
+// PasswordResetTTL returns how long reset tokens stay valid, auth.password_reset_ttl (24 hours by default).
+func PasswordResetTTL() time.Duration {
+	return settings.PasswordResetTTL
+}
+
+// IssuePasswordResetToken creates a one-time reset token for the user, replacing earlier unused ones.
+// The token itself is only returned here, the database keeps its hash.
+func IssuePasswordResetToken(userID, createdBy int) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expiration := time.Now().Add(PasswordResetTTL())
+
+	if err := database.SavePasswordResetToken(userID, createdBy, HashToken(token), expiration); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiration, nil
+}
+
+/*
+RedeemPasswordResetToken sets a new password with a reset token and logs the user out everywhere.
+The password is checked against the policy before the token is used up, so a refused password
+can be retried with the same token.
+*/
+func RedeemPasswordResetToken(token, newPassword string) error {
+	stored, err := database.GetPasswordResetTokenByHash(HashToken(token))
+	if err != nil {
+		return err
+	}
+	if stored == nil || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := database.GetUserByID(stored.UserID)
+	if err != nil {
+		return err
+	}
+	if user.ID == 0 {
+		return ErrInvalidResetToken
+	}
+	if err := ValidatePassword(newPassword, user.Username); err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	marked, err := database.MarkPasswordResetTokenUsed(stored.ID)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return ErrInvalidResetToken
+	}
+	if err := database.UpdateUserPassword(user.ID, hashedPassword); err != nil {
+		return err
+	}
+	_, err = RevokeAllSessions(user.ID)
+	return err
+}
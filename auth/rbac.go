@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AdminRole is the built-in role that can manage roles, it can't be deleted or lose that permission.
+const AdminRole = "admin"
+
+// roleCacheTTL bounds how long role changes made by another instance take to show up.
+const roleCacheTTL = time.Minute
+
+var (
+	// ErrUnknownRole is returned for roles that don't exist.
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrRoleCycle is returned when a role would end up inheriting from itself.
+	ErrRoleCycle = errors.New("role inheritance cycle")
+	// ErrInvalidRole is returned by ValidateRole for roles that can't be stored as they are.
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+var (
+	roleCacheLock sync.Mutex
+	roleCache     map[string]models.Role
+	roleCacheTime time.Time
+)
+
+// ValidPermission reports whether permission is one of the known permissions.
+func ValidPermission(permission string) bool {
+	for _, valid := range models.Permissions {
+		if permission == valid {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+HasPermission reports whether the role grants the permission, directly or through inheritance.
+Roles are cached for a minute; errors loading them deny the permission.
+*/
+func HasPermission(role, permission string) bool {
+	roles, err := loadRoles()
+	if err != nil {
+		log.Printf("Error loading roles: %v", err)
+		return false
+	}
+	permissions, err := resolvePermissions(roles, role)
+	if err != nil {
+		return false
+	}
+	return permissions[permission]
+}
+
+// EffectivePermissions returns the sorted permissions a role grants, including the inherited ones.
+func EffectivePermissions(role string) ([]string, error) {
+	roles, err := loadRoles()
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := resolvePermissions(roles, role)
+	if err != nil {
+		return nil, err
+	}
+	return sortedPermissions(permissions), nil
+}
+
+// RoleExists reports whether a role with the given name exists.
+func RoleExists(name string) (bool, error) {
+	roles, err := loadRoles()
+	if err != nil {
+		return false, err
+	}
+	_, ok := roles[name]
+	return ok, nil
+}
+
+// ListRoles returns all roles with their own and their effective permissions.
+func ListRoles() ([]models.Role, error) {
+	roles, err := database.GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	byName := rolesByName(roles)
+	for i := range roles {
+		permissions, err := resolvePermissions(byName, roles[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		roles[i].EffectivePermissions = sortedPermissions(permissions)
+	}
+	return roles, nil
+}
+
+/*
+ValidateRole checks a new or changed role against the stored ones: its permissions must be known,
+its parent must exist and it must not inherit from itself. The admin role has to keep roles:manage,
+otherwise nobody could fix the roles anymore.
+*/
+func ValidateRole(role models.Role) error {
+	for _, permission := range role.Permissions {
+		if !ValidPermission(permission) {
+			return fmt.Errorf("%w: unknown permission %s", ErrInvalidRole, permission)
+		}
+	}
+
+	roles, err := database.GetRoles()
+	if err != nil {
+		return err
+	}
+	byName := rolesByName(roles)
+	byName[role.Name] = role
+
+	if role.Parent != "" {
+		if _, ok := byName[role.Parent]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownRole, role.Parent)
+		}
+	}
+	permissions, err := resolvePermissions(byName, role.Name)
+	if err != nil {
+		return err
+	}
+	if role.Name == AdminRole && !permissions[models.PermRolesManage] {
+		return fmt.Errorf("%w: the %s role must keep the %s permission", ErrInvalidRole, AdminRole, models.PermRolesManage)
+	}
+	return nil
+}
+
+// InvalidateRoles drops the cached roles, so changes take effect on the next request.
+func InvalidateRoles() {
+	roleCacheLock.Lock()
+	defer roleCacheLock.Unlock()
+	roleCache = nil
+}
+
+func loadRoles() (map[string]models.Role, error) {
+	roleCacheLock.Lock()
+	defer roleCacheLock.Unlock()
+
+	if roleCache != nil && time.Since(roleCacheTime) < roleCacheTTL {
+		return roleCache, nil
+	}
+	roles, err := database.GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	roleCache = rolesByName(roles)
+	roleCacheTime = time.Now()
+	return roleCache, nil
+}
+
+// resolvePermissions collects the permissions of a role and all its ancestors.
+func resolvePermissions(roles map[string]models.Role, name string) (map[string]bool, error) {
+	permissions := make(map[string]bool)
+	visited := make(map[string]bool)
+	for name != "" {
+		if visited[name] {
+			return nil, ErrRoleCycle
+		}
+		visited[name] = true
+
+		role, ok := roles[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRole, name)
+		}
+		for _, permission := range role.Permissions {
+			permissions[permission] = true
+		}
+		name = role.Parent
+	}
+	return permissions, nil
+}
+
+func rolesByName(roles []models.Role) map[string]models.Role {
+	byName := make(map[string]models.Role, len(roles))
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+	return byName
+}
+
+func sortedPermissions(permissions map[string]bool) []string {
+	sorted := make([]string, 0, len(permissions))
+	for permission := range permissions {
+		sorted = append(sorted, permission)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
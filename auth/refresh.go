@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+	// The whole token family has been revoked by then.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// AccessTokenTTL returns the lifetime of access tokens, auth.access_token_ttl (60 minutes by default).
+func AccessTokenTTL() time.Duration {
+	return settings.AccessTokenTTL
+}
+
+// RefreshTokenTTL returns the lifetime of refresh tokens, auth.refresh_token_ttl (30 days by default).
+func RefreshTokenTTL() time.Duration {
+	return settings.RefreshTokenTTL
+}
+
+// HashToken returns the hex encoded SHA-256 hash under which a token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssuedRefreshToken is a newly issued refresh token. Token itself is only ever handed to the client.
+type IssuedRefreshToken struct {
+	Token     string
+	UserID    int
+	FamilyID  string
+	ExpiresAt time.Time
+}
+
+/*
+IssueRefreshToken creates a refresh token for the user and stores its hash.
+The token family is the session the token belongs to, a login starts a new one.
+*/
+func IssueRefreshToken(userID int, familyID string) (*IssuedRefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expiration := time.Now().Add(RefreshTokenTTL())
+
+	if err := database.SaveRefreshToken(userID, familyID, HashToken(token), expiration); err != nil {
+		return nil, err
+	}
+	return &IssuedRefreshToken{Token: token, UserID: userID, FamilyID: familyID, ExpiresAt: expiration}, nil
+}
+
+/*
+RotateRefreshToken exchanges a refresh token for a new one of the same family.
+Every refresh token can be used exactly once. Presenting a token that was already rotated means it
+has leaked, so the whole family and its session are revoked and ErrRefreshTokenReused is returned.
+*/
+func RotateRefreshToken(token string) (*IssuedRefreshToken, error) {
+	stored, err := database.GetRefreshTokenByHash(HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// a used token, or losing the race to mark it used, is a reuse
+	marked := false
+	if stored.UsedAt == nil {
+		if marked, err = database.MarkRefreshTokenUsed(stored.ID); err != nil {
+			return nil, err
+		}
+	}
+	if !marked {
+		log.Printf("Refresh token reuse detected for user %d, revoking token family %s", stored.UserID, stored.FamilyID)
+		if _, err := RevokeSession(stored.UserID, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return IssueRefreshToken(stored.UserID, stored.FamilyID)
+}
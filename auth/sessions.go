@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"time"
+)
+
+/*
+StartSession creates the session of a new login. Its ID is also the family ID of the
+session's refresh tokens and the "jti" claim of its access tokens.
+*/
+func StartSession(userID int, userAgent, ip string) (*models.Session, error) {
+	id, err := utils.GenerateID()
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the stored user agent within the column size
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	session := &models.Session{
+		ID:        id,
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+	}
+	if err := database.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// RevokeSession revokes a session of a user together with its refresh tokens.
+// It returns false if the user has no such active session.
+func RevokeSession(userID int, sessionID string) (bool, error) {
+	revoked, err := database.RevokeSession(userID, sessionID)
+	if err != nil {
+		return false, err
+	}
+	if err := database.RevokeRefreshTokenFamily(sessionID); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+// RevokeAllSessions revokes every session and refresh token of a user and returns the number of revoked sessions.
+func RevokeAllSessions(userID int) (int64, error) {
+	revoked, err := database.RevokeUserSessions(userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := database.RevokeUserRefreshTokens(userID); err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// IsSessionActive reports whether a session belongs to the user and is neither revoked nor expired.
+func IsSessionActive(session *models.Session, userID int) bool {
+	return session != nil && session.UserID == userID && session.RevokedAt == nil && time.Now().Before(session.ExpiresAt)
+}
+
+// RevokeOtherSessions revokes every session and refresh token of a user except the given session.
+func RevokeOtherSessions(userID int, keepSessionID string) (int64, error) {
+	revoked, err := database.RevokeOtherUserSessions(userID, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+	if err := database.RevokeOtherUserRefreshTokens(userID, keepSessionID); err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
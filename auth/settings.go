@@ -0,0 +1,15 @@
+package auth
+
+import "GoGrab/config"
+
+// settings are the authentication settings, the defaults until Configure is called.
+var settings = config.Default().Auth
+
+/*
+Configure sets the authentication settings before the server or a command logs anyone in.
+Unlike the storage, the package keeps process-wide state anyway, the signing keys and the
+authentication backends, so the settings are kept next to them.
+*/
+func Configure(cfg config.AuthConfig) {
+	settings = cfg
+}
@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// keyReloadInterval is how long the keys are cached, another instance or the CLI may have rotated them
+	keyReloadInterval = time.Minute
+)
+
+var (
+	// ErrNoSigningKey is returned when no key to sign access tokens is configured.
+	ErrNoSigningKey = errors.New("no signing key configured")
+	// ErrUnknownSigningKey is returned for tokens signed with a key we don't know or no longer accept.
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+)
+
+// signingMethods are the supported values of auth.signing_algorithm.
+var signingMethods = map[string]jwt.SigningMethod{
+	"HS256": jwt.SigningMethodHS256,
+	"RS256": jwt.SigningMethodRS256,
+	"ES256": jwt.SigningMethodES256,
+	"EdDSA": jwt.SigningMethodEdDSA,
+}
+
+// signingKey is a decoded SigningKey.
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	createdAt time.Time
+	retiredAt *time.Time
+}
+
+// keyring caches the signing keys of the database.
+var keyring struct {
+	lock     sync.RWMutex
+	keys     []signingKey // newest first
+	loadedAt time.Time
+}
+
+/*
+SigningAlgorithm returns the algorithm of new signing keys, auth.signing_algorithm: RS256 (the default),
+ES256, EdDSA or HS256. With HS256 tokens are signed with the shared secret auth.secret_key instead,
+which other services can't verify without knowing it.
+*/
+func SigningAlgorithm() (string, error) {
+	alg := settings.SigningAlgorithm
+	if _, ok := signingMethods[alg]; !ok {
+		return "", fmt.Errorf("unsupported auth.signing_algorithm %q, use RS256, ES256, EdDSA or HS256", alg)
+	}
+	return alg, nil
+}
+
+// KeyRotationInterval returns how old the signing key gets before it is replaced, auth.key_rotation_interval (30 days by default).
+func KeyRotationInterval() time.Duration {
+	return settings.KeyRotationInterval
+}
+
+/*
+LoadSigningKeys checks that a key to sign access tokens is configured and loads the key set.
+The server refuses to start without one: with HS256 auth.secret_key has to be set, otherwise
+`gograb keys rotate` creates the first key.
+*/
+func LoadSigningKeys() error {
+	alg, err := SigningAlgorithm()
+	if err != nil {
+		return err
+	}
+	if alg == "HS256" {
+		if settings.SecretKey == "" {
+			return fmt.Errorf("%w: auth.secret_key is empty", ErrNoSigningKey)
+		}
+		return nil
+	}
+	if err := reloadSigningKeys(); err != nil {
+		return err
+	}
+	if _, err := currentSigningKey(); err != nil {
+		return fmt.Errorf("%w: run `gograb keys rotate` to create one", err)
+	}
+	return nil
+}
+
+// SignAccessToken signs the claims with the current signing key, whose ID is set as kid header.
+func SignAccessToken(claims jwt.Claims) (string, error) {
+	alg, err := SigningAlgorithm()
+	if err != nil {
+		return "", err
+	}
+	if alg == "HS256" {
+		secret := settings.SecretKey
+		if secret == "" {
+			return "", ErrNoSigningKey
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	}
+
+	refreshSigningKeys()
+	key, err := currentSigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+/*
+AccessTokenKeyFunc returns the key to verify an access token with, for jwt.ParseWithClaims.
+The token has to name a known key by its kid and use that key's algorithm, so a public key can never
+be used as an HMAC secret. Retired keys are accepted as long as tokens signed with them can be valid.
+*/
+func AccessTokenKeyFunc(token *jwt.Token) (interface{}, error) {
+	alg, err := SigningAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	if alg == "HS256" {
+		secret := settings.SecretKey
+		if token.Method != jwt.SigningMethodHS256 || secret == "" {
+			return nil, ErrUnknownSigningKey
+		}
+		return []byte(secret), nil
+	}
+
+	refreshSigningKeys()
+	kid, _ := token.Header["kid"].(string)
+	key, ok := findSigningKey(kid)
+	if !ok || token.Method.Alg() != key.method.Alg() || !verifiable(key, time.Now()) {
+		return nil, ErrUnknownSigningKey
+	}
+	return key.private.Public(), nil
+}
+
+// JWKS returns the public keys that access tokens can currently be verified with.
+func JWKS() (JSONWebKeySet, error) {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	refreshSigningKeys()
+
+	keyring.lock.RLock()
+	defer keyring.lock.RUnlock()
+	now := time.Now()
+	for _, key := range keyring.keys {
+		if !verifiable(key, now) {
+			continue
+		}
+		jwk, err := NewJSONWebKey(key.kid, key.method.Alg(), key.private.Public())
+		if err != nil {
+			return set, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// RotateSigningKey generates a new key with the given algorithm, which signs all tokens from now on.
+// The previous keys are retired and stay valid for verification until their tokens have expired.
+func RotateSigningKey(alg string) (*models.SigningKey, error) {
+	privateKey, err := generateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	kid := make([]byte, 12)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	key := &models.SigningKey{
+		KID:        base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  time.Now(),
+	}
+	if err := database.AddSigningKey(key); err != nil {
+		return nil, err
+	}
+	if err := reloadSigningKeys(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+/*
+StartKeyRotation replaces the signing key in a background goroutine once it is older than
+auth.key_rotation_interval, and deletes retired keys once no token signed with them can be valid anymore.
+It does nothing with HS256, whose secret is rotated with `gograb keys rotate`.
+*/
+func StartKeyRotation() {
+	alg, err := SigningAlgorithm()
+	if err != nil || alg == "HS256" {
+		return
+	}
+	interval := KeyRotationInterval()
+	check := time.Hour
+	if interval < check {
+		check = interval
+	}
+
+	go func() {
+		ticker := time.NewTicker(check)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := rotateIfDue(alg, interval); err != nil {
+				log.Printf("Error rotating signing keys: %v", err)
+			}
+		}
+	}()
+}
+
+// rotateIfDue rotates the signing key once it is older than the interval and deletes expired keys.
+func rotateIfDue(alg string, interval time.Duration) error {
+	// another instance may have rotated already
+	if err := reloadSigningKeys(); err != nil {
+		return err
+	}
+	current, err := currentSigningKey()
+	if err != nil {
+		return err
+	}
+
+	if time.Since(current.createdAt) >= interval {
+		rotated, err := RotateSigningKey(alg)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rotated the signing key, %s replaces %s", rotated.KID, current.kid)
+	}
+
+	deleted, err := database.DeleteSigningKeysRetiredBefore(time.Now().Add(-AccessTokenTTL()))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired signing keys", deleted)
+	}
+	return nil
+}
+
+// reloadSigningKeys reads the key set from the database.
+func reloadSigningKeys() error {
+	stored, err := database.GetSigningKeys()
+	if err != nil {
+		return err
+	}
+	keys := make([]signingKey, 0, len(stored))
+	for _, key := range stored {
+		decoded, err := decodeSigningKey(key)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", key.KID, err)
+			continue
+		}
+		keys = append(keys, decoded)
+	}
+
+	keyring.lock.Lock()
+	keyring.keys = keys
+	keyring.loadedAt = time.Now()
+	keyring.lock.Unlock()
+	return nil
+}
+
+/*
+refreshSigningKeys reads the key set again once it is older than a minute, so keys rotated or deleted
+by another instance or the CLI are picked up. On errors the cached keys are kept.
+*/
+func refreshSigningKeys() {
+	keyring.lock.RLock()
+	due := time.Since(keyring.loadedAt) > keyReloadInterval
+	keyring.lock.RUnlock()
+	if !due {
+		return
+	}
+	if err := reloadSigningKeys(); err != nil {
+		log.Printf("Error reloading signing keys: %v", err)
+	}
+}
+
+// currentSigningKey returns the newest key that isn't retired.
+func currentSigningKey() (signingKey, error) {
+	keyring.lock.RLock()
+	defer keyring.lock.RUnlock()
+	for _, key := range keyring.keys {
+		if key.retiredAt == nil {
+			return key, nil
+		}
+	}
+	return signingKey{}, ErrNoSigningKey
+}
+
+func findSigningKey(kid string) (signingKey, bool) {
+	keyring.lock.RLock()
+	defer keyring.lock.RUnlock()
+	for _, key := range keyring.keys {
+		if key.kid == kid {
+			return key, true
+		}
+	}
+	return signingKey{}, false
+}
+
+// verifiable reports whether tokens signed with the key can still be valid.
+func verifiable(key signingKey, now time.Time) bool {
+	return key.retiredAt == nil || now.Before(key.retiredAt.Add(AccessTokenTTL()))
+}
+
+func generateSigningKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	}
+	return nil, fmt.Errorf("no key pairs for algorithm %q", alg)
+}
+
+func decodeSigningKey(key models.SigningKey) (signingKey, error) {
+	method, ok := signingMethods[key.Algorithm]
+	if !ok || key.Algorithm == "HS256" {
+		return signingKey{}, fmt.Errorf("unsupported algorithm %q", key.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return signingKey{}, errors.New("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, err
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return signingKey{}, errors.New("not a signing key")
+	}
+	// the algorithm has to fit the key, an RSA key must never be used for ES256 and the other way round
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		ok = key.Algorithm == "RS256"
+	case *ecdsa.PrivateKey:
+		ok = key.Algorithm == "ES256"
+	case ed25519.PrivateKey:
+		ok = key.Algorithm == "EdDSA"
+	default:
+		ok = false
+	}
+	if !ok {
+		return signingKey{}, fmt.Errorf("key doesn't match algorithm %s", key.Algorithm)
+	}
+	return signingKey{kid: key.KID, method: method, private: private, createdAt: key.CreatedAt, retiredAt: key.RetiredAt}, nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890" in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfc6238Vectors are the SHA-1 test vectors of RFC 6238 Appendix B, cut to the 6 digits GoGrab uses.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string // the 8 digit code of the RFC is 94287082 for 59 and so on
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("decoding the secret: %v", err)
+	}
+	for _, vector := range rfc6238Vectors {
+		if got := totpCode(key, vector.unix/totpPeriod); got != vector.code {
+			t.Errorf("code at %d is %s, want %s", vector.unix, got, vector.code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, vector.code, 0, time.Unix(vector.unix, 0))
+		if !ok || step != vector.unix/totpPeriod {
+			t.Errorf("code %s at %d: got step %d, %v, want step %d", vector.code, vector.unix, step, ok, vector.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0) // step 37037037, code 050471
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		now      time.Time
+		want     bool
+	}{
+		{"current step", rfc6238Secret, "050471", 0, now, true},
+		{"spaces and lowercase secret", strings.ToLower(rfc6238Secret), "050 471", 0, now, true},
+		{"previous step within the skew", rfc6238Secret, "050471", 0, now.Add(totpPeriod * time.Second), true},
+		{"next step within the skew", rfc6238Secret, "050471", 0, now.Add(-totpPeriod * time.Second), true},
+		{"outside the skew", rfc6238Secret, "050471", 0, now.Add(2 * totpPeriod * time.Second), false},
+		{"replayed code", rfc6238Secret, "050471", 1111111111 / totpPeriod, now, false},
+		{"wrong code", rfc6238Secret, "050472", 0, now, false},
+		{"8 digit code", rfc6238Secret, "14050471", 0, now, false},
+		{"invalid secret", "not base32!", "050471", 0, now, false},
+	}
+	for _, test := range tests {
+		if _, ok := ValidateTOTP(test.secret, test.code, test.lastStep, test.now); ok != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, ok, test.want)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v, want 160 bits", secret, len(key), err)
+	}
+
+	uri, err := url.Parse(TOTPProvisioningURI(secret, "alice"))
+	if err != nil {
+		t.Fatalf("provisioning URI: %v", err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || query.Get("secret") != secret || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("provisioning URI %s lacks the secret or parameters", uri)
+	}
+}
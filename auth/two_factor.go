@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+var (
+	// ErrInvalidChallenge is returned for unknown, expired or exhausted login challenges.
+	ErrInvalidChallenge = errors.New("invalid login challenge")
+	// ErrInvalidCode is returned for wrong, reused or expired TOTP and recovery codes.
+	ErrInvalidCode = errors.New("invalid code")
+	// ErrTOTPNotPending is returned when confirming an enrollment that was never started or is already confirmed.
+	ErrTOTPNotPending = errors.New("no pending two-factor enrollment")
+	// ErrTOTPEnabled is returned when starting an enrollment while 2FA is already on.
+	ErrTOTPEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorRequired is returned when disabling 2FA that the user's role requires.
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for this role")
+)
+
+var recoveryCodeEncoding = strings.ToLower("ABCDEFGHIJKLMNOPQRSTUVWXYZ234567")
+
+// RoleRequires2FA reports whether users of the role can only log in with two-factor authentication.
+func RoleRequires2FA(role string) (bool, error) {
+	roles, err := loadRoles()
+	if err != nil {
+		return false, err
+	}
+	return roles[role].Require2FA, nil
+}
+
+/*
+SecondFactorPurpose returns which login challenge a user has to pass after the password:
+ChallengeVerify with 2FA enabled, ChallengeEnroll if the role requires 2FA that isn't set up yet,
+and an empty string if the password is enough.
+*/
+func SecondFactorPurpose(user *models.User) (string, error) {
+	if user.TOTPEnabled {
+		return models.ChallengeVerify, nil
+	}
+	required, err := RoleRequires2FA(user.Role)
+	if err != nil {
+		return "", err
+	}
+	if required {
+		return models.ChallengeEnroll, nil
+	}
+	return "", nil
+}
+
+// IssueLoginChallenge creates the challenge token of the second login step.
+func IssueLoginChallenge(userID int, purpose string) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expiration := time.Now().Add(loginChallengeTTL)
+
+	if err := database.CreateLoginChallenge(userID, HashToken(token), purpose, expiration); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiration, nil
+}
+
+// GetLoginChallenge returns the challenge of a token as long as it hasn't expired or run out of attempts.
+func GetLoginChallenge(token string) (*models.LoginChallenge, error) {
+	challenge, err := database.GetLoginChallenge(HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= maxChallengeAttempts {
+		return nil, ErrInvalidChallenge
+	}
+	return challenge, nil
+}
+
+// FailLoginChallenge counts a wrong code, after five of them the challenge is used up and the login has to start over.
+func FailLoginChallenge(challenge *models.LoginChallenge) error {
+	return database.AddLoginChallengeAttempt(challenge.ID)
+}
+
+// CompleteLoginChallenge uses up a challenge. Only one request can complete it.
+func CompleteLoginChallenge(challenge *models.LoginChallenge) error {
+	deleted, err := database.DeleteLoginChallenge(challenge.ID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for the user and returns it with its provisioning URI.
+// 2FA is only enabled once ConfirmTOTPEnrollment gets a valid code for it.
+func BeginTOTPEnrollment(user *models.User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", ErrTOTPEnabled
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := database.SetTOTPSecret(user.ID, secret); err != nil {
+		return "", "", err
+	}
+	return secret, TOTPProvisioningURI(secret, user.Username), nil
+}
+
+// ConfirmTOTPEnrollment enables 2FA with a code of the pending secret and returns fresh recovery codes.
+func ConfirmTOTPEnrollment(userID int, code string) ([]string, error) {
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == 0 || user.TOTPSecret == "" || user.TOTPEnabled {
+		return nil, ErrTOTPNotPending
+	}
+
+	step, ok := ValidateTOTP(user.TOTPSecret, code, 0, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.EnableTOTP(user.ID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+/*
+VerifySecondFactor checks a TOTP code or, failing that, a recovery code of a user with 2FA enabled.
+Both can only be used once.
+*/
+func VerifySecondFactor(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrInvalidCode
+	}
+
+	if step, ok := ValidateTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now()); ok {
+		used, err := database.UseTOTPStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	used, err := database.UseRecoveryCode(user.ID, HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	if left, err := database.CountRecoveryCodes(user.ID); err == nil && left <= 2 {
+		log.Printf("User %d has %d recovery codes left", user.ID, left)
+	}
+	return nil
+}
+
+// DisableTOTP turns 2FA off for a user, unless the user's role requires it.
+func DisableTOTP(user *models.User) error {
+	required, err := RoleRequires2FA(user.Role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+	_, err = database.DisableTOTP(user.ID)
+	return err
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of a user with new ones.
+func RegenerateRecoveryCodes(userID int) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCodes returns new recovery codes of the form xxxxx-xxxxx and the hashes under which they are stored.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		var code strings.Builder
+		for j, b := range buf {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryCodeEncoding[b&31])
+		}
+		codes[i] = code.String()
+		hashes[i] = HashToken(normalizeRecoveryCode(codes[i]))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"GoGrab/database"
+	"GoGrab/utils"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrUsernameTaken is returned when a user with the same username already exists.
+var ErrUsernameTaken = errors.New("username already exists")
+
+// CreateUser hashes the password and stores a user with the given role, which has to exist.
+func CreateUser(username, password, role string) error {
+	if username == "" || password == "" {
+		return errors.New("username and password are required")
+	}
+	exists, err := RoleExists(role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+	if err := ValidatePassword(password, username); err != nil {
+		return err
+	}
+	taken, err := database.UsernameExists(username)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrUsernameTaken
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return database.CreateUser(username, hashedPassword, role)
+}
+
+/*
+BootstrapAdmin creates the first admin on a fresh instance from auth.admin_username and auth.admin_password.
+It does nothing once any admin exists, so the settings can stay across restarts.
+*/
+func BootstrapAdmin() error {
+	admins, err := database.CountUsersWithRole(AdminRole)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	username, password := settings.AdminUsername, settings.AdminPassword
+	if username == "" || password == "" {
+		log.Println("No admin exists yet, set auth.admin_username and auth.admin_password or run \"gograb admin create\"")
+		return nil
+	}
+	if err := CreateUser(username, password, AdminRole); err != nil {
+		return fmt.Errorf("error creating admin %s: %v", username, err)
+	}
+	log.Printf("Created admin %s", username)
+	return nil
+}
+
+// SetPassword checks a new password against the policy, then stores it and clears a pending forced password change.
+func SetPassword(userID int, username, password string) error {
+	if err := ValidatePassword(password, username); err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return database.UpdateUserPassword(userID, hashedPassword)
+}
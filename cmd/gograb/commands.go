@@ -0,0 +1,297 @@
+package main
+
+import (
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/config"
+	"GoGrab/database"
+	"GoGrab/functions"
+	"GoGrab/models"
+	"GoGrab/server"
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// runServe takes the configuration flags, like -config FILE or -addr :8080.
+func runServe(args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	return server.Run(cfg)
+}
+
+// runConfigShow prints the effective configuration with the secrets masked.
+func runConfigShow(args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	fmt.Println(cfg)
+	return nil
+}
+
+// connectDatabase connects to the database of the configuration file and the environment and applies
+// the authentication settings, which the commands creating users and keys follow.
+func connectDatabase() error {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return err
+	}
+	auth.Configure(cfg.Auth)
+	functions.CheckDatabaseConnection(cfg.Database)
+	return nil
+}
+
+func runMigrate(args []string) error {
+	flag.NewFlagSet("db migrate", flag.ExitOnError).Parse(args)
+	if err := connectDatabase(); err != nil {
+		return err
+	}
+
+	executed, err := database.Migrate()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Ran %d migration statements\n", executed)
+	return nil
+}
+
+func runAdminCreate(args []string) error {
+	flags := flag.NewFlagSet("admin create", flag.ExitOnError)
+	username := flags.String("username", "", "username of the new admin")
+	flags.Parse(args)
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+
+	if err := connectDatabase(); err != nil {
+		return err
+	}
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+	if err := auth.CreateUser(*username, password, auth.AdminRole); err != nil {
+		return err
+	}
+	fmt.Printf("Created admin %s\n", *username)
+	return nil
+}
+
+func runUserSetRole(args []string) error {
+	flags := flag.NewFlagSet("user set-role", flag.ExitOnError)
+	username := flags.String("username", "", "username of the user")
+	role := flags.String("role", "", "new role")
+	flags.Parse(args)
+	if *username == "" || *role == "" {
+		return errors.New("-username and -role are required")
+	}
+
+	if err := connectDatabase(); err != nil {
+		return err
+	}
+	userID, err := lookupUser(*username)
+	if err != nil {
+		return err
+	}
+	exists, err := auth.RoleExists(*role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", auth.ErrUnknownRole, *role)
+	}
+	if _, err := database.UpdateUserRole(userID, *role); err != nil {
+		return err
+	}
+	// access tokens carry the role, so the old ones have to go
+	if _, err := auth.RevokeAllSessions(userID); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s\n", *username, *role)
+	return nil
+}
+
+func runUserUnlock(args []string) error {
+	flags := flag.NewFlagSet("user unlock", flag.ExitOnError)
+	username := flags.String("username", "", "username of the user")
+	flags.Parse(args)
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+
+	if err := connectDatabase(); err != nil {
+		return err
+	}
+	userID, err := lookupUser(*username)
+	if err != nil {
+		return err
+	}
+	if _, err := database.SetUserLocked(userID, false); err != nil {
+		return err
+	}
+	if _, err := auth.UnlockLogin(models.LoginFailureAccount, *username, 0, ""); err != nil {
+		return err
+	}
+	fmt.Printf("Unlocked %s\n", *username)
+	return nil
+}
+
+func runUserSetPassword(args []string) error {
+	flags := flag.NewFlagSet("user set-password", flag.ExitOnError)
+	username := flags.String("username", "", "username of the user")
+	flags.Parse(args)
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+
+	if err := connectDatabase(); err != nil {
+		return err
+	}
+	userID, err := lookupUser(*username)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+	if err := auth.SetPassword(userID, *username, password); err != nil {
+		return err
+	}
+	if _, err := auth.RevokeAllSessions(userID); err != nil {
+		return err
+	}
+	fmt.Printf("Changed the password of %s\n", *username)
+	return nil
+}
+
+/*
+runKeysRotate creates a new signing key for access tokens with the algorithm of auth.signing_algorithm
+or -alg. Running instances pick it up within a minute and keep accepting tokens of the previous key
+until they expire. With HS256 it prints a new random JWT_SECRET_KEY instead, which the operator sets
+before restarting. With -revoke-sessions every session and refresh token is revoked and the old keys are
+deleted as well, which is what you want when a key leaked.
+*/
+func runKeysRotate(args []string) error {
+	flags := flag.NewFlagSet("keys rotate", flag.ExitOnError)
+	alg := flags.String("alg", "", "RS256, ES256, EdDSA or HS256, auth.signing_algorithm by default")
+	revoke := flags.Bool("revoke-sessions", false, "revoke every session and refresh token")
+	flags.Parse(args)
+
+	if *alg == "" {
+		configured, err := auth.SigningAlgorithm()
+		if err != nil {
+			return err
+		}
+		*alg = configured
+	}
+
+	if *alg != "HS256" || *revoke {
+		if err := connectDatabase(); err != nil {
+			return err
+		}
+	}
+	if *revoke {
+		revoked, err := database.RevokeAllSessions()
+		if err != nil {
+			return err
+		}
+		if err := database.RevokeAllRefreshTokens(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Revoked %d sessions\n", revoked)
+	}
+
+	if *alg != "HS256" {
+		key, err := auth.RotateSigningKey(*alg)
+		if err != nil {
+			return err
+		}
+		// a leaked key must not verify anything anymore, the revoked sessions don't need it
+		if *revoke {
+			deleted, err := database.DeleteRetiredSigningKeys()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Deleted %d old signing keys\n", deleted)
+		}
+		fmt.Printf("Created %s signing key %s\n", key.Algorithm, key.KID)
+		return nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Set the new key and restart the server:")
+	fmt.Printf("JWT_SECRET_KEY=%s\n", base64.RawStdEncoding.EncodeToString(key))
+	return nil
+}
+
+// runAuditVerify checks the hash chain of the audit log and fails with the first broken event.
+func runAuditVerify(args []string) error {
+	flag.NewFlagSet("audit verify", flag.ExitOnError).Parse(args)
+	if err := connectDatabase(); err != nil {
+		return err
+	}
+
+	result, err := audit.Verify()
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		return fmt.Errorf("audit log broken at event %d after %d intact events: %s", result.BrokenAt, result.Checked, result.Reason)
+	}
+	fmt.Printf("Audit log intact, %d events checked\n", result.Checked)
+	return nil
+}
+
+// lookupUser returns the ID of the user with the given username.
+func lookupUser(username string) (int, error) {
+	user, err := database.GetUserByUsername(username)
+	if err != nil {
+		return 0, err
+	}
+	if user.ID == 0 {
+		return 0, fmt.Errorf("user %s not found", username)
+	}
+	return user.ID, nil
+}
+
+/*
+readPassword reads a password from the first line of standard input. When that is a terminal the
+password is typed without echo, so it doesn't stay on the screen; piped input is read as it is.
+*/
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	var line string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		typed, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr) // the newline typed by the user wasn't echoed either
+		if err != nil {
+			return "", fmt.Errorf("error reading the password: %v", err)
+		}
+		line = string(typed)
+	} else {
+		var err error
+		line, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", errors.New("no password given on standard input")
+		}
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("the password can't be empty")
+	}
+	return password, nil
+}
@@ -0,0 +1,98 @@
+/*
+Command gograb runs and manages a GoGrab instance. It uses the same database layer as the
+HTTP server, so an instance can be set up and repaired without writing SQL.
+
+	gograb serve [-config FILE] [-addr :8080] [-database.host HOST:PORT ...]
+	gograb config show [-config FILE] [flags]
+	gograb db migrate
+	gograb admin create -username NAME
+	gograb user set-role -username NAME -role ROLE
+	gograb user unlock -username NAME
+	gograb user set-password -username NAME
+	gograb keys rotate [-alg RS256] [-revoke-sessions]
+	gograb audit verify
+
+Passwords are read from standard input, so they don't end up in the shell history; on a terminal
+they are typed without echo.
+Every command reads the configuration file and the environment, serve and config show also take
+a flag for every setting, see gograb serve -h.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a subcommand, run gets the arguments after its name.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]map[string]command{
+	"serve": {"": {"serve [-config FILE] [-addr :8080]", runServe}},
+	"config": {
+		"show": {"config show [-config FILE]", runConfigShow},
+	},
+	"db": {
+		"migrate": {"db migrate", runMigrate},
+	},
+	"admin": {
+		"create": {"admin create -username NAME", runAdminCreate},
+	},
+	"user": {
+		"set-role":     {"user set-role -username NAME -role ROLE", runUserSetRole},
+		"unlock":       {"user unlock -username NAME", runUserUnlock},
+		"set-password": {"user set-password -username NAME", runUserSetPassword},
+	},
+	"keys": {
+		"rotate": {"keys rotate [-alg RS256] [-revoke-sessions]", runKeysRotate},
+	},
+	"audit": {
+		"verify": {"audit verify", runAuditVerify},
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	group, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	name, args := "", os.Args[2:]
+	if _, single := group[""]; !single {
+		if len(args) == 0 {
+			usage()
+		}
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := group[name]
+	if !ok {
+		usage()
+	}
+
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "gograb: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, group := range []string{"serve", "config", "db", "admin", "user", "keys", "audit"} {
+		names := make([]string, 0, len(commands[group]))
+		for name := range commands[group] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(os.Stderr, "  gograb "+commands[group][name].usage)
+		}
+	}
+	os.Exit(2)
+}
@@ -0,0 +1,46 @@
+/*
+Command mockidp is a minimal OpenID Connect provider for trying out and testing single sign-on locally.
+It signs in everyone without asking, as the user given by the flags or by a login_hint of the form
+"username:group1,group2", and supports discovery, the authorization code flow with PKCE and a JWKS
+with a key that is generated on every start. The provider itself is GoGrab/oidc/oidctest.
+
+	mockidp [-addr :9000] [-client gograb] [-username alice] [-groups gograb-admins]
+
+Point GoGrab at it with:
+
+	OIDC_ISSUER=http://localhost:9000
+	OIDC_CLIENT_ID=gograb
+	OIDC_REDIRECT_URL=http://localhost:8080/api/v1/oidc/callback
+*/
+package main
+
+import (
+	"GoGrab/oidc/oidctest"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "", "issuer URL, http://localhost<addr> by default")
+	clientID := flag.String("client", "gograb", "accepted client ID")
+	username := flag.String("username", "alice", "username of the signed in user")
+	groups := flag.String("groups", "", "comma separated groups of the signed in user")
+	flag.Parse()
+
+	p, err := oidctest.NewProvider(*clientID)
+	if err != nil {
+		log.Fatalf("Error generating signing key: %v", err)
+	}
+	if *issuer == "" {
+		*issuer = "http://localhost" + *addr
+	}
+	p.Issuer = strings.TrimSuffix(*issuer, "/")
+	p.Username = *username
+	p.Groups = oidctest.SplitGroups(*groups)
+
+	log.Printf("Mock OIDC provider %s listening on %s", p.Issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, p.Handler()))
+}
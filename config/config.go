@@ -0,0 +1,597 @@
+/*
+Package config holds the settings of the server, the database, the crawler, the storage, the rate
+limits and the authentication. They are read from defaults, a YAML file, environment variables and
+flags, each overriding the ones before. The packages get the part they need passed by the caller.
+*/
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read when neither -config nor GOGRAB_CONFIG name a file, it may be missing.
+const DefaultFile = "gograb.yaml"
+
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Crawler   CrawlerConfig   `yaml:"crawler"`
+	Storage   StorageConfig   `yaml:"storage"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Auth      AuthConfig      `yaml:"auth"`
+}
+
+type ServerConfig struct {
+	Addr       string `yaml:"addr"`
+	SwaggerURL string `yaml:"swagger_url"`
+	// ShutdownTimeout is how long a shutdown waits for requests and page fetches in flight.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies are the IPs and CIDR ranges of the reverse proxies whose X-Forwarded-For is believed.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// TrustedProxyPrefixes returns the trusted proxies as prefixes, a single IP becoming a prefix of its full length.
+// Invalid entries are skipped, Validate reports them.
+func (c ServerConfig) TrustedProxyPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, proxy := range c.TrustedProxies {
+		if prefix, err := parseProxy(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	Params   string `yaml:"params"`
+}
+
+// DSN returns the data source name of the MySQL driver. It contains the password, don't log it.
+func (c DatabaseConfig) DSN() string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", c.User, c.Password, c.Host, c.Name)
+	if c.Params != "" {
+		dsn += "?" + c.Params
+	}
+	return dsn
+}
+
+type CrawlerConfig struct {
+	// Delay is the pause before every fetch, so a crawl doesn't overload the site.
+	Delay time.Duration `yaml:"delay"`
+	// PageTimeout limits loading and reading a page in the browser.
+	PageTimeout time.Duration `yaml:"page_timeout"`
+	// CheckpointInterval is how often a running crawl saves its frontier, 0 saves it after every page.
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"`
+}
+
+type StorageConfig struct {
+	DataFolder    string `yaml:"data_folder"`
+	TrashFolder   string `yaml:"trash_folder"`
+	ArchiveFolder string `yaml:"archive_folder"`
+	// TrashGracePeriod is how long deleted pages can be restored before they are purged.
+	TrashGracePeriod time.Duration `yaml:"trash_grace_period"`
+	// ArchiveTTL is how long prebuilt archives are kept.
+	ArchiveTTL time.Duration `yaml:"archive_ttl"`
+	// JanitorInterval is how often the retention policies are applied and the expired trash and archives purged.
+	JanitorInterval time.Duration `yaml:"janitor_interval"`
+}
+
+// RateLimitConfig holds the limits of the rate limit policies, written as COUNT/UNIT[:BURST] (e.g. "600/m:100") or "off".
+type RateLimitConfig struct {
+	// Store keeps the token buckets: "memory" in the process or "mysql" in the database, shared by all instances.
+	Store string `yaml:"store"`
+	// AuthIP limits the login and registration endpoints per client IP.
+	AuthIP string `yaml:"auth_ip"`
+	// APIUser and APIKey limit every authenticated endpoint per user and per API key.
+	APIUser string `yaml:"api_user"`
+	APIKey  string `yaml:"api_apikey"`
+	// ClientIP limits the authenticated endpoints per client IP before the credentials are checked, so guessing them is throttled.
+	ClientIP string `yaml:"client_ip"`
+}
+
+type AuthConfig struct {
+	// Backends check usernames and passwords in this order, "local" and "ldap".
+	Backends []string `yaml:"backends"`
+	// LocalLogin turns the username and password endpoints on, single sign-on is the only login without them.
+	LocalLogin bool `yaml:"local_login"`
+	// AdminUsername and AdminPassword create the first admin of a fresh instance.
+	AdminUsername string `yaml:"admin_username"`
+	AdminPassword string `yaml:"admin_password"`
+	// SigningAlgorithm signs new access tokens: RS256, ES256, EdDSA or HS256 with the shared SecretKey.
+	SigningAlgorithm    string        `yaml:"signing_algorithm"`
+	SecretKey           string        `yaml:"secret_key"`
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval"`
+	// Issuer and Audience are the iss and aud claims of the access tokens.
+	Issuer           string        `yaml:"issuer"`
+	Audience         string        `yaml:"audience"`
+	AccessTokenTTL   time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL  time.Duration `yaml:"refresh_token_ttl"`
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	// PasswordMinLength, PasswordMinClasses and PasswordBreachedCheck are the password policy.
+	PasswordMinLength     int  `yaml:"password_min_length"`
+	PasswordMinClasses    int  `yaml:"password_min_classes"`
+	PasswordBreachedCheck bool `yaml:"password_breached_check"`
+	// LoginFailureWindow is how long failed logins are counted; reaching a threshold locks the account or IP out.
+	LoginFailureWindow    time.Duration `yaml:"login_failure_window"`
+	LoginAccountThreshold int           `yaml:"login_account_threshold"`
+	LoginIPThreshold      int           `yaml:"login_ip_threshold"`
+	LoginBackoff          time.Duration `yaml:"login_backoff"`
+	LoginLockout          time.Duration `yaml:"login_lockout"`
+	LDAP                  LDAPConfig    `yaml:"ldap"`
+	OIDC                  OIDCConfig    `yaml:"oidc"`
+}
+
+type LDAPConfig struct {
+	URL         string `yaml:"url"`
+	StartTLS    bool   `yaml:"start_tls"`
+	CACert      string `yaml:"ca_cert"`
+	TLSInsecure bool   `yaml:"tls_insecure"`
+	// BindDN is the service account that searches the users, anonymous if empty.
+	BindDN         string `yaml:"bind_dn"`
+	BindPassword   string `yaml:"bind_password"`
+	BaseDN         string `yaml:"base_dn"`
+	UserFilter     string `yaml:"user_filter"`
+	GroupAttribute string `yaml:"group_attribute"`
+	GroupBaseDN    string `yaml:"group_base_dn"`
+	GroupFilter    string `yaml:"group_filter"`
+	// RoleMapping holds semicolon separated group=role pairs, groups by DN or CN.
+	RoleMapping string `yaml:"role_mapping"`
+	// DefaultRole is given to new users without a mapped group, "none" refuses them.
+	DefaultRole string        `yaml:"default_role"`
+	PoolSize    int           `yaml:"pool_size"`
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+type OIDCConfig struct {
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
+	// Scopes are space separated.
+	Scopes        string `yaml:"scopes"`
+	UsernameClaim string `yaml:"username_claim"`
+	RoleClaim     string `yaml:"role_claim"`
+	// RoleMapping holds comma separated claim=role pairs.
+	RoleMapping string `yaml:"role_mapping"`
+	// DefaultRole is given to new users without a mapped claim value, "none" refuses them.
+	DefaultRole string `yaml:"default_role"`
+}
+
+// Default returns the settings used when nothing overrides them. There is no default database server
+// or account, they have to be configured.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			SwaggerURL:      "http://localhost:8080/swagger/doc.json",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Name:   "GrabDB",
+			Params: "charset=utf8mb4&parseTime=True&loc=Local",
+		},
+		Crawler: CrawlerConfig{
+			Delay:              time.Second,
+			PageTimeout:        time.Minute,
+			CheckpointInterval: 30 * time.Second,
+		},
+		Storage: StorageConfig{
+			DataFolder:       "./scraping_folder",
+			TrashFolder:      "./scraping_trash",
+			ArchiveFolder:    "./archives",
+			TrashGracePeriod: 7 * 24 * time.Hour,
+			ArchiveTTL:       24 * time.Hour,
+			JanitorInterval:  time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Store:    "memory",
+			AuthIP:   "20/m",
+			APIUser:  "600/m:100",
+			APIKey:   "300/m:60",
+			ClientIP: "1200/m:200",
+		},
+		Auth: AuthConfig{
+			Backends:              []string{"local"},
+			LocalLogin:            true,
+			SigningAlgorithm:      "RS256",
+			KeyRotationInterval:   30 * 24 * time.Hour,
+			Issuer:                "gograb",
+			Audience:              "gograb-api",
+			AccessTokenTTL:        time.Hour,
+			RefreshTokenTTL:       30 * 24 * time.Hour,
+			PasswordResetTTL:      24 * time.Hour,
+			PasswordMinLength:     10,
+			PasswordMinClasses:    3,
+			PasswordBreachedCheck: true,
+			LoginFailureWindow:    time.Hour,
+			LoginAccountThreshold: 5,
+			LoginIPThreshold:      20,
+			LoginBackoff:          time.Second,
+			LoginLockout:          15 * time.Minute,
+			LDAP: LDAPConfig{
+				UserFilter:     "(uid=%s)",
+				GroupAttribute: "memberOf",
+				DefaultRole:    "user",
+				PoolSize:       5,
+				Timeout:        5 * time.Second,
+			},
+			OIDC: OIDCConfig{
+				Scopes:        "openid profile email",
+				UsernameClaim: "preferred_username",
+				RoleClaim:     "groups",
+				DefaultRole:   "user",
+			},
+		},
+	}
+}
+
+// setting is a value that can be set by environment variable and flag, its key is the YAML path.
+type setting struct {
+	key    string
+	env    string
+	usage  string
+	secret bool
+	field  func(c *Config) interface{}
+}
+
+var settings = []setting{
+	{"server.addr", "LISTEN_ADDR", "address to listen on", false, func(c *Config) interface{} { return &c.Server.Addr }},
+	{"server.swagger_url", "SWAGGER_URL", "URL of the API description loaded by the Swagger UI", false, func(c *Config) interface{} { return &c.Server.SwaggerURL }},
+	{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "time requests and page fetches get to finish on shutdown", false, func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+	{"server.trusted_proxies", "TRUSTED_PROXIES", "comma separated IPs and CIDR ranges of the reverse proxies whose X-Forwarded-For is trusted", false, func(c *Config) interface{} { return &c.Server.TrustedProxies }},
+	{"database.host", "DB_HOST", "MySQL host and port", false, func(c *Config) interface{} { return &c.Database.Host }},
+	{"database.user", "DB_USER", "MySQL user", false, func(c *Config) interface{} { return &c.Database.User }},
+	{"database.password", "DB_PASSWORD", "MySQL password", true, func(c *Config) interface{} { return &c.Database.Password }},
+	{"database.name", "DB_NAME", "MySQL database", false, func(c *Config) interface{} { return &c.Database.Name }},
+	{"database.params", "DB_PARAMS", "query parameters of the MySQL DSN", false, func(c *Config) interface{} { return &c.Database.Params }},
+	{"crawler.delay", "CRAWL_DELAY", "pause before every fetch", false, func(c *Config) interface{} { return &c.Crawler.Delay }},
+	{"crawler.page_timeout", "CRAWL_PAGE_TIMEOUT", "time limit for loading a page", false, func(c *Config) interface{} { return &c.Crawler.PageTimeout }},
+	{"crawler.checkpoint_interval", "CRAWL_CHECKPOINT_INTERVAL", "how often a crawl saves its frontier", false, func(c *Config) interface{} { return &c.Crawler.CheckpointInterval }},
+	{"storage.data_folder", "DATA_FOLDER", "folder of the scraped pages", false, func(c *Config) interface{} { return &c.Storage.DataFolder }},
+	{"storage.trash_folder", "TRASH_FOLDER", "folder of the deleted pages", false, func(c *Config) interface{} { return &c.Storage.TrashFolder }},
+	{"storage.archive_folder", "ARCHIVE_FOLDER", "folder of the prebuilt archives", false, func(c *Config) interface{} { return &c.Storage.ArchiveFolder }},
+	{"storage.trash_grace_period", "TRASH_GRACE_PERIOD", "how long deleted pages can be restored", false, func(c *Config) interface{} { return &c.Storage.TrashGracePeriod }},
+	{"storage.archive_ttl", "ARCHIVE_TTL", "how long prebuilt archives are kept", false, func(c *Config) interface{} { return &c.Storage.ArchiveTTL }},
+	{"storage.janitor_interval", "JANITOR_INTERVAL", "how often the retention policies are applied and the expired trash and archives purged", false, func(c *Config) interface{} { return &c.Storage.JanitorInterval }},
+	{"rate_limit.store", "RATE_LIMIT_STORE", "where the rate limit buckets are kept, memory or mysql", false, func(c *Config) interface{} { return &c.RateLimit.Store }},
+	{"rate_limit.auth_ip", "RATE_LIMIT_AUTH_IP", "limit of the login endpoints per IP", false, func(c *Config) interface{} { return &c.RateLimit.AuthIP }},
+	{"rate_limit.api_user", "RATE_LIMIT_API_USER", "limit of the authenticated endpoints per user", false, func(c *Config) interface{} { return &c.RateLimit.APIUser }},
+	{"rate_limit.api_apikey", "RATE_LIMIT_API_APIKEY", "limit of the authenticated endpoints per API key", false, func(c *Config) interface{} { return &c.RateLimit.APIKey }},
+	{"rate_limit.client_ip", "RATE_LIMIT_CLIENT_IP", "limit of the authenticated endpoints per IP before the credentials are checked", false, func(c *Config) interface{} { return &c.RateLimit.ClientIP }},
+	{"auth.backends", "AUTH_BACKENDS", "comma separated backends checking passwords in order, local and ldap", false, func(c *Config) interface{} { return &c.Auth.Backends }},
+	{"auth.local_login", "LOCAL_LOGIN_ENABLED", "allow username and password logins", false, func(c *Config) interface{} { return &c.Auth.LocalLogin }},
+	{"auth.admin_username", "ADMIN_USERNAME", "username of the first admin", false, func(c *Config) interface{} { return &c.Auth.AdminUsername }},
+	{"auth.admin_password", "ADMIN_PASSWORD", "password of the first admin", true, func(c *Config) interface{} { return &c.Auth.AdminPassword }},
+	{"auth.signing_algorithm", "JWT_SIGNING_ALG", "algorithm of new signing keys, RS256, ES256, EdDSA or HS256", false, func(c *Config) interface{} { return &c.Auth.SigningAlgorithm }},
+	{"auth.secret_key", "JWT_SECRET_KEY", "shared secret signing the access tokens with HS256", true, func(c *Config) interface{} { return &c.Auth.SecretKey }},
+	{"auth.key_rotation_interval", "JWT_KEY_ROTATION_INTERVAL", "age at which the signing key is replaced", false, func(c *Config) interface{} { return &c.Auth.KeyRotationInterval }},
+	{"auth.issuer", "JWT_ISSUER", "iss claim of the access tokens", false, func(c *Config) interface{} { return &c.Auth.Issuer }},
+	{"auth.audience", "JWT_AUDIENCE", "aud claim of the access tokens", false, func(c *Config) interface{} { return &c.Auth.Audience }},
+	{"auth.access_token_ttl", "ACCESS_TOKEN_TTL", "lifetime of access tokens", false, func(c *Config) interface{} { return &c.Auth.AccessTokenTTL }},
+	{"auth.refresh_token_ttl", "REFRESH_TOKEN_TTL", "lifetime of refresh tokens", false, func(c *Config) interface{} { return &c.Auth.RefreshTokenTTL }},
+	{"auth.password_reset_ttl", "PASSWORD_RESET_TTL", "lifetime of password reset tokens", false, func(c *Config) interface{} { return &c.Auth.PasswordResetTTL }},
+	{"auth.password_min_length", "PASSWORD_MIN_LENGTH", "minimum number of characters of a password", false, func(c *Config) interface{} { return &c.Auth.PasswordMinLength }},
+	{"auth.password_min_classes", "PASSWORD_MIN_CLASSES", "minimum number of lowercase, uppercase, digits and symbols a password uses", false, func(c *Config) interface{} { return &c.Auth.PasswordMinClasses }},
+	{"auth.password_breached_check", "PASSWORD_BREACHED_CHECK", "refuse passwords known from data breaches", false, func(c *Config) interface{} { return &c.Auth.PasswordBreachedCheck }},
+	{"auth.login_failure_window", "LOGIN_FAILURE_WINDOW", "how long failed logins are counted", false, func(c *Config) interface{} { return &c.Auth.LoginFailureWindow }},
+	{"auth.login_account_threshold", "LOGIN_ACCOUNT_THRESHOLD", "failed logins that lock an account out", false, func(c *Config) interface{} { return &c.Auth.LoginAccountThreshold }},
+	{"auth.login_ip_threshold", "LOGIN_IP_THRESHOLD", "failed logins that lock an IP out", false, func(c *Config) interface{} { return &c.Auth.LoginIPThreshold }},
+	{"auth.login_backoff", "LOGIN_BACKOFF", "wait after the first failed login, doubling with every further one", false, func(c *Config) interface{} { return &c.Auth.LoginBackoff }},
+	{"auth.login_lockout", "LOGIN_LOCKOUT", "lockout once a threshold is reached, doubling with every further failure", false, func(c *Config) interface{} { return &c.Auth.LoginLockout }},
+	{"auth.ldap.url", "LDAP_URL", "ldap:// or ldaps:// URL of the directory", false, func(c *Config) interface{} { return &c.Auth.LDAP.URL }},
+	{"auth.ldap.start_tls", "LDAP_STARTTLS", "upgrade an ldap:// connection with StartTLS", false, func(c *Config) interface{} { return &c.Auth.LDAP.StartTLS }},
+	{"auth.ldap.ca_cert", "LDAP_CA_CERT", "PEM file with the CA of the directory's certificate", false, func(c *Config) interface{} { return &c.Auth.LDAP.CACert }},
+	{"auth.ldap.tls_insecure", "LDAP_TLS_INSECURE", "skip the certificate verification, only for testing", false, func(c *Config) interface{} { return &c.Auth.LDAP.TLSInsecure }},
+	{"auth.ldap.bind_dn", "LDAP_BIND_DN", "service account searching the users, anonymous if empty", false, func(c *Config) interface{} { return &c.Auth.LDAP.BindDN }},
+	{"auth.ldap.bind_password", "LDAP_BIND_PASSWORD", "password of the service account", true, func(c *Config) interface{} { return &c.Auth.LDAP.BindPassword }},
+	{"auth.ldap.base_dn", "LDAP_BASE_DN", "where users are searched", false, func(c *Config) interface{} { return &c.Auth.LDAP.BaseDN }},
+	{"auth.ldap.user_filter", "LDAP_USER_FILTER", "filter finding a user, %s is the username", false, func(c *Config) interface{} { return &c.Auth.LDAP.UserFilter }},
+	{"auth.ldap.group_attribute", "LDAP_GROUP_ATTRIBUTE", "user attribute listing the groups", false, func(c *Config) interface{} { return &c.Auth.LDAP.GroupAttribute }},
+	{"auth.ldap.group_base_dn", "LDAP_GROUP_BASE_DN", "where groups are searched, the base DN if empty", false, func(c *Config) interface{} { return &c.Auth.LDAP.GroupBaseDN }},
+	{"auth.ldap.group_filter", "LDAP_GROUP_FILTER", "filter finding the groups of a user instead, %s is the user's DN", false, func(c *Config) interface{} { return &c.Auth.LDAP.GroupFilter }},
+	{"auth.ldap.role_mapping", "LDAP_ROLE_MAPPING", "semicolon separated group=role pairs, groups by DN or CN", false, func(c *Config) interface{} { return &c.Auth.LDAP.RoleMapping }},
+	{"auth.ldap.default_role", "LDAP_DEFAULT_ROLE", "role of new users without a mapped group, none refuses them", false, func(c *Config) interface{} { return &c.Auth.LDAP.DefaultRole }},
+	{"auth.ldap.pool_size", "LDAP_POOL_SIZE", "idle directory connections kept open", false, func(c *Config) interface{} { return &c.Auth.LDAP.PoolSize }},
+	{"auth.ldap.timeout", "LDAP_TIMEOUT", "dial and request timeout of the directory", false, func(c *Config) interface{} { return &c.Auth.LDAP.Timeout }},
+	{"auth.oidc.issuer", "OIDC_ISSUER", "issuer URL of the OpenID Connect provider", false, func(c *Config) interface{} { return &c.Auth.OIDC.Issuer }},
+	{"auth.oidc.client_id", "OIDC_CLIENT_ID", "client ID registered at the provider", false, func(c *Config) interface{} { return &c.Auth.OIDC.ClientID }},
+	{"auth.oidc.client_secret", "OIDC_CLIENT_SECRET", "client secret, empty for public clients", true, func(c *Config) interface{} { return &c.Auth.OIDC.ClientSecret }},
+	{"auth.oidc.redirect_url", "OIDC_REDIRECT_URL", "URL of /api/v1/oidc/callback as registered at the provider", false, func(c *Config) interface{} { return &c.Auth.OIDC.RedirectURL }},
+	{"auth.oidc.scopes", "OIDC_SCOPES", "space separated scopes", false, func(c *Config) interface{} { return &c.Auth.OIDC.Scopes }},
+	{"auth.oidc.username_claim", "OIDC_USERNAME_CLAIM", "claim used as username", false, func(c *Config) interface{} { return &c.Auth.OIDC.UsernameClaim }},
+	{"auth.oidc.role_claim", "OIDC_ROLE_CLAIM", "claim holding the groups or roles", false, func(c *Config) interface{} { return &c.Auth.OIDC.RoleClaim }},
+	{"auth.oidc.role_mapping", "OIDC_ROLE_MAPPING", "comma separated claim=role pairs", false, func(c *Config) interface{} { return &c.Auth.OIDC.RoleMapping }},
+	{"auth.oidc.default_role", "OIDC_DEFAULT_ROLE", "role of new users without a mapped claim, none refuses them", false, func(c *Config) interface{} { return &c.Auth.OIDC.DefaultRole }},
+}
+
+/*
+Load reads the configuration from the defaults, the YAML file, the environment and the flags in
+args, in that order of precedence. The file is named by -config or GOGRAB_CONFIG, gograb.yaml is
+read if it exists. Every setting has a flag named after its YAML path, e.g. -database.host, and
+-addr is short for -server.addr; giving both is an error. A variable that is set but empty sets the
+empty value, e.g. DB_PASSWORD= for an account without password. The result is validated.
+*/
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("gograb", flag.ContinueOnError)
+	file := flags.String("config", "", "YAML configuration file (default $GOGRAB_CONFIG or "+DefaultFile+")")
+	values := make(map[string]*string)
+	for _, s := range settings {
+		values[s.key] = flags.String(s.key, "", s.usage+" (env "+s.env+")")
+	}
+	addr := flags.String("addr", "", "short for -server.addr")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if given["addr"] && given["server.addr"] {
+		return nil, errors.New("-addr and -server.addr are the same setting, give only one of them")
+	}
+
+	cfg := Default()
+	if err := cfg.readFile(*file); err != nil {
+		return nil, err
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("%s: %v", s.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if name == "addr" {
+			name, *values["server.addr"] = "server.addr", *addr
+		}
+		for _, s := range settings {
+			if s.key == name {
+				if err := s.set(cfg, *values[name]); err != nil && flagErr == nil {
+					flagErr = fmt.Errorf("-%s: %v", name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile overrides the settings with the ones of the YAML file. Unknown keys are an error, they are most likely typos.
+func (c *Config) readFile(path string) error {
+	required := true
+	if path == "" {
+		path = os.Getenv("GOGRAB_CONFIG")
+	}
+	if path == "" {
+		path, required = DefaultFile, false
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading the configuration: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading the configuration %s: %v", path, err)
+	}
+	return nil
+}
+
+func (s setting) set(c *Config, value string) error {
+	switch field := s.field(c).(type) {
+	case *string:
+		*field = value
+	case *time.Duration:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*field = duration
+	case *int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*field = number
+	case *bool:
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*field = flag
+	case *[]string:
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks that the settings are usable, reporting every problem at once.
+func (c *Config) Validate() error {
+	var problems []error
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		problems = append(problems, fmt.Errorf("server.addr: %q is not a host:port address", c.Server.Addr))
+	}
+	if swaggerURL, err := url.Parse(c.Server.SwaggerURL); err != nil || swaggerURL.Scheme == "" || swaggerURL.Host == "" {
+		problems = append(problems, fmt.Errorf("server.swagger_url: %q is not an absolute URL", c.Server.SwaggerURL))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, errors.New("server.shutdown_timeout: must be positive"))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := parseProxy(proxy); err != nil {
+			problems = append(problems, fmt.Errorf("server.trusted_proxies: %q is not an IP or CIDR range", proxy))
+		}
+	}
+	if _, _, err := net.SplitHostPort(c.Database.Host); err != nil {
+		problems = append(problems, fmt.Errorf("database.host: %q is not a host:port address", c.Database.Host))
+	}
+	if c.Database.User == "" {
+		problems = append(problems, errors.New("database.user: must be set"))
+	}
+	if c.Database.Name == "" {
+		problems = append(problems, errors.New("database.name: must be set"))
+	}
+	if _, err := url.ParseQuery(c.Database.Params); err != nil {
+		problems = append(problems, fmt.Errorf("database.params: %v", err))
+	}
+	if c.Crawler.Delay < 0 {
+		problems = append(problems, errors.New("crawler.delay: can't be negative"))
+	}
+	if c.Crawler.PageTimeout <= 0 {
+		problems = append(problems, errors.New("crawler.page_timeout: must be positive"))
+	}
+	if c.Crawler.CheckpointInterval < 0 {
+		problems = append(problems, errors.New("crawler.checkpoint_interval: can't be negative"))
+	}
+
+	positive := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"storage.trash_grace_period", c.Storage.TrashGracePeriod},
+		{"storage.archive_ttl", c.Storage.ArchiveTTL},
+		{"storage.janitor_interval", c.Storage.JanitorInterval},
+		{"auth.key_rotation_interval", c.Auth.KeyRotationInterval},
+		{"auth.access_token_ttl", c.Auth.AccessTokenTTL},
+		{"auth.refresh_token_ttl", c.Auth.RefreshTokenTTL},
+		{"auth.password_reset_ttl", c.Auth.PasswordResetTTL},
+		{"auth.login_failure_window", c.Auth.LoginFailureWindow},
+		{"auth.login_backoff", c.Auth.LoginBackoff},
+		{"auth.login_lockout", c.Auth.LoginLockout},
+		{"auth.ldap.timeout", c.Auth.LDAP.Timeout},
+	}
+	for _, setting := range positive {
+		if setting.value <= 0 {
+			problems = append(problems, fmt.Errorf("%s: must be positive", setting.key))
+		}
+	}
+	counts := []struct {
+		key   string
+		value int
+	}{
+		{"auth.password_min_length", c.Auth.PasswordMinLength},
+		{"auth.password_min_classes", c.Auth.PasswordMinClasses},
+		{"auth.login_account_threshold", c.Auth.LoginAccountThreshold},
+		{"auth.login_ip_threshold", c.Auth.LoginIPThreshold},
+		{"auth.ldap.pool_size", c.Auth.LDAP.PoolSize},
+	}
+	for _, setting := range counts {
+		if setting.value <= 0 {
+			problems = append(problems, fmt.Errorf("%s: must be positive", setting.key))
+		}
+	}
+
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "mysql" {
+		problems = append(problems, fmt.Errorf("rate_limit.store: %q is neither memory nor mysql", c.RateLimit.Store))
+	}
+	if len(c.Auth.Backends) == 0 {
+		problems = append(problems, errors.New("auth.backends: must name at least one backend"))
+	}
+	for _, backend := range c.Auth.Backends {
+		if backend != "local" && backend != "ldap" {
+			problems = append(problems, fmt.Errorf("auth.backends: unknown backend %q, use local or ldap", backend))
+		}
+	}
+	if c.Auth.Issuer == "" {
+		problems = append(problems, errors.New("auth.issuer: must be set"))
+	}
+	if c.Auth.Audience == "" {
+		problems = append(problems, errors.New("auth.audience: must be set"))
+	}
+
+	// the folders must differ, the janitor and the downloads treat every file in them as theirs
+	folders := map[string]string{}
+	for _, folder := range []struct{ key, path string }{
+		{"storage.data_folder", c.Storage.DataFolder},
+		{"storage.trash_folder", c.Storage.TrashFolder},
+		{"storage.archive_folder", c.Storage.ArchiveFolder},
+	} {
+		if folder.path == "" {
+			problems = append(problems, fmt.Errorf("%s: must be set", folder.key))
+			continue
+		}
+		clean := filepath.Clean(folder.path)
+		if other, ok := folders[clean]; ok {
+			problems = append(problems, fmt.Errorf("%s: same folder as %s", folder.key, other))
+		}
+		folders[clean] = folder.key
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with the secrets masked, for printing.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	for _, s := range settings {
+		if field, ok := s.field(&redacted).(*string); ok && s.secret && *field != "" {
+			*field = "REDACTED"
+		}
+	}
+	return &redacted
+}
+
+// String renders the configuration as YAML with the secrets masked, so it can be logged safely.
+func (c *Config) String() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return "invalid configuration: " + err.Error()
+	}
+	return strings.TrimSpace(string(out))
+}
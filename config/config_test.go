@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setDatabaseEnv configures the database settings that have no default and keeps the file of the working directory out.
+func setDatabaseEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("GOGRAB_CONFIG", filepath.Join(t.TempDir(), "empty.yaml"))
+	if err := os.WriteFile(os.Getenv("GOGRAB_CONFIG"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_HOST", "db:3306")
+	t.Setenv("DB_USER", "gograb")
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	setDatabaseEnv(t)
+	if err := os.WriteFile(os.Getenv("GOGRAB_CONFIG"), []byte("crawler:\n  delay: 5s\n  page_timeout: 2m\ndatabase:\n  password: from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CRAWL_PAGE_TIMEOUT", "3m")
+
+	cfg, err := Load([]string{"-crawler.delay", "2s"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Crawler.Delay != 2*time.Second || cfg.Crawler.PageTimeout != 3*time.Minute || cfg.Database.Password != "from-file" {
+		t.Errorf("got delay %s, timeout %s, password %q, want the flag, the variable and the file to win in that order", cfg.Crawler.Delay, cfg.Crawler.PageTimeout, cfg.Database.Password)
+	}
+}
+
+func TestLoadEmptyVariable(t *testing.T) {
+	setDatabaseEnv(t)
+	if err := os.WriteFile(os.Getenv("GOGRAB_CONFIG"), []byte("database:\n  password: from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_PASSWORD", "")
+
+	cfg, err := Load(nil)
+	if err != nil || cfg.Database.Password != "" {
+		t.Errorf("got password %q, %v, want the empty variable to override the file", cfg.Database.Password, err)
+	}
+}
+
+func TestLoadAddr(t *testing.T) {
+	setDatabaseEnv(t)
+	if cfg, err := Load([]string{"-addr", ":9090"}); err != nil || cfg.Server.Addr != ":9090" {
+		t.Errorf("got %v, want -addr to set server.addr", err)
+	}
+	if cfg, err := Load([]string{"-server.addr", ":9091"}); err != nil || cfg.Server.Addr != ":9091" {
+		t.Errorf("got %v, want -server.addr to set server.addr", err)
+	}
+	if _, err := Load([]string{"-server.addr", ":9091", "-addr", ":9090"}); err == nil {
+		t.Error("Load accepted -addr together with -server.addr")
+	}
+}
+
+func TestLoadRequiresDatabase(t *testing.T) {
+	setDatabaseEnv(t)
+	os.Unsetenv("DB_HOST")
+	os.Unsetenv("DB_USER")
+
+	_, err := Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "database.host") || !strings.Contains(err.Error(), "database.user") {
+		t.Errorf("got %v, want the missing database host and user reported", err)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	setDatabaseEnv(t)
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1,,::ffff:10.1.2.3")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var got []string
+	for _, prefix := range cfg.Server.TrustedProxyPrefixes() {
+		got = append(got, prefix.String())
+	}
+	if strings.Join(got, " ") != "10.0.0.0/8 192.0.2.1/32 10.1.2.3/32" {
+		t.Errorf("got %v, want the ranges and single IPs", got)
+	}
+
+	if _, err := Load([]string{"-server.trusted_proxies", "10.0.0.0/33,proxy"}); err == nil || !strings.Contains(err.Error(), `"proxy"`) {
+		t.Errorf("got %v, want the invalid entries reported", err)
+	}
+}
+
+func TestLoadAuth(t *testing.T) {
+	setDatabaseEnv(t)
+	if err := os.WriteFile(os.Getenv("GOGRAB_CONFIG"), []byte("auth:\n  backends: [ldap, local]\n  ldap:\n    pool_size: 3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOCAL_LOGIN_ENABLED", "false")
+
+	cfg, err := Load([]string{"-auth.ldap.pool_size", "8"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if strings.Join(cfg.Auth.Backends, ",") != "ldap,local" || cfg.Auth.LocalLogin || cfg.Auth.LDAP.PoolSize != 8 {
+		t.Errorf("got backends %v, local login %t, pool size %d, want ldap,local, false and 8", cfg.Auth.Backends, cfg.Auth.LocalLogin, cfg.Auth.LDAP.PoolSize)
+	}
+
+	t.Setenv("LOCAL_LOGIN_ENABLED", "maybe")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "LOCAL_LOGIN_ENABLED") {
+		t.Errorf("got %v, want the invalid boolean reported", err)
+	}
+}
+
+func TestValidateStorageAndRateLimit(t *testing.T) {
+	setDatabaseEnv(t)
+	t.Setenv("RATE_LIMIT_STORE", "redis")
+	t.Setenv("TRASH_GRACE_PERIOD", "0s")
+	t.Setenv("AUTH_BACKENDS", "local,kerberos")
+
+	_, err := Load(nil)
+	for _, key := range []string{"rate_limit.store", "storage.trash_grace_period", "auth.backends"} {
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("got %v, want %s reported", err, key)
+		}
+	}
+}
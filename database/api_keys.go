@@ -0,0 +1,64 @@
+package database
+
+import (
+	"GoGrab/models"
+
+	"gorm.io/gorm"
+)
+
+func CreateAPIKey(key *models.APIKey) error {
+	// the insert and LAST_INSERT_ID() have to run on the same connection, hence the transaction
+	return DB.Transaction(func(tx *gorm.DB) error {
+		query := "INSERT INTO APIKeys (UserID, Name, Prefix, KeyHash, Scopes, ExpiresAt) VALUES (?, ?, ?, ?, ?, ?)"
+		result := tx.Exec(query, key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Raw("SELECT ID, CreatedAt FROM APIKeys WHERE ID = LAST_INSERT_ID()").Scan(key).Error
+	})
+}
+
+// GetAPIKeyByPrefix returns the API key with the given prefix, or nil if there is none.
+func GetAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	var keys []models.APIKey
+	query := "SELECT * FROM APIKeys WHERE Prefix = ?"
+	result := DB.Raw(query, prefix).Scan(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return &keys[0], nil
+}
+
+// GetUserAPIKeys returns the API keys of a user that haven't been revoked, newest first.
+func GetUserAPIKeys(userID int) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	query := "SELECT * FROM APIKeys WHERE UserID = ? AND RevokedAt IS NULL ORDER BY CreatedAt DESC"
+	result := DB.Raw(query, userID).Scan(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return keys, nil
+}
+
+// TouchAPIKey updates the last used timestamp, at most once a minute to keep writes down.
+func TouchAPIKey(id int) error {
+	query := "UPDATE APIKeys SET LastUsedAt = NOW() WHERE ID = ? AND (LastUsedAt IS NULL OR LastUsedAt < NOW() - INTERVAL 1 MINUTE)"
+	result := DB.Exec(query, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// RevokeAPIKey revokes an API key of a user. It returns false if the user has no such active key.
+func RevokeAPIKey(userID, id int) (bool, error) {
+	query := "UPDATE APIKeys SET RevokedAt = NOW() WHERE ID = ? AND UserID = ? AND RevokedAt IS NULL"
+	result := DB.Exec(query, id, userID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"GoGrab/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditFilter selects audit events, empty fields don't restrict the selection.
+type AuditFilter struct {
+	Action    string
+	ActorID   int
+	IP        string
+	RequestID string
+	Target    string
+	Outcome   string
+	Since     time.Time
+	Until     time.Time
+	UntilID   int64 // the last event ID to select, 0 for all
+	Limit     int
+	Offset    int
+}
+
+/*
+AppendAuditEvent appends an event to the hash chain. The chain head is locked for the transaction,
+so concurrent appends, also from other instances, are chained one after the other. hash is called
+with PrevHash set and has to return the hash of the event.
+*/
+func AppendAuditEvent(event *models.AuditEvent, hash func(*models.AuditEvent) string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var heads []string
+		if result := tx.Raw("SELECT LastHash FROM AuditChain WHERE ID = 1 FOR UPDATE").Scan(&heads); result.Error != nil {
+			return result.Error
+		}
+		if len(heads) > 0 {
+			event.PrevHash = heads[0]
+		}
+		event.Hash = hash(event)
+
+		query := "INSERT INTO AuditEvents (Action, ActorID, IP, RequestID, Target, Outcome, Details, PrevHash, Hash, CreatedAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		result := tx.Exec(query, event.Action, event.ActorID, event.IP, event.RequestID, event.Target, event.Outcome, event.Details, event.PrevHash, event.Hash, event.CreatedAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result := tx.Raw("SELECT LAST_INSERT_ID()").Scan(&event.ID); result.Error != nil {
+			return result.Error
+		}
+		query = "INSERT INTO AuditChain (ID, LastEventID, LastHash) VALUES (1, ?, ?) ON DUPLICATE KEY UPDATE LastEventID = VALUES(LastEventID), LastHash = VALUES(LastHash)"
+		return tx.Exec(query, event.ID, event.Hash).Error
+	})
+}
+
+// SearchAuditEvents returns the audit events matching the filter, newest first, and the total number of matching events.
+func SearchAuditEvents(filter AuditFilter) ([]models.AuditEvent, int64, error) {
+	where, args := auditWhere(filter)
+
+	var total int64
+	result := DB.Raw("SELECT COUNT(*) FROM AuditEvents "+where, args...).Scan(&total)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	events := []models.AuditEvent{}
+	query := "SELECT * FROM AuditEvents " + where + " ORDER BY ID DESC LIMIT ? OFFSET ?"
+	result = DB.Raw(query, append(args, filter.Limit, filter.Offset)...).Scan(&events)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return events, total, nil
+}
+
+// EachAuditEvent calls fn for every audit event matching the filter, oldest first, without loading them all at once.
+// Limit and Offset are ignored. It stops at the first error of fn and returns it.
+func EachAuditEvent(filter AuditFilter, fn func(models.AuditEvent) error) error {
+	where, args := auditWhere(filter)
+	rows, err := DB.Raw("SELECT * FROM AuditEvents "+where+" ORDER BY ID", args...).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := DB.ScanRows(rows, &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetAuditChainHead returns the ID and hash of the last event appended to the chain.
+func GetAuditChainHead() (int64, string, error) {
+	var heads []struct {
+		LastEventID int64
+		LastHash    string
+	}
+	result := DB.Raw("SELECT LastEventID, LastHash FROM AuditChain WHERE ID = 1").Scan(&heads)
+	if result.Error != nil || len(heads) == 0 {
+		return 0, "", result.Error
+	}
+	return heads[0].LastEventID, heads[0].LastHash, nil
+}
+
+func auditWhere(filter AuditFilter) (string, []interface{}) {
+	where := "WHERE 1 = 1"
+	var args []interface{}
+	if filter.Action != "" {
+		where += " AND Action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.ActorID != 0 {
+		where += " AND ActorID = ?"
+		args = append(args, filter.ActorID)
+	}
+	if filter.IP != "" {
+		where += " AND IP = ?"
+		args = append(args, filter.IP)
+	}
+	if filter.RequestID != "" {
+		where += " AND RequestID = ?"
+		args = append(args, filter.RequestID)
+	}
+	if filter.Target != "" {
+		where += " AND Target LIKE ?"
+		args = append(args, "%"+escapeLike(filter.Target)+"%")
+	}
+	if filter.Outcome != "" {
+		where += " AND Outcome = ?"
+		args = append(args, filter.Outcome)
+	}
+	if !filter.Since.IsZero() {
+		where += " AND CreatedAt >= ?"
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where += " AND CreatedAt < ?"
+		args = append(args, filter.Until)
+	}
+	if filter.UntilID != 0 {
+		where += " AND ID <= ?"
+		args = append(args, filter.UntilID)
+	}
+	return where, args
+}
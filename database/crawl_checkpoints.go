@@ -0,0 +1,155 @@
+package database
+
+import (
+	"GoGrab/models"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrCrawlJobNotResumable is returned when a job to resume doesn't exist, is finished or still runs.
+var ErrCrawlJobNotResumable = errors.New("crawl job can't be resumed")
+
+// SaveCrawlCheckpoint saves the checkpoint of a running job, replacing the one before.
+func SaveCrawlCheckpoint(checkpoint models.CrawlCheckpoint) error {
+	return saveCrawlCheckpoint(DB, checkpoint)
+}
+
+/*
+InterruptCrawlJob saves the checkpoint of a job and marks the job as interrupted, together so a
+job is never interrupted without the state to resume it from.
+*/
+func InterruptCrawlJob(checkpoint models.CrawlCheckpoint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveCrawlCheckpoint(tx, checkpoint); err != nil {
+			return err
+		}
+		query := "UPDATE CrawlJobs SET Status = ?, UpdatedAt = NOW() WHERE ID = ?"
+		return tx.Exec(query, models.CrawlJobInterrupted, checkpoint.JobID).Error
+	})
+}
+
+func saveCrawlCheckpoint(db *gorm.DB, checkpoint models.CrawlCheckpoint) error {
+	toVisit, err := json.Marshal(checkpoint.ToVisit)
+	if err != nil {
+		return err
+	}
+	visited, err := json.Marshal(checkpoint.Visited)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO CrawlCheckpoints (JobID, ToVisit, Visited) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE ToVisit = VALUES(ToVisit), Visited = VALUES(Visited), UpdatedAt = NOW()`
+	return db.Exec(query, checkpoint.JobID, string(toVisit), string(visited)).Error
+}
+
+// GetCrawlCheckpoint returns the checkpoint of a job, or nil if there is none.
+func GetCrawlCheckpoint(jobID string) (*models.CrawlCheckpoint, error) {
+	var rows []struct {
+		JobID     string
+		ToVisit   string
+		Visited   string
+		UpdatedAt time.Time
+	}
+	result := DB.Raw("SELECT * FROM CrawlCheckpoints WHERE JobID = ?", jobID).Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	checkpoint := &models.CrawlCheckpoint{JobID: rows[0].JobID, UpdatedAt: rows[0].UpdatedAt}
+	if err := json.Unmarshal([]byte(rows[0].ToVisit), &checkpoint.ToVisit); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(rows[0].Visited), &checkpoint.Visited); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func DeleteCrawlCheckpoint(jobID string) error {
+	return DB.Exec("DELETE FROM CrawlCheckpoints WHERE JobID = ?", jobID).Error
+}
+
+// GetCrawlJobsByStatus returns the jobs with the status, oldest first.
+func GetCrawlJobsByStatus(status string) ([]models.CrawlJob, error) {
+	var jobs []models.CrawlJob
+	result := DB.Raw("SELECT * FROM CrawlJobs WHERE Status = ? ORDER BY StartedAt", status).Scan(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobs, nil
+}
+
+// GetCrawlJob returns the job with the ID, or nil if there is none.
+func GetCrawlJob(jobID string) (*models.CrawlJob, error) {
+	var jobs []models.CrawlJob
+	result := DB.Raw("SELECT * FROM CrawlJobs WHERE ID = ?", jobID).Scan(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return &jobs[0], nil
+}
+
+/*
+ResumeCrawlJob marks a job as running again: an interrupted one, one the quota stopped, or a running
+one that hasn't been updated since staleAfter because its server crashed. Like StartCrawlJob it
+doesn't if the user already runs maxConcurrent jobs (0 for no limit). Only one caller can resume a
+job, the others get ErrCrawlJobNotResumable, so several instances starting at once don't crawl it twice.
+*/
+func ResumeCrawlJob(job *models.CrawlJob, maxConcurrent int, staleAfter time.Time) (bool, error) {
+	resumed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var ids []int
+		if result := tx.Raw("SELECT ID FROM Users WHERE ID = ? FOR UPDATE", job.UserID).Scan(&ids); result.Error != nil {
+			return result.Error
+		}
+		var jobs []struct {
+			Status string
+			Stale  bool
+		}
+		query := "SELECT Status, UpdatedAt < ? AS Stale FROM CrawlJobs WHERE ID = ? AND UserID = ? FOR UPDATE"
+		if result := tx.Raw(query, staleAfter, job.ID, job.UserID).Scan(&jobs); result.Error != nil {
+			return result.Error
+		}
+		if len(jobs) == 0 || !resumable(jobs[0].Status, jobs[0].Stale) {
+			return ErrCrawlJobNotResumable
+		}
+		if maxConcurrent > 0 {
+			var running int64
+			query := "SELECT COUNT(*) FROM CrawlJobs WHERE UserID = ? AND Status = ? AND UpdatedAt >= ?"
+			if result := tx.Raw(query, job.UserID, models.CrawlJobRunning, staleAfter).Scan(&running); result.Error != nil {
+				return result.Error
+			}
+			if running >= int64(maxConcurrent) {
+				return nil
+			}
+		}
+
+		job.Status = models.CrawlJobRunning
+		query = "UPDATE CrawlJobs SET Status = ?, UpdatedAt = NOW(), FinishedAt = NULL WHERE ID = ?"
+		if result := tx.Exec(query, job.Status, job.ID); result.Error != nil {
+			return result.Error
+		}
+		resumed = true
+		return nil
+	})
+	return resumed, err
+}
+
+func resumable(status string, stale bool) bool {
+	switch status {
+	case models.CrawlJobInterrupted, models.CrawlJobStopped:
+		return true
+	case models.CrawlJobRunning:
+		return stale
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"GoGrab/models"
+	"time"
+)
+
+/*
+AddLoginFailure counts a failed login of an account or IP and returns the updated record.
+Failures older than window don't count anymore, the counter starts over from one.
+*/
+func AddLoginFailure(kind, subject string, window time.Duration) (*models.LoginFailure, error) {
+	// Failures is assigned first, so it still sees the previous LastFailureAt
+	query := `INSERT INTO LoginFailures (Kind, Subject, Failures, LastFailureAt) VALUES (?, ?, 1, NOW())
+		ON DUPLICATE KEY UPDATE
+			Failures = IF(LastFailureAt < NOW() - INTERVAL ? SECOND, 1, Failures + 1),
+			LastFailureAt = NOW()`
+	result := DB.Exec(query, kind, subject, int(window.Seconds()))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	failure, err := GetLoginFailure(kind, subject)
+	if err != nil {
+		return nil, err
+	}
+	if failure == nil {
+		return &models.LoginFailure{Kind: kind, Subject: subject, Failures: 1, LastFailureAt: time.Now()}, nil
+	}
+	return failure, nil
+}
+
+// GetLoginFailure returns the failure record of an account or IP, or nil if there is none.
+func GetLoginFailure(kind, subject string) (*models.LoginFailure, error) {
+	var failures []models.LoginFailure
+	query := "SELECT * FROM LoginFailures WHERE Kind = ? AND Subject = ?"
+	result := DB.Raw(query, kind, subject).Scan(&failures)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(failures) == 0 {
+		return nil, nil
+	}
+	return &failures[0], nil
+}
+
+func SetLoginLockout(kind, subject string, lockedUntil time.Time) error {
+	query := "UPDATE LoginFailures SET LockedUntil = ? WHERE Kind = ? AND Subject = ?"
+	result := DB.Exec(query, lockedUntil, kind, subject)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetActiveLoginLockouts returns the accounts and IPs that are currently locked out.
+func GetActiveLoginLockouts() ([]models.LoginFailure, error) {
+	var failures []models.LoginFailure
+	query := "SELECT * FROM LoginFailures WHERE LockedUntil > NOW() ORDER BY LockedUntil DESC"
+	result := DB.Raw(query).Scan(&failures)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return failures, nil
+}
+
+// ClearLoginFailures forgets the failed logins of an account or IP, lifting a lockout.
+func ClearLoginFailures(kind, subject string) (bool, error) {
+	query := "DELETE FROM LoginFailures WHERE Kind = ? AND Subject = ?"
+	result := DB.Exec(query, kind, subject)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migration.sql
+var migrationSQL string
+
+/*
+Migrate runs migration.sql against the connected database and returns the number of statements executed.
+Every statement is idempotent, so it is safe to run on an existing database; it creates missing
+tables, events and built-in roles and adds the columns that tables created by an older version lack.
+The statements run on a single connection, the column checks keep their ALTER TABLE in a session variable.
+*/
+func Migrate() (int, error) {
+	executed := 0
+	err := DB.Connection(func(conn *gorm.DB) error {
+		for _, statement := range migrationStatements() {
+			if result := conn.Exec(statement); result.Error != nil {
+				return fmt.Errorf("error running %q: %v", firstLine(statement), result.Error)
+			}
+			executed++
+		}
+		return nil
+	})
+	return executed, err
+}
+
+// migrationStatements splits migration.sql into its statements.
+func migrationStatements() []string {
+	return splitStatements(migrationSQL)
+}
+
+/*
+splitStatements splits a SQL script into statements, dropping comment lines and blank lines.
+A statement ends with a line that ends with the delimiter, ";" until a "DELIMITER" line sets
+another one, as in the mysql client, so a semicolon inside a line or inside an event body
+written between "DELIMITER $$" and "DELIMITER ;" doesn't end it.
+*/
+func splitStatements(script string) []string {
+	delimiter := ";"
+	var statements []string
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		if fields := strings.Fields(trimmed); len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER") {
+			delimiter = fields[1]
+			continue
+		}
+
+		if !strings.HasSuffix(trimmed, delimiter) {
+			lines = append(lines, line)
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(strings.TrimRight(line, " \t\r"), delimiter))
+		if statement := strings.TrimSpace(strings.Join(lines, "\n")); statement != "" {
+			statements = append(statements, statement)
+		}
+		lines = nil
+	}
+	// the last statement doesn't need a delimiter
+	if statement := strings.TrimSpace(strings.Join(lines, "\n")); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+func firstLine(statement string) string {
+	line, _, _ := strings.Cut(statement, "\n")
+	return line
+}
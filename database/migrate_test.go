@@ -0,0 +1,49 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- a comment; not a statement
+CREATE TABLE Things (
+    Name VARCHAR(10) NOT NULL DEFAULT "a;b"
+);
+
+SET @migration = IF(TRUE, "DO 0", "DO 1"); 
+DELIMITER $$
+CREATE EVENT IF NOT EXISTS cleanup
+ON SCHEDULE EVERY 1 HOUR
+DO
+BEGIN
+    DELETE FROM Things WHERE Name = "";
+    DELETE FROM Others;
+END$$
+DELIMITER ;
+SELECT 1`
+
+	want := []string{
+		"CREATE TABLE Things (\n    Name VARCHAR(10) NOT NULL DEFAULT \"a;b\"\n)",
+		`SET @migration = IF(TRUE, "DO 0", "DO 1")`,
+		"CREATE EVENT IF NOT EXISTS cleanup\nON SCHEDULE EVERY 1 HOUR\nDO\nBEGIN\n    DELETE FROM Things WHERE Name = \"\";\n    DELETE FROM Others;\nEND",
+		"SELECT 1",
+	}
+	if got := splitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMigrationStatements(t *testing.T) {
+	statements := migrationStatements()
+	// update the count together with migration.sql, a different number means a statement was split or merged
+	if len(statements) != 78 {
+		t.Errorf("got %d statements, want 78", len(statements))
+	}
+	for _, statement := range statements {
+		if strings.HasSuffix(statement, ";") || strings.Contains(statement, "\nDELIMITER") || strings.HasPrefix(statement, "--") {
+			t.Errorf("statement wasn't split off cleanly: %q", firstLine(statement))
+		}
+	}
+}
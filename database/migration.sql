@@ -1,19 +1,393 @@
+-- Every statement ends with a ";" at the end of a line. Statements with a line ending in ";" inside,
+-- like an event body between BEGIN and END, go between "DELIMITER $$" and "DELIMITER ;" and end with "$$".
 
 CREATE TABLE IF NOT EXISTS Users (
     ID INT AUTO_INCREMENT PRIMARY KEY,
     Username VARCHAR(255) UNIQUE NOT NULL,
     Password VARCHAR(255) NOT NULL,
     Role VARCHAR(50) NOT NULL DEFAULT "user",
-    Token VARCHAR(512),
-    token_expires_at TIMESTAMP,
+    AuthSource VARCHAR(16) NOT NULL DEFAULT "local",
+    LockedAt TIMESTAMP NULL,
+    MustChangePassword BOOLEAN NOT NULL DEFAULT FALSE,
+    TOTPSecret VARCHAR(64) NOT NULL DEFAULT "",
+    TOTPEnabled BOOLEAN NOT NULL DEFAULT FALSE,
+    TOTPLastStep BIGINT NOT NULL DEFAULT 0,
     CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- columns added to Users after it was first created, each ALTER TABLE only runs when the column is missing
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "Users" AND COLUMN_NAME = "LockedAt"),
+    "DO 0", "ALTER TABLE Users ADD COLUMN LockedAt TIMESTAMP NULL");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
 
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "Users" AND COLUMN_NAME = "MustChangePassword"),
+    "DO 0", "ALTER TABLE Users ADD COLUMN MustChangePassword BOOLEAN NOT NULL DEFAULT FALSE");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
 
-CREATE EVENT IF NOT EXISTS delete_expired_tokens
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "Users" AND COLUMN_NAME = "TOTPSecret"),
+    "DO 0", "ALTER TABLE Users ADD COLUMN TOTPSecret VARCHAR(64) NOT NULL DEFAULT ''");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "Users" AND COLUMN_NAME = "TOTPEnabled"),
+    "DO 0", "ALTER TABLE Users ADD COLUMN TOTPEnabled BOOLEAN NOT NULL DEFAULT FALSE");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "Users" AND COLUMN_NAME = "TOTPLastStep"),
+    "DO 0", "ALTER TABLE Users ADD COLUMN TOTPLastStep BIGINT NOT NULL DEFAULT 0");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "Users" AND COLUMN_NAME = "AuthSource"),
+    "DO 0", "ALTER TABLE Users ADD COLUMN AuthSource VARCHAR(16) NOT NULL DEFAULT 'local'");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+-- the event of the old single user token deleted every user whose token had expired
+DROP EVENT IF EXISTS delete_expired_tokens;
+
+
+CREATE TABLE IF NOT EXISTS Sessions (
+    ID VARCHAR(32) PRIMARY KEY,
+    UserID INT NOT NULL,
+    TokenHash CHAR(64) NOT NULL,
+    UserAgent VARCHAR(512) NOT NULL DEFAULT "",
+    IP VARCHAR(45) NOT NULL DEFAULT "",
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    LastSeenAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ExpiresAt TIMESTAMP NOT NULL,
+    RevokedAt TIMESTAMP NULL,
+    INDEX (UserID),
+    FOREIGN KEY (UserID) REFERENCES Users(ID) ON DELETE CASCADE
+);
+
+CREATE EVENT IF NOT EXISTS delete_expired_sessions
+ON SCHEDULE EVERY 1 HOUR
+DO
+DELETE FROM Sessions WHERE ExpiresAt < NOW();
+
+
+CREATE TABLE IF NOT EXISTS RetentionPolicies (
+    ID INT AUTO_INCREMENT PRIMARY KEY,
+    Scope VARCHAR(10) NOT NULL,
+    Target VARCHAR(255) NOT NULL,
+    MaxAgeDays INT NOT NULL DEFAULT 0,
+    KeepLast INT NOT NULL DEFAULT 0,
+    CreatedBy INT NOT NULL DEFAULT 0,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS RefreshTokens (
+    ID INT AUTO_INCREMENT PRIMARY KEY,
+    UserID INT NOT NULL,
+    FamilyID VARCHAR(32) NOT NULL,
+    TokenHash CHAR(64) UNIQUE NOT NULL,
+    ExpiresAt TIMESTAMP NOT NULL,
+    UsedAt TIMESTAMP NULL,
+    RevokedAt TIMESTAMP NULL,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX (FamilyID),
+    FOREIGN KEY (UserID) REFERENCES Users(ID) ON DELETE CASCADE
+);
+
+CREATE EVENT IF NOT EXISTS delete_expired_refresh_tokens
+ON SCHEDULE EVERY 1 HOUR
+DO
+DELETE FROM RefreshTokens WHERE ExpiresAt < NOW();
+
+
+CREATE TABLE IF NOT EXISTS APIKeys (
+    ID INT AUTO_INCREMENT PRIMARY KEY,
+    UserID INT NOT NULL,
+    Name VARCHAR(255) NOT NULL,
+    Prefix VARCHAR(16) UNIQUE NOT NULL,
+    KeyHash CHAR(64) NOT NULL,
+    Scopes VARCHAR(255) NOT NULL,
+    ExpiresAt TIMESTAMP NULL,
+    LastUsedAt TIMESTAMP NULL,
+    RevokedAt TIMESTAMP NULL,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (UserID) REFERENCES Users(ID) ON DELETE CASCADE
+);
+
+
+CREATE TABLE IF NOT EXISTS Roles (
+    Name VARCHAR(50) PRIMARY KEY,
+    Description VARCHAR(255) NOT NULL DEFAULT "",
+    Parent VARCHAR(50) NOT NULL DEFAULT "",
+    Require2FA BOOLEAN NOT NULL DEFAULT FALSE,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "Roles" AND COLUMN_NAME = "Require2FA"),
+    "DO 0", "ALTER TABLE Roles ADD COLUMN Require2FA BOOLEAN NOT NULL DEFAULT FALSE");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+CREATE TABLE IF NOT EXISTS RolePermissions (
+    Role VARCHAR(50) NOT NULL,
+    Permission VARCHAR(100) NOT NULL,
+    PRIMARY KEY (Role, Permission),
+    FOREIGN KEY (Role) REFERENCES Roles(Name) ON DELETE CASCADE
+);
+
+-- built-in roles, every role inherits the permissions of its parent
+INSERT IGNORE INTO Roles (Name, Description, Parent) VALUES
+    ("viewer", "Can read the scraped data", ""),
+    ("user", "Can crawl and delete the pages they crawled", "viewer"),
+    ("admin", "Can manage all data, users and roles", "user");
+
+INSERT IGNORE INTO RolePermissions (Role, Permission) VALUES
+    ("viewer", "data:read"),
+    ("user", "crawl:create"),
+    ("user", "data:delete"),
+    ("admin", "data:delete:any"),
+    ("admin", "trash:manage"),
+    ("admin", "retention:manage"),
+    ("admin", "users:manage"),
+    ("admin", "roles:manage"),
+    ("admin", "data:read:any"),
+    ("admin", "orgs:manage"),
+    ("admin", "audit:read"),
+    ("admin", "usage:read");
+
+CREATE TABLE IF NOT EXISTS LoginFailures (
+    Kind VARCHAR(10) NOT NULL,
+    Subject VARCHAR(255) NOT NULL,
+    Failures INT NOT NULL DEFAULT 0,
+    LastFailureAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    LockedUntil TIMESTAMP NULL,
+    PRIMARY KEY (Kind, Subject)
+);
+
+CREATE EVENT IF NOT EXISTS delete_stale_login_failures
+ON SCHEDULE EVERY 1 HOUR
+DO
+DELETE FROM LoginFailures WHERE LastFailureAt < NOW() - INTERVAL 1 DAY AND (LockedUntil IS NULL OR LockedUntil < NOW());
+
+
+-- the audit trail is append-only, every event carries the hash of the event before it
+CREATE TABLE IF NOT EXISTS AuditEvents (
+    ID BIGINT AUTO_INCREMENT PRIMARY KEY,
+    Action VARCHAR(50) NOT NULL,
+    ActorID INT NOT NULL DEFAULT 0,
+    IP VARCHAR(45) NOT NULL DEFAULT "",
+    RequestID VARCHAR(64) NOT NULL DEFAULT "",
+    Target VARCHAR(255) NOT NULL DEFAULT "",
+    Outcome VARCHAR(20) NOT NULL DEFAULT "",
+    Details VARCHAR(1024) NOT NULL DEFAULT "",
+    PrevHash CHAR(64) NOT NULL DEFAULT "",
+    Hash CHAR(64) NOT NULL DEFAULT "",
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX (Action),
+    INDEX (ActorID),
+    INDEX (RequestID),
+    INDEX (CreatedAt)
+);
+
+-- columns of the hash chain, events recorded before it existed stay unchained
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "AuditEvents" AND COLUMN_NAME = "RequestID"),
+    "DO 0", "ALTER TABLE AuditEvents ADD COLUMN RequestID VARCHAR(64) NOT NULL DEFAULT '', ADD INDEX (RequestID)");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "AuditEvents" AND COLUMN_NAME = "PrevHash"),
+    "DO 0", "ALTER TABLE AuditEvents ADD COLUMN PrevHash CHAR(64) NOT NULL DEFAULT ''");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+SET @migration = IF(EXISTS(SELECT * FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = "AuditEvents" AND COLUMN_NAME = "Hash"),
+    "DO 0", "ALTER TABLE AuditEvents ADD COLUMN Hash CHAR(64) NOT NULL DEFAULT ''");
+PREPARE migration FROM @migration;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update
+BEFORE UPDATE ON AuditEvents
+FOR EACH ROW
+SIGNAL SQLSTATE "45000" SET MESSAGE_TEXT = "AuditEvents is append-only";
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete
+BEFORE DELETE ON AuditEvents
+FOR EACH ROW
+SIGNAL SQLSTATE "45000" SET MESSAGE_TEXT = "AuditEvents is append-only";
+
+-- the head of the hash chain, locked while an event is appended so the chain stays linear
+CREATE TABLE IF NOT EXISTS AuditChain (
+    ID TINYINT PRIMARY KEY,
+    LastEventID BIGINT NOT NULL DEFAULT 0,
+    LastHash CHAR(64) NOT NULL DEFAULT ""
+);
+
+INSERT IGNORE INTO AuditChain (ID) VALUES (1);
+
+
+CREATE TABLE IF NOT EXISTS PasswordResetTokens (
+    ID INT AUTO_INCREMENT PRIMARY KEY,
+    UserID INT NOT NULL,
+    TokenHash CHAR(64) UNIQUE NOT NULL,
+    CreatedBy INT NOT NULL DEFAULT 0,
+    ExpiresAt TIMESTAMP NOT NULL,
+    UsedAt TIMESTAMP NULL,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (UserID) REFERENCES Users(ID) ON DELETE CASCADE
+);
+
+CREATE EVENT IF NOT EXISTS delete_expired_password_reset_tokens
 ON SCHEDULE EVERY 1 HOUR
 DO
-DELETE FROM Users WHERE token_expires_at < NOW();
+DELETE FROM PasswordResetTokens WHERE ExpiresAt < NOW();
 
 
+CREATE TABLE IF NOT EXISTS RecoveryCodes (
+    ID INT AUTO_INCREMENT PRIMARY KEY,
+    UserID INT NOT NULL,
+    CodeHash CHAR(64) NOT NULL,
+    UsedAt TIMESTAMP NULL,
+    INDEX (UserID, CodeHash),
+    FOREIGN KEY (UserID) REFERENCES Users(ID) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS LoginChallenges (
+    ID INT AUTO_INCREMENT PRIMARY KEY,
+    UserID INT NOT NULL,
+    TokenHash CHAR(64) UNIQUE NOT NULL,
+    Purpose VARCHAR(10) NOT NULL,
+    Attempts INT NOT NULL DEFAULT 0,
+    ExpiresAt TIMESTAMP NOT NULL,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (UserID) REFERENCES Users(ID) ON DELETE CASCADE
+);
+
+CREATE EVENT IF NOT EXISTS delete_expired_login_challenges
+ON SCHEDULE EVERY 1 HOUR
+DO
+DELETE FROM LoginChallenges WHERE ExpiresAt < NOW();
+
+
+CREATE TABLE IF NOT EXISTS OIDCStates (
+    StateHash CHAR(64) PRIMARY KEY,
+    Nonce VARCHAR(64) NOT NULL,
+    CodeVerifier VARCHAR(128) NOT NULL,
+    ExpiresAt TIMESTAMP NOT NULL
+);
+
+CREATE EVENT IF NOT EXISTS delete_expired_oidc_states
+ON SCHEDULE EVERY 1 HOUR
+DO
+DELETE FROM OIDCStates WHERE ExpiresAt < NOW();
+
+CREATE TABLE IF NOT EXISTS UserIdentities (
+    ID INT AUTO_INCREMENT PRIMARY KEY,
+    UserID INT NOT NULL,
+    Issuer VARCHAR(255) NOT NULL,
+    Subject VARCHAR(255) NOT NULL,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (Issuer, Subject),
+    FOREIGN KEY (UserID) REFERENCES Users(ID) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS SigningKeys (
+    KID VARCHAR(64) PRIMARY KEY,
+    Algorithm VARCHAR(16) NOT NULL,
+    PrivateKey TEXT NOT NULL,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    RetiredAt TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS Organizations (
+    ID INT AUTO_INCREMENT PRIMARY KEY,
+    Name VARCHAR(100) UNIQUE NOT NULL,
+    CreatedBy INT NOT NULL,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS OrganizationMembers (
+    OrganizationID INT NOT NULL,
+    UserID INT NOT NULL,
+    Role VARCHAR(16) NOT NULL,
+    CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (OrganizationID, UserID),
+    FOREIGN KEY (OrganizationID) REFERENCES Organizations(ID) ON DELETE CASCADE,
+    FOREIGN KEY (UserID) REFERENCES Users(ID) ON DELETE CASCADE
+);
+
+
+-- crawl jobs, running jobs count towards the concurrent jobs quota until they stop updating
+CREATE TABLE IF NOT EXISTS CrawlJobs (
+    ID VARCHAR(32) PRIMARY KEY,
+    UserID INT NOT NULL,
+    OrganizationID INT NOT NULL DEFAULT 0,
+    Status VARCHAR(16) NOT NULL,
+    StartedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UpdatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FinishedAt TIMESTAMP NULL,
+    INDEX (UserID, Status)
+);
+
+-- frontier and visited set of interrupted crawl jobs as JSON arrays, removed with the job
+CREATE TABLE IF NOT EXISTS CrawlCheckpoints (
+    JobID VARCHAR(32) PRIMARY KEY,
+    ToVisit LONGTEXT NOT NULL,
+    Visited LONGTEXT NOT NULL,
+    UpdatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (JobID) REFERENCES CrawlJobs(ID) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS Quotas (
+    Scope VARCHAR(10) NOT NULL,
+    Target VARCHAR(255) NOT NULL,
+    MaxConcurrentJobs INT NOT NULL DEFAULT 0,
+    MaxPagesPerDay INT NOT NULL DEFAULT 0,
+    MaxStoredBytes BIGINT NOT NULL DEFAULT 0,
+    MaxBrowserMinutes INT NOT NULL DEFAULT 0,
+    UpdatedBy INT NOT NULL DEFAULT 0,
+    UpdatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (Scope, Target)
+);
+
+-- users crawl two jobs at a time, 5000 pages a day, 1 GiB and 600 browser minutes a month by default
+INSERT IGNORE INTO Quotas (Scope, Target, MaxConcurrentJobs, MaxPagesPerDay, MaxStoredBytes, MaxBrowserMinutes) VALUES
+    ("role", "user", 2, 5000, 1073741824, 600);
+
+-- usage per user and UTC day, summed up for the usage report and the monthly export
+CREATE TABLE IF NOT EXISTS UsageCounters (
+    UserID INT NOT NULL,
+    Day DATE NOT NULL,
+    Jobs INT NOT NULL DEFAULT 0,
+    Pages INT NOT NULL DEFAULT 0,
+    BytesWritten BIGINT NOT NULL DEFAULT 0,
+    BrowserSeconds BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (UserID, Day)
+);
+
+-- bytes the stored pages of each user take up, kept up to date by the storage and recounted by the janitor
+CREATE TABLE IF NOT EXISTS StoredBytes (
+    UserID INT NOT NULL PRIMARY KEY,
+    Bytes BIGINT NOT NULL DEFAULT 0
+);
+
+
+-- token buckets of the rate limiter with RATE_LIMIT_STORE=mysql, untouched buckets are full again long before a day
+CREATE TABLE IF NOT EXISTS RateLimitBuckets (
+    BucketKey VARCHAR(255) PRIMARY KEY,
+    Tokens DOUBLE NOT NULL,
+    UpdatedAt TIMESTAMP(6) NOT NULL
+);
+
+CREATE EVENT IF NOT EXISTS delete_stale_rate_limit_buckets
+ON SCHEDULE EVERY 1 HOUR
+DO
+DELETE FROM RateLimitBuckets WHERE UpdatedAt < NOW() - INTERVAL 1 DAY;
@@ -1,9 +1,10 @@
 package database
 
 import (
+	"GoGrab/config"
 	"GoGrab/models"
 	"log"
-	"time"
+	"strings"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -11,12 +12,11 @@ import (
 
 var DB *gorm.DB
 
-func Connect() (*gorm.DB, error) {
-	log.Println("Connecting to MySQL database...")
+// Connect opens the database of the configuration and keeps it in DB.
+func Connect(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	log.Printf("Connecting to MySQL database %s at %s...", cfg.Name, cfg.Host)
 
-	dsn := "root:root@tcp(172.28.0.2:3306)/GrabDB?charset=utf8mb4&parseTime=True&loc=Local"
-
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(mysql.Open(cfg.DSN()), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
@@ -35,6 +35,26 @@ func RegisterUser(username, hashedPassword string) error {
 	return nil
 }
 
+// CreateUser stores a user with the given role, RegisterUser always uses the default role.
+func CreateUser(username, hashedPassword, role string) error {
+	query := "INSERT INTO Users (Username, Password, Role) VALUES (?, ?, ?)"
+	result := DB.Exec(query, username, hashedPassword, role)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// CreateExternalUser stores a user without a local password, whose password is checked by the given source.
+func CreateExternalUser(username, role, source string) error {
+	query := "INSERT INTO Users (Username, Password, Role, AuthSource) VALUES (?, '', ?, ?)"
+	result := DB.Exec(query, username, role, source)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
 func UsernameExists(username string) (bool, error) {
 	var count int64
 	result := DB.Table("Users").Where("username = ?", username).Count(&count)
@@ -54,61 +74,113 @@ func GetUserByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
-func SaveUserToken(userID int, token string, expiration time.Time) error {
-	query := "UPDATE Users SET Token = ?, token_expires_at = ? WHERE id = ?"
-	result := DB.Exec(query, token, expiration, userID)
-
+func GetUserByID(userID int) (*models.User, error) {
+	var user models.User
+	query := "SELECT * FROM Users WHERE ID = ?"
+	result := DB.Raw(query, userID).Scan(&user)
 	if result.Error != nil {
-		return result.Error
+		return nil, result.Error
 	}
-	return nil
+	return &user, nil
 }
 
-func CheckUserToken(userID int, tokenString string) (bool, error) {
-	var count int
+// UserFilter selects users for SearchUsers. Empty fields don't restrict the selection.
+type UserFilter struct {
+	Query  string
+	Role   string
+	Locked *bool
+	Limit  int
+	Offset int
+}
 
-	// Use DB.Raw to run the raw SQL query
-	query := "SELECT COUNT(*) FROM Users WHERE ID = ? AND Token = ?"
-	result := DB.Raw(query, userID, tokenString).Scan(&count)
+// SearchUsers returns the users matching the filter ordered by ID, without their password hashes,
+// and the total number of matching users.
+func SearchUsers(filter UserFilter) ([]models.User, int64, error) {
+	where := "WHERE 1 = 1"
+	var args []interface{}
+	if filter.Query != "" {
+		where += " AND Username LIKE ?"
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+	}
+	if filter.Role != "" {
+		where += " AND Role = ?"
+		args = append(args, filter.Role)
+	}
+	if filter.Locked != nil {
+		if *filter.Locked {
+			where += " AND LockedAt IS NOT NULL"
+		} else {
+			where += " AND LockedAt IS NULL"
+		}
+	}
 
-	// Check if there's an error in the query execution
+	var total int64
+	result := DB.Raw("SELECT COUNT(*) FROM Users "+where, args...).Scan(&total)
 	if result.Error != nil {
-		return false, result.Error
+		return nil, 0, result.Error
 	}
 
-	// Return true if the count is greater than 0 (i.e., token exists for the user)
-	return count > 0, nil
+	var users []models.User
+	query := "SELECT ID, Username, Role, AuthSource, LockedAt, MustChangePassword, TOTPEnabled, CreatedAt FROM Users " + where + " ORDER BY ID LIMIT ? OFFSET ?"
+	result = DB.Raw(query, append(args, filter.Limit, filter.Offset)...).Scan(&users)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return users, total, nil
 }
 
-func DeleteUserToken(userID int) error {
+func UpdateUserRole(userID int, role string) (bool, error) {
+	query := "UPDATE Users SET Role = ? WHERE ID = ?"
+	result := DB.Exec(query, role, userID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
 
-	query := "UPDATE Users SET Token = NULL WHERE ID = ?"
+// SetUserLocked locks or unlocks a user. Locking an already locked user keeps the original timestamp.
+func SetUserLocked(userID int, locked bool) (bool, error) {
+	query := "UPDATE Users SET LockedAt = NULL WHERE ID = ?"
+	if locked {
+		query = "UPDATE Users SET LockedAt = COALESCE(LockedAt, NOW()) WHERE ID = ?"
+	}
 	result := DB.Exec(query, userID)
 	if result.Error != nil {
-		return result.Error
+		return false, result.Error
 	}
-	return nil
+	return result.RowsAffected > 0, nil
 }
 
-/*
-
+func SetMustChangePassword(userID int, mustChange bool) (bool, error) {
+	query := "UPDATE Users SET MustChangePassword = ? WHERE ID = ?"
+	result := DB.Exec(query, mustChange, userID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
 
-func UpdateUserPassword(username, newPassword string) error {
-    query := "UPDATE users SET password = ? WHERE username = ?"
-    result := database.DB.Exec(query, newPassword, username)
-    if result.Error != nil {
-        return result.Error
-    }
-    return nil
+// UpdateUserPassword stores a new password hash and clears a pending forced password change.
+func UpdateUserPassword(userID int, hashedPassword string) error {
+	query := "UPDATE Users SET Password = ?, MustChangePassword = FALSE WHERE ID = ?"
+	result := DB.Exec(query, hashedPassword, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
 }
 
-func DeleteUserByUsername(username string) error {
-    query := "DELETE FROM users WHERE username = ?"
-    result := database.DB.Exec(query, username)
-    if result.Error != nil {
-        return result.Error
-    }
-    return nil
+// DeleteUser removes a user, their sessions, refresh tokens and API keys are removed with them.
+func DeleteUser(userID int) (bool, error) {
+	query := "DELETE FROM Users WHERE ID = ?"
+	result := DB.Exec(query, userID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
 }
 
-*/
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
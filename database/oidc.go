@@ -0,0 +1,66 @@
+package database
+
+import (
+	"GoGrab/models"
+
+	"gorm.io/gorm"
+)
+
+func SaveOIDCState(state *models.OIDCState) error {
+	query := "INSERT INTO OIDCStates (StateHash, Nonce, CodeVerifier, ExpiresAt) VALUES (?, ?, ?, ?)"
+	result := DB.Exec(query, state.StateHash, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// TakeOIDCState returns and removes a pending login, so every state can only be used once.
+// It returns nil if there is no such state or another request took it first.
+func TakeOIDCState(stateHash string) (*models.OIDCState, error) {
+	var states []models.OIDCState
+	result := DB.Raw("SELECT * FROM OIDCStates WHERE StateHash = ?", stateHash).Scan(&states)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(states) == 0 {
+		return nil, nil
+	}
+	result = DB.Exec("DELETE FROM OIDCStates WHERE StateHash = ?", stateHash)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &states[0], nil
+}
+
+// GetUserByIdentity returns the user linked to an account of an OIDC provider, or nil if there is none.
+func GetUserByIdentity(issuer, subject string) (*models.User, error) {
+	var users []models.User
+	query := "SELECT Users.* FROM Users JOIN UserIdentities ON UserIdentities.UserID = Users.ID WHERE UserIdentities.Issuer = ? AND UserIdentities.Subject = ?"
+	result := DB.Raw(query, issuer, subject).Scan(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return &users[0], nil
+}
+
+// CreateUserWithIdentity stores a user provisioned by single sign-on together with the link to its provider account.
+func CreateUserWithIdentity(user *models.User, issuer, subject string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		query := "INSERT INTO Users (Username, Password, Role, AuthSource) VALUES (?, ?, ?, ?)"
+		if result := tx.Exec(query, user.Username, user.Password, user.Role, models.AuthSourceOIDC); result.Error != nil {
+			return result.Error
+		}
+		if result := tx.Raw("SELECT LAST_INSERT_ID()").Scan(&user.ID); result.Error != nil {
+			return result.Error
+		}
+		query = "INSERT INTO UserIdentities (UserID, Issuer, Subject) VALUES (?, ?, ?)"
+		return tx.Exec(query, user.ID, issuer, subject).Error
+	})
+}
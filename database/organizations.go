@@ -0,0 +1,144 @@
+package database
+
+import (
+	"GoGrab/models"
+
+	"gorm.io/gorm"
+)
+
+// CreateOrganization stores a new organization with its creator as owner.
+func CreateOrganization(org *models.Organization) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		query := "INSERT INTO Organizations (Name, CreatedBy) VALUES (?, ?)"
+		if result := tx.Exec(query, org.Name, org.CreatedBy); result.Error != nil {
+			return result.Error
+		}
+		if result := tx.Raw("SELECT LAST_INSERT_ID()").Scan(&org.ID); result.Error != nil {
+			return result.Error
+		}
+		query = "INSERT INTO OrganizationMembers (OrganizationID, UserID, Role) VALUES (?, ?, ?)"
+		return tx.Exec(query, org.ID, org.CreatedBy, models.OrgRoleOwner).Error
+	})
+}
+
+// GetOrganization returns the organization with the given ID, or nil if there is none.
+func GetOrganization(orgID int) (*models.Organization, error) {
+	var orgs []models.Organization
+	result := DB.Raw("SELECT * FROM Organizations WHERE ID = ?", orgID).Scan(&orgs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(orgs) == 0 {
+		return nil, nil
+	}
+	return &orgs[0], nil
+}
+
+func OrganizationNameExists(name string) (bool, error) {
+	var count int64
+	result := DB.Raw("SELECT COUNT(*) FROM Organizations WHERE Name = ?", name).Scan(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return count > 0, nil
+}
+
+// GetUserOrganizations returns the organizations the user is a member of, with the user's role, ordered by name.
+func GetUserOrganizations(userID int) ([]models.Organization, error) {
+	orgs := []models.Organization{}
+	query := "SELECT Organizations.*, OrganizationMembers.Role AS Role FROM Organizations JOIN OrganizationMembers ON OrganizationMembers.OrganizationID = Organizations.ID WHERE OrganizationMembers.UserID = ? ORDER BY Organizations.Name"
+	result := DB.Raw(query, userID).Scan(&orgs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return orgs, nil
+}
+
+// GetOrganizations returns every organization, ordered by name.
+func GetOrganizations() ([]models.Organization, error) {
+	orgs := []models.Organization{}
+	result := DB.Raw("SELECT * FROM Organizations ORDER BY Name").Scan(&orgs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return orgs, nil
+}
+
+func RenameOrganization(orgID int, name string) (bool, error) {
+	result := DB.Exec("UPDATE Organizations SET Name = ? WHERE ID = ?", name, orgID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteOrganization removes an organization, its memberships go with it.
+func DeleteOrganization(orgID int) (bool, error) {
+	result := DB.Exec("DELETE FROM Organizations WHERE ID = ?", orgID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetOrganizationMembers returns the members of an organization with their usernames, ordered by username.
+func GetOrganizationMembers(orgID int) ([]models.OrganizationMember, error) {
+	members := []models.OrganizationMember{}
+	query := "SELECT OrganizationMembers.*, Users.Username FROM OrganizationMembers JOIN Users ON Users.ID = OrganizationMembers.UserID WHERE OrganizationMembers.OrganizationID = ? ORDER BY Users.Username"
+	result := DB.Raw(query, orgID).Scan(&members)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return members, nil
+}
+
+// GetMembershipRole returns the role of a user in an organization, or an empty string if the user isn't a member.
+func GetMembershipRole(orgID, userID int) (string, error) {
+	var roles []string
+	query := "SELECT Role FROM OrganizationMembers WHERE OrganizationID = ? AND UserID = ?"
+	result := DB.Raw(query, orgID, userID).Scan(&roles)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if len(roles) == 0 {
+		return "", nil
+	}
+	return roles[0], nil
+}
+
+func AddOrganizationMember(orgID, userID int, role string) error {
+	query := "INSERT INTO OrganizationMembers (OrganizationID, UserID, Role) VALUES (?, ?, ?)"
+	result := DB.Exec(query, orgID, userID, role)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func UpdateOrganizationMember(orgID, userID int, role string) (bool, error) {
+	query := "UPDATE OrganizationMembers SET Role = ? WHERE OrganizationID = ? AND UserID = ?"
+	result := DB.Exec(query, role, orgID, userID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func RemoveOrganizationMember(orgID, userID int) (bool, error) {
+	result := DB.Exec("DELETE FROM OrganizationMembers WHERE OrganizationID = ? AND UserID = ?", orgID, userID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountOrganizationOwners returns how many owners an organization has, the last one can't leave or be demoted.
+func CountOrganizationOwners(orgID int) (int64, error) {
+	var count int64
+	query := "SELECT COUNT(*) FROM OrganizationMembers WHERE OrganizationID = ? AND Role = ?"
+	result := DB.Raw(query, orgID, models.OrgRoleOwner).Scan(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
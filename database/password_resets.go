@@ -0,0 +1,44 @@
+package database
+
+import (
+	"GoGrab/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SavePasswordResetToken stores a new reset token for the user, replacing the unused ones issued before.
+func SavePasswordResetToken(userID, createdBy int, tokenHash string, expiration time.Time) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Exec("DELETE FROM PasswordResetTokens WHERE UserID = ? AND UsedAt IS NULL", userID); result.Error != nil {
+			return result.Error
+		}
+		query := "INSERT INTO PasswordResetTokens (UserID, TokenHash, CreatedBy, ExpiresAt) VALUES (?, ?, ?, ?)"
+		return tx.Exec(query, userID, tokenHash, createdBy, expiration).Error
+	})
+}
+
+// GetPasswordResetTokenByHash returns the reset token with the given hash, or nil if there is none.
+func GetPasswordResetTokenByHash(tokenHash string) (*models.PasswordResetToken, error) {
+	var tokens []models.PasswordResetToken
+	query := "SELECT * FROM PasswordResetTokens WHERE TokenHash = ?"
+	result := DB.Raw(query, tokenHash).Scan(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return &tokens[0], nil
+}
+
+// MarkPasswordResetTokenUsed marks a reset token as redeemed. It returns false if it was already used,
+// so two concurrent requests can't both redeem it.
+func MarkPasswordResetTokenUsed(id int) (bool, error) {
+	query := "UPDATE PasswordResetTokens SET UsedAt = NOW() WHERE ID = ? AND UsedAt IS NULL"
+	result := DB.Exec(query, id)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
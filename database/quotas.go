@@ -0,0 +1,184 @@
+package database
+
+import (
+	"GoGrab/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// usageDay is the format of the Day column of UsageCounters, days are counted in UTC.
+const usageDay = "2006-01-02"
+
+func GetQuotas() ([]models.Quota, error) {
+	quotas := []models.Quota{}
+	result := DB.Raw("SELECT * FROM Quotas ORDER BY Scope, Target").Scan(&quotas)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return quotas, nil
+}
+
+// GetQuota returns the quota of a role or user, or nil if there is none.
+func GetQuota(scope, target string) (*models.Quota, error) {
+	var quotas []models.Quota
+	result := DB.Raw("SELECT * FROM Quotas WHERE Scope = ? AND Target = ?", scope, target).Scan(&quotas)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(quotas) == 0 {
+		return nil, nil
+	}
+	return &quotas[0], nil
+}
+
+// SetQuota creates or replaces the quota of a role or user.
+func SetQuota(quota *models.Quota) error {
+	query := `INSERT INTO Quotas (Scope, Target, MaxConcurrentJobs, MaxPagesPerDay, MaxStoredBytes, MaxBrowserMinutes, UpdatedBy, UpdatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE MaxConcurrentJobs = VALUES(MaxConcurrentJobs), MaxPagesPerDay = VALUES(MaxPagesPerDay),
+		MaxStoredBytes = VALUES(MaxStoredBytes), MaxBrowserMinutes = VALUES(MaxBrowserMinutes), UpdatedBy = VALUES(UpdatedBy), UpdatedAt = NOW()`
+	result := DB.Exec(query, quota.Scope, quota.Target, quota.MaxConcurrentJobs, quota.MaxPagesPerDay, quota.MaxStoredBytes, quota.MaxBrowserMinutes, quota.UpdatedBy)
+	return result.Error
+}
+
+func DeleteQuota(scope, target string) (bool, error) {
+	result := DB.Exec("DELETE FROM Quotas WHERE Scope = ? AND Target = ?", scope, target)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+/*
+StartCrawlJob stores a running crawl job unless the user already runs maxConcurrent jobs (0 for no limit).
+Jobs that haven't been updated since staleAfter don't count, their crawl died with its server.
+The user's row is locked while counting, so two requests can't both take the last slot.
+*/
+func StartCrawlJob(job *models.CrawlJob, maxConcurrent int, staleAfter time.Time) (bool, error) {
+	started := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var ids []int
+		if result := tx.Raw("SELECT ID FROM Users WHERE ID = ? FOR UPDATE", job.UserID).Scan(&ids); result.Error != nil {
+			return result.Error
+		}
+		if maxConcurrent > 0 {
+			var running int64
+			query := "SELECT COUNT(*) FROM CrawlJobs WHERE UserID = ? AND Status = ? AND UpdatedAt >= ?"
+			if result := tx.Raw(query, job.UserID, models.CrawlJobRunning, staleAfter).Scan(&running); result.Error != nil {
+				return result.Error
+			}
+			if running >= int64(maxConcurrent) {
+				return nil
+			}
+		}
+
+		job.Status = models.CrawlJobRunning
+		query := "INSERT INTO CrawlJobs (ID, UserID, OrganizationID, Status) VALUES (?, ?, ?, ?)"
+		if result := tx.Exec(query, job.ID, job.UserID, job.OrganizationID, job.Status); result.Error != nil {
+			return result.Error
+		}
+		started = true
+		return addUsage(tx, job.UserID, time.Now(), models.Usage{Jobs: 1})
+	})
+	return started, err
+}
+
+// TouchCrawlJob marks a running job as alive.
+func TouchCrawlJob(jobID string) error {
+	return DB.Exec("UPDATE CrawlJobs SET UpdatedAt = NOW() WHERE ID = ?", jobID).Error
+}
+
+func FinishCrawlJob(jobID, status string) error {
+	return DB.Exec("UPDATE CrawlJobs SET Status = ?, UpdatedAt = NOW(), FinishedAt = NOW() WHERE ID = ?", status, jobID).Error
+}
+
+// CountRunningCrawlJobs returns how many jobs of the user run and were updated since staleAfter.
+func CountRunningCrawlJobs(userID int, staleAfter time.Time) (int64, error) {
+	var running int64
+	query := "SELECT COUNT(*) FROM CrawlJobs WHERE UserID = ? AND Status = ? AND UpdatedAt >= ?"
+	result := DB.Raw(query, userID, models.CrawlJobRunning, staleAfter).Scan(&running)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return running, nil
+}
+
+// AddUsage adds to the usage counters of the user for the UTC day of at.
+func AddUsage(userID int, at time.Time, usage models.Usage) error {
+	return addUsage(DB, userID, at, usage)
+}
+
+func addUsage(db *gorm.DB, userID int, at time.Time, usage models.Usage) error {
+	query := `INSERT INTO UsageCounters (UserID, Day, Jobs, Pages, BytesWritten, BrowserSeconds) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE Jobs = Jobs + VALUES(Jobs), Pages = Pages + VALUES(Pages),
+		BytesWritten = BytesWritten + VALUES(BytesWritten), BrowserSeconds = BrowserSeconds + VALUES(BrowserSeconds)`
+	result := db.Exec(query, userID, at.UTC().Format(usageDay), usage.Jobs, usage.Pages, usage.BytesWritten, usage.BrowserSeconds)
+	return result.Error
+}
+
+// GetUsage sums the usage counters of the user for the UTC days from from up to but not including until.
+func GetUsage(userID int, from, until time.Time) (models.Usage, error) {
+	usage := models.Usage{UserID: userID}
+	query := `SELECT COALESCE(SUM(Jobs), 0) AS Jobs, COALESCE(SUM(Pages), 0) AS Pages, COALESCE(SUM(BytesWritten), 0) AS BytesWritten,
+		COALESCE(SUM(BrowserSeconds), 0) AS BrowserSeconds FROM UsageCounters WHERE UserID = ? AND Day >= ? AND Day < ?`
+	result := DB.Raw(query, userID, from.UTC().Format(usageDay), until.UTC().Format(usageDay)).Scan(&usage)
+	if result.Error != nil {
+		return usage, result.Error
+	}
+	return usage, nil
+}
+
+// GetUsageByUser sums the usage counters of every user with usage for the UTC days from from up to but not including until, ordered by user ID.
+func GetUsageByUser(from, until time.Time) ([]models.Usage, error) {
+	usage := []models.Usage{}
+	query := `SELECT UsageCounters.UserID, COALESCE(Users.Username, "") AS Username, SUM(Jobs) AS Jobs, SUM(Pages) AS Pages,
+		SUM(BytesWritten) AS BytesWritten, SUM(BrowserSeconds) AS BrowserSeconds
+		FROM UsageCounters LEFT JOIN Users ON Users.ID = UsageCounters.UserID
+		WHERE Day >= ? AND Day < ? GROUP BY UsageCounters.UserID, Users.Username ORDER BY UsageCounters.UserID`
+	result := DB.Raw(query, from.UTC().Format(usageDay), until.UTC().Format(usageDay)).Scan(&usage)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return usage, nil
+}
+
+// AddStoredBytes adds the changes, by user ID, to the bytes the users' stored pages take up. A counter never drops below zero.
+func AddStoredBytes(changes map[int]int64) error {
+	query := `INSERT INTO StoredBytes (UserID, Bytes) VALUES (?, GREATEST(?, 0))
+		ON DUPLICATE KEY UPDATE Bytes = GREATEST(Bytes + ?, 0)`
+	for userID, change := range changes {
+		if change == 0 {
+			continue
+		}
+		if result := DB.Exec(query, userID, change, change); result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// GetStoredBytes returns how many bytes the stored pages of the user take up.
+func GetStoredBytes(userID int) (int64, error) {
+	var stored int64
+	result := DB.Raw("SELECT COALESCE(SUM(Bytes), 0) FROM StoredBytes WHERE UserID = ?", userID).Scan(&stored)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return stored, nil
+}
+
+// ReplaceStoredBytes replaces every counter of stored bytes with a recount, by user ID.
+func ReplaceStoredBytes(stored map[int]int64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Exec("DELETE FROM StoredBytes"); result.Error != nil {
+			return result.Error
+		}
+		for userID, bytes := range stored {
+			if result := tx.Exec("INSERT INTO StoredBytes (UserID, Bytes) VALUES (?, ?)", userID, bytes); result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+}
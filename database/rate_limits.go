@@ -0,0 +1,38 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+UpdateRateLimitBucket locks the bucket of key for the transaction and stores the tokens returned by
+update, which gets the tokens left and when they were counted. A new bucket starts with initial
+tokens. The row is created or locked with an upsert first, a locking read of a missing row would
+take a gap lock that deadlocks with the insert of another instance.
+*/
+func UpdateRateLimitBucket(key string, initial float64, update func(tokens float64, updatedAt time.Time) float64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		query := "INSERT INTO RateLimitBuckets (BucketKey, Tokens, UpdatedAt) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE BucketKey = BucketKey"
+		if result := tx.Exec(query, key, initial, time.Now()); result.Error != nil {
+			return result.Error
+		}
+
+		var buckets []struct {
+			Tokens    float64
+			UpdatedAt time.Time
+		}
+		result := tx.Raw("SELECT Tokens, UpdatedAt FROM RateLimitBuckets WHERE BucketKey = ? FOR UPDATE", key).Scan(&buckets)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(buckets) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		tokens := update(buckets[0].Tokens, buckets[0].UpdatedAt)
+		query = "UPDATE RateLimitBuckets SET Tokens = ?, UpdatedAt = ? WHERE BucketKey = ?"
+		return tx.Exec(query, tokens, time.Now(), key).Error
+	})
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"GoGrab/models"
+	"time"
+)
+
+func SaveRefreshToken(userID int, familyID, tokenHash string, expiration time.Time) error {
+	query := "INSERT INTO RefreshTokens (UserID, FamilyID, TokenHash, ExpiresAt) VALUES (?, ?, ?, ?)"
+	result := DB.Exec(query, userID, familyID, tokenHash, expiration)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetRefreshTokenByHash returns the refresh token with the given hash, or nil if there is none.
+func GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	var tokens []models.RefreshToken
+	query := "SELECT * FROM RefreshTokens WHERE TokenHash = ?"
+	result := DB.Raw(query, tokenHash).Scan(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return &tokens[0], nil
+}
+
+// MarkRefreshTokenUsed marks a token as used. It returns false when the token was already used,
+// which happens when two requests race to rotate the same token.
+func MarkRefreshTokenUsed(id int) (bool, error) {
+	query := "UPDATE RefreshTokens SET UsedAt = NOW() WHERE ID = ? AND UsedAt IS NULL"
+	result := DB.Exec(query, id)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func RevokeRefreshTokenFamily(familyID string) error {
+	query := "UPDATE RefreshTokens SET RevokedAt = NOW() WHERE FamilyID = ? AND RevokedAt IS NULL"
+	result := DB.Exec(query, familyID)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func RevokeUserRefreshTokens(userID int) error {
+	query := "UPDATE RefreshTokens SET RevokedAt = NOW() WHERE UserID = ? AND RevokedAt IS NULL"
+	result := DB.Exec(query, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// RevokeAllRefreshTokens revokes the refresh tokens of every user.
+func RevokeAllRefreshTokens() error {
+	query := "UPDATE RefreshTokens SET RevokedAt = NOW() WHERE RevokedAt IS NULL"
+	result := DB.Exec(query)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// RevokeOtherUserRefreshTokens revokes the refresh tokens of a user except those of one family.
+func RevokeOtherUserRefreshTokens(userID int, keepFamilyID string) error {
+	query := "UPDATE RefreshTokens SET RevokedAt = NOW() WHERE UserID = ? AND FamilyID <> ? AND RevokedAt IS NULL"
+	result := DB.Exec(query, userID, keepFamilyID)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
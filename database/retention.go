@@ -0,0 +1,38 @@
+package database
+
+import (
+	"GoGrab/models"
+
+	"gorm.io/gorm"
+)
+
+func CreateRetentionPolicy(policy *models.RetentionPolicy) error {
+	// the insert and LAST_INSERT_ID() have to run on the same connection, hence the transaction
+	return DB.Transaction(func(tx *gorm.DB) error {
+		query := "INSERT INTO RetentionPolicies (Scope, Target, MaxAgeDays, KeepLast, CreatedBy) VALUES (?, ?, ?, ?, ?)"
+		result := tx.Exec(query, policy.Scope, policy.Target, policy.MaxAgeDays, policy.KeepLast, policy.CreatedBy)
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Raw("SELECT LAST_INSERT_ID()").Scan(&policy.ID).Error
+	})
+}
+
+func GetRetentionPolicies() ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	query := "SELECT * FROM RetentionPolicies ORDER BY ID"
+	result := DB.Raw(query).Scan(&policies)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return policies, nil
+}
+
+func DeleteRetentionPolicy(id int) (bool, error) {
+	query := "DELETE FROM RetentionPolicies WHERE ID = ?"
+	result := DB.Exec(query, id)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
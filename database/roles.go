@@ -0,0 +1,99 @@
+package database
+
+import (
+	"GoGrab/models"
+
+	"gorm.io/gorm"
+)
+
+// GetRoles returns all roles with their own permissions, ordered by name.
+func GetRoles() ([]models.Role, error) {
+	var roles []models.Role
+	result := DB.Raw("SELECT * FROM Roles ORDER BY Name").Scan(&roles)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var grants []models.RolePermission
+	result = DB.Raw("SELECT Role, Permission FROM RolePermissions ORDER BY Permission").Scan(&grants)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	permissions := make(map[string][]string)
+	for _, grant := range grants {
+		permissions[grant.Role] = append(permissions[grant.Role], grant.Permission)
+	}
+	for i := range roles {
+		roles[i].Permissions = permissions[roles[i].Name]
+		if roles[i].Permissions == nil {
+			roles[i].Permissions = []string{}
+		}
+	}
+	return roles, nil
+}
+
+// CreateRole stores a new role and its permissions.
+func CreateRole(role *models.Role) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		query := "INSERT INTO Roles (Name, Description, Parent, Require2FA) VALUES (?, ?, ?, ?)"
+		if result := tx.Exec(query, role.Name, role.Description, role.Parent, role.Require2FA); result.Error != nil {
+			return result.Error
+		}
+		return insertRolePermissions(tx, role)
+	})
+}
+
+// UpdateRole replaces the description, parent, 2FA requirement and permissions of a role.
+func UpdateRole(role *models.Role) (bool, error) {
+	updated := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if result := tx.Raw("SELECT COUNT(*) FROM Roles WHERE Name = ?", role.Name).Scan(&count); result.Error != nil {
+			return result.Error
+		}
+		if count == 0 {
+			return nil
+		}
+
+		query := "UPDATE Roles SET Description = ?, Parent = ?, Require2FA = ? WHERE Name = ?"
+		if result := tx.Exec(query, role.Description, role.Parent, role.Require2FA, role.Name); result.Error != nil {
+			return result.Error
+		}
+		if result := tx.Exec("DELETE FROM RolePermissions WHERE Role = ?", role.Name); result.Error != nil {
+			return result.Error
+		}
+		updated = true
+		return insertRolePermissions(tx, role)
+	})
+	return updated, err
+}
+
+func insertRolePermissions(tx *gorm.DB, role *models.Role) error {
+	for _, permission := range role.Permissions {
+		query := "INSERT INTO RolePermissions (Role, Permission) VALUES (?, ?)"
+		if result := tx.Exec(query, role.Name, permission); result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// DeleteRole removes a role, its permissions are removed with it.
+func DeleteRole(name string) (bool, error) {
+	result := DB.Exec("DELETE FROM Roles WHERE Name = ?", name)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountUsersWithRole returns how many users have the role.
+func CountUsersWithRole(name string) (int64, error) {
+	var count int64
+	result := DB.Raw("SELECT COUNT(*) FROM Users WHERE Role = ?", name).Scan(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"GoGrab/models"
+	"time"
+)
+
+func CreateSession(session *models.Session) error {
+	query := "INSERT INTO Sessions (ID, UserID, TokenHash, UserAgent, IP, ExpiresAt) VALUES (?, ?, ?, ?, ?, ?)"
+	result := DB.Exec(query, session.ID, session.UserID, session.TokenHash, session.UserAgent, session.IP, session.ExpiresAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetSession returns the session with the given ID, or nil if there is none.
+func GetSession(sessionID string) (*models.Session, error) {
+	var sessions []models.Session
+	query := "SELECT * FROM Sessions WHERE ID = ?"
+	result := DB.Raw(query, sessionID).Scan(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	return &sessions[0], nil
+}
+
+// UpdateSessionToken stores the hash of the latest access token of a session and extends it.
+func UpdateSessionToken(sessionID, tokenHash string, expiration time.Time) error {
+	query := "UPDATE Sessions SET TokenHash = ?, ExpiresAt = ?, LastSeenAt = NOW() WHERE ID = ?"
+	result := DB.Exec(query, tokenHash, expiration, sessionID)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// TouchSession updates the last seen timestamp, at most once a minute to keep writes down.
+func TouchSession(sessionID string) error {
+	query := "UPDATE Sessions SET LastSeenAt = NOW() WHERE ID = ? AND LastSeenAt < NOW() - INTERVAL 1 MINUTE"
+	result := DB.Exec(query, sessionID)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetActiveSessions returns the sessions of a user that are neither revoked nor expired, most recently used first.
+func GetActiveSessions(userID int) ([]models.Session, error) {
+	var sessions []models.Session
+	query := "SELECT * FROM Sessions WHERE UserID = ? AND RevokedAt IS NULL AND ExpiresAt > NOW() ORDER BY LastSeenAt DESC"
+	result := DB.Raw(query, userID).Scan(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one session of a user. It returns false if the user has no such active session.
+func RevokeSession(userID int, sessionID string) (bool, error) {
+	query := "UPDATE Sessions SET RevokedAt = NOW() WHERE ID = ? AND UserID = ? AND RevokedAt IS NULL"
+	result := DB.Exec(query, sessionID, userID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RevokeUserSessions revokes all sessions of a user and returns how many were active.
+func RevokeUserSessions(userID int) (int64, error) {
+	query := "UPDATE Sessions SET RevokedAt = NOW() WHERE UserID = ? AND RevokedAt IS NULL"
+	result := DB.Exec(query, userID)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// RevokeAllSessions revokes the sessions of every user, e.g. after the signing key leaked, and returns how many were active.
+func RevokeAllSessions() (int64, error) {
+	query := "UPDATE Sessions SET RevokedAt = NOW() WHERE RevokedAt IS NULL"
+	result := DB.Exec(query)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// RevokeOtherUserSessions revokes all sessions of a user except one and returns how many were active.
+func RevokeOtherUserSessions(userID int, keepSessionID string) (int64, error) {
+	query := "UPDATE Sessions SET RevokedAt = NOW() WHERE UserID = ? AND ID <> ? AND RevokedAt IS NULL"
+	result := DB.Exec(query, userID, keepSessionID)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"GoGrab/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetSigningKeys returns all signing keys, newest first.
+func GetSigningKeys() ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	result := DB.Raw("SELECT * FROM SigningKeys ORDER BY CreatedAt DESC, KID").Scan(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return keys, nil
+}
+
+// AddSigningKey stores a new signing key and retires all others, so it signs every token from now on.
+func AddSigningKey(key *models.SigningKey) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Exec("UPDATE SigningKeys SET RetiredAt = NOW() WHERE RetiredAt IS NULL"); result.Error != nil {
+			return result.Error
+		}
+		query := "INSERT INTO SigningKeys (KID, Algorithm, PrivateKey) VALUES (?, ?, ?)"
+		return tx.Exec(query, key.KID, key.Algorithm, key.PrivateKey).Error
+	})
+}
+
+// DeleteSigningKeysRetiredBefore removes keys that no valid token can be signed with anymore.
+func DeleteSigningKeysRetiredBefore(cutoff time.Time) (int64, error) {
+	result := DB.Exec("DELETE FROM SigningKeys WHERE RetiredAt IS NOT NULL AND RetiredAt < ?", cutoff)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// DeleteRetiredSigningKeys removes all retired keys at once, for when a key leaked.
+func DeleteRetiredSigningKeys() (int64, error) {
+	result := DB.Exec("DELETE FROM SigningKeys WHERE RetiredAt IS NOT NULL")
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
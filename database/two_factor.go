@@ -0,0 +1,134 @@
+package database
+
+import (
+	"GoGrab/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SetTOTPSecret stores the secret of a pending enrollment, 2FA stays disabled until it is confirmed.
+func SetTOTPSecret(userID int, secret string) error {
+	query := "UPDATE Users SET TOTPSecret = ?, TOTPEnabled = FALSE, TOTPLastStep = 0 WHERE ID = ?"
+	result := DB.Exec(query, secret, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// EnableTOTP confirms the enrollment of a user and replaces the recovery codes, in one transaction.
+func EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		query := "UPDATE Users SET TOTPEnabled = TRUE, TOTPLastStep = ? WHERE ID = ?"
+		if result := tx.Exec(query, step, userID); result.Error != nil {
+			return result.Error
+		}
+		return replaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+	})
+}
+
+// DisableTOTP turns 2FA off for a user and removes the secret and the recovery codes.
+func DisableTOTP(userID int) (bool, error) {
+	disabled := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		query := "UPDATE Users SET TOTPSecret = '', TOTPEnabled = FALSE, TOTPLastStep = 0 WHERE ID = ?"
+		result := tx.Exec(query, userID)
+		if result.Error != nil {
+			return result.Error
+		}
+		disabled = result.RowsAffected > 0
+		return tx.Exec("DELETE FROM RecoveryCodes WHERE UserID = ?", userID).Error
+	})
+	return disabled, err
+}
+
+// UseTOTPStep records the time step of an accepted code. It returns false if that step or a later one
+// was already used, so two requests racing with the same code can't both succeed.
+func UseTOTPStep(userID int, step int64) (bool, error) {
+	query := "UPDATE Users SET TOTPLastStep = ? WHERE ID = ? AND TOTPLastStep < ?"
+	result := DB.Exec(query, step, userID, step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID int, codeHashes []string) error {
+	if result := tx.Exec("DELETE FROM RecoveryCodes WHERE UserID = ?", userID); result.Error != nil {
+		return result.Error
+	}
+	for _, hash := range codeHashes {
+		if result := tx.Exec("INSERT INTO RecoveryCodes (UserID, CodeHash) VALUES (?, ?)", userID, hash); result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used. It returns false if there is no such code.
+func UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := "UPDATE RecoveryCodes SET UsedAt = NOW() WHERE UserID = ? AND CodeHash = ? AND UsedAt IS NULL LIMIT 1"
+	result := DB.Exec(query, userID, codeHash)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left.
+func CountRecoveryCodes(userID int) (int64, error) {
+	var count int64
+	result := DB.Raw("SELECT COUNT(*) FROM RecoveryCodes WHERE UserID = ? AND UsedAt IS NULL", userID).Scan(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+func CreateLoginChallenge(userID int, tokenHash, purpose string, expiration time.Time) error {
+	query := "INSERT INTO LoginChallenges (UserID, TokenHash, Purpose, ExpiresAt) VALUES (?, ?, ?, ?)"
+	result := DB.Exec(query, userID, tokenHash, purpose, expiration)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetLoginChallenge returns the login challenge with the given token hash, or nil if there is none.
+func GetLoginChallenge(tokenHash string) (*models.LoginChallenge, error) {
+	var challenges []models.LoginChallenge
+	query := "SELECT * FROM LoginChallenges WHERE TokenHash = ?"
+	result := DB.Raw(query, tokenHash).Scan(&challenges)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(challenges) == 0 {
+		return nil, nil
+	}
+	return &challenges[0], nil
+}
+
+// AddLoginChallengeAttempt counts a wrong code entered for a challenge.
+func AddLoginChallengeAttempt(id int) error {
+	result := DB.Exec("UPDATE LoginChallenges SET Attempts = Attempts + 1 WHERE ID = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteLoginChallenge removes a challenge once it was completed. It returns false if it was already gone.
+func DeleteLoginChallenge(id int) (bool, error) {
+	result := DB.Exec("DELETE FROM LoginChallenges WHERE ID = ?", id)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
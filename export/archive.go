@@ -0,0 +1,146 @@
+package export
+
+import (
+	"GoGrab/models"
+	"GoGrab/storage"
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// ManifestFile describes one host file of a ZIP download.
+type ManifestFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Pages    int       `json:"pages"`
+	Modified time.Time `json:"modified"`
+}
+
+// ManifestJob summarizes the pages a crawl job contributed to a ZIP download.
+type ManifestJob struct {
+	ID             string    `json:"id"`
+	UserID         int       `json:"user_id"`
+	Pages          int       `json:"pages"`
+	Hosts          []string  `json:"hosts"`
+	FirstCrawledAt time.Time `json:"first_crawled_at"`
+	LastCrawledAt  time.Time `json:"last_crawled_at"`
+}
+
+// Manifest is stored as manifest.json, the first entry of every ZIP download.
+type Manifest struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	TotalSize   int64          `json:"total_size"`
+	TotalPages  int            `json:"total_pages"`
+	Files       []ManifestFile `json:"files"`
+	Jobs        []ManifestJob  `json:"jobs"`
+}
+
+/*
+BuildManifest reads every file of the snapshot once to compute its hash and to collect
+the job metadata of its pages. The files are rewound afterwards, ready to be zipped.
+Pages saved before crawl jobs were recorded are counted per file but belong to no job.
+*/
+func BuildManifest(snapshot *storage.Snapshot) (*Manifest, error) {
+	manifest := &Manifest{GeneratedAt: time.Now().UTC(), Files: []ManifestFile{}, Jobs: []ManifestJob{}}
+	jobs := make(map[string]*ManifestJob)
+
+	for _, file := range snapshot.Files {
+		// hash the file while decoding it, then hash whatever the decoder didn't consume
+		hasher := sha256.New()
+		var pages []models.PageData
+		if err := json.NewDecoder(io.TeeReader(file.File, hasher)).Decode(&pages); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error decoding %s: %v", file.Name, err)
+		}
+		if _, err := io.Copy(hasher, file.File); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", file.Name, err)
+		}
+		if _, err := file.File.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("error rewinding %s: %v", file.Name, err)
+		}
+
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:     file.Name,
+			Size:     file.Size,
+			SHA256:   hex.EncodeToString(hasher.Sum(nil)),
+			Pages:    len(pages),
+			Modified: file.ModTime.UTC(),
+		})
+		manifest.TotalSize += file.Size
+		manifest.TotalPages += len(pages)
+
+		for _, page := range pages {
+			if page.JobID == "" {
+				continue
+			}
+			job, ok := jobs[page.JobID]
+			if !ok {
+				job = &ManifestJob{ID: page.JobID, UserID: page.UserID, FirstCrawledAt: page.CrawledAt, LastCrawledAt: page.CrawledAt}
+				jobs[page.JobID] = job
+			}
+			job.Pages++
+			if len(job.Hosts) == 0 || job.Hosts[len(job.Hosts)-1] != file.Name {
+				job.Hosts = append(job.Hosts, file.Name)
+			}
+			if page.CrawledAt.Before(job.FirstCrawledAt) {
+				job.FirstCrawledAt = page.CrawledAt
+			}
+			if page.CrawledAt.After(job.LastCrawledAt) {
+				job.LastCrawledAt = page.CrawledAt
+			}
+		}
+	}
+
+	for _, job := range jobs {
+		manifest.Jobs = append(manifest.Jobs, *job)
+	}
+	sort.Slice(manifest.Jobs, func(i, j int) bool {
+		return manifest.Jobs[i].FirstCrawledAt.Before(manifest.Jobs[j].FirstCrawledAt)
+	})
+	return manifest, nil
+}
+
+/*
+WriteZip streams a ZIP archive with manifest.json followed by every file of the snapshot.
+The archive is only finalized when every file was copied completely and still matches its
+manifest entry, so an error always leaves the caller with an unfinished archive instead of
+one that looks valid but is missing data.
+*/
+func WriteZip(w io.Writer, snapshot *storage.Snapshot, manifest *Manifest) error {
+	zipWriter := zip.NewWriter(w)
+
+	manifestFile, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: manifest.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(manifestFile)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	for i, file := range snapshot.Files {
+		entry := manifest.Files[i]
+		fileInZip, err := zipWriter.CreateHeader(&zip.FileHeader{Name: entry.Name, Method: zip.Deflate, Modified: entry.Modified})
+		if err != nil {
+			return err
+		}
+
+		// verify the copied bytes against the manifest while streaming them
+		hasher := sha256.New()
+		written, err := io.Copy(io.MultiWriter(fileInZip, hasher), file.File)
+		if err != nil {
+			return fmt.Errorf("error copying %s: %v", entry.Name, err)
+		}
+		if written != entry.Size || hex.EncodeToString(hasher.Sum(nil)) != entry.SHA256 {
+			return fmt.Errorf("%s changed while it was being archived", entry.Name)
+		}
+	}
+
+	return zipWriter.Close()
+}
@@ -0,0 +1,195 @@
+package export
+
+import (
+	"GoGrab/models"
+	"GoGrab/storage"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Supported export formats, besides the ZIP archive of the raw host files.
+const (
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+	FormatSQLite  = "sqlite"
+)
+
+// formats maps every export format to its content type and file extension.
+var formats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	FormatNDJSON:  {"application/x-ndjson", "ndjson"},
+	FormatCSV:     {"text/csv", "csv"},
+	FormatParquet: {"application/vnd.apache.parquet", "parquet"},
+	FormatSQLite:  {"application/vnd.sqlite3", "sqlite"},
+}
+
+// acceptTypes maps the media types accepted in the Accept header to an export format.
+var acceptTypes = map[string]string{
+	"application/x-ndjson":           FormatNDJSON,
+	"application/ndjson":             FormatNDJSON,
+	"application/jsonl":              FormatNDJSON,
+	"text/csv":                       FormatCSV,
+	"application/vnd.apache.parquet": FormatParquet,
+	"application/x-parquet":          FormatParquet,
+	"application/vnd.sqlite3":        FormatSQLite,
+	"application/x-sqlite3":          FormatSQLite,
+}
+
+// csvHeader is the column order of CSV exports, links are joined with a single space.
+var csvHeader = []string{"page_id", "version", "url", "title", "content", "content_hash", "job_id", "user_id", "crawled_at", "links"}
+
+// IsFormat reports whether format is a supported export format.
+func IsFormat(format string) bool {
+	_, ok := formats[format]
+	return ok
+}
+
+// FormatFromAccept returns the first export format listed in an Accept header, or "" when there is none.
+func FormatFromAccept(accept string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(mediaRange, ";", 2)[0])
+		if format, ok := acceptTypes[strings.ToLower(mediaType)]; ok {
+			return format
+		}
+	}
+	return ""
+}
+
+// ContentType returns the content type of an export format.
+func ContentType(format string) string {
+	return formats[format].contentType
+}
+
+// FileName returns the download file name of an export format.
+func FileName(format string) string {
+	return "scraped_data." + formats[format].extension
+}
+
+/*
+Write exports every page version of the store matching the filter to w.
+NDJSON, CSV and Parquet are streamed page by page; SQLite is built in a temporary file first,
+because a database file can't be written sequentially, and copied to w afterwards.
+*/
+func Write(w io.Writer, store *storage.Store, format string, filter storage.PageFilter) error {
+	switch format {
+	case FormatNDJSON:
+		return writeNDJSON(w, store, filter)
+	case FormatCSV:
+		return writeCSV(w, store, filter)
+	case FormatParquet:
+		return writeParquet(w, store, filter)
+	case FormatSQLite:
+		return writeSQLite(w, store, filter)
+	}
+	return fmt.Errorf("unsupported export format %q", format)
+}
+
+func writeNDJSON(w io.Writer, store *storage.Store, filter storage.PageFilter) error {
+	encoder := json.NewEncoder(w)
+	return store.EachPage(filter, func(page models.PageData) error {
+		return encoder.Encode(page)
+	})
+}
+
+func writeCSV(w io.Writer, store *storage.Store, filter storage.PageFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	err := store.EachPage(filter, func(page models.PageData) error {
+		return writer.Write([]string{
+			page.PageID,
+			strconv.Itoa(page.Version),
+			page.URL,
+			page.Title,
+			page.Content,
+			page.ContentHash,
+			page.JobID,
+			strconv.Itoa(page.UserID),
+			formatTime(page.CrawledAt),
+			strings.Join(page.Links, " "),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// parquetPage is the Parquet schema of exported pages. Columns may be added, but never renamed or retyped.
+type parquetPage struct {
+	PageID      string    `parquet:"page_id"`
+	Version     int32     `parquet:"version"`
+	URL         string    `parquet:"url"`
+	Title       string    `parquet:"title"`
+	Content     string    `parquet:"content"`
+	ContentHash string    `parquet:"content_hash"`
+	JobID       string    `parquet:"job_id"`
+	UserID      int64     `parquet:"user_id"`
+	CrawledAt   time.Time `parquet:"crawled_at,timestamp(millisecond)"`
+	Links       []string  `parquet:"links,list"`
+}
+
+// parquetBatchSize is the number of pages buffered before they are handed to the Parquet writer.
+const parquetBatchSize = 256
+
+func writeParquet(w io.Writer, store *storage.Store, filter storage.PageFilter) error {
+	writer := parquet.NewGenericWriter[parquetPage](w)
+
+	batch := make([]parquetPage, 0, parquetBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := writer.Write(batch)
+		batch = batch[:0]
+		return err
+	}
+
+	err := store.EachPage(filter, func(page models.PageData) error {
+		batch = append(batch, parquetPage{
+			PageID:      page.PageID,
+			Version:     int32(page.Version),
+			URL:         page.URL,
+			Title:       page.Title,
+			Content:     page.Content,
+			ContentHash: page.ContentHash,
+			JobID:       page.JobID,
+			UserID:      int64(page.UserID),
+			CrawledAt:   page.CrawledAt,
+			Links:       page.Links,
+		})
+		if len(batch) == parquetBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// formatTime formats a crawl timestamp as RFC 3339, pages without a timestamp get an empty value.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,264 @@
+package export
+
+import (
+	"GoGrab/config"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+var crawledAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testPages is the small snapshot the tests export, by host file.
+var testPages = map[string][]models.PageData{
+	"example.com.json": {
+		{URL: "https://example.com/", Version: 1, Title: "Home", Content: "first", JobID: "job-a", UserID: 1, CrawledAt: crawledAt, Links: []string{"https://example.com/about"}},
+		{URL: "https://example.com/", Version: 2, Title: "Home", Content: "second", JobID: "job-a", UserID: 1, CrawledAt: crawledAt.Add(time.Hour)},
+		{URL: "https://example.com/about", Version: 1, Title: `About "us", the team`, Content: "line one\nline two", JobID: "job-a", UserID: 1, CrawledAt: crawledAt.Add(time.Minute), Links: []string{"https://example.com/", "https://example.org/"}},
+	},
+	"example.org.json": {
+		{URL: "https://example.org/", Version: 1, Title: "Org", Content: "org", JobID: "job-b", UserID: 2, CrawledAt: crawledAt.Add(-time.Hour)},
+		{URL: "https://example.org/legacy", Version: 1, Title: "Saved before jobs", Content: "old"},
+	},
+}
+
+// newTestStore writes the host files of pages to a temporary data folder and returns its store.
+func newTestStore(t *testing.T, pages map[string][]models.PageData) *storage.Store {
+	t.Helper()
+	dataFolder := t.TempDir()
+	for fileName, filePages := range pages {
+		for i := range filePages {
+			filePages[i].PageID = storage.PageIDFor(filePages[i].URL)
+			filePages[i].ContentHash = storage.ContentHash(filePages[i].Content)
+		}
+		content, err := json.Marshal(filePages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dataFolder, fileName), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return storage.New(config.StorageConfig{DataFolder: dataFolder, TrashFolder: t.TempDir()})
+}
+
+// exportPages writes the pages of the store matching the filter in the format and returns the output.
+func exportPages(t *testing.T, store *storage.Store, format string, filter storage.PageFilter) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, store, format, filter); err != nil {
+		t.Fatalf("Write(%s): %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+// urlsOf returns the sorted URLs and versions of the pages, e.g. "https://example.com/@2".
+func urlsOf(pages []models.PageData) []string {
+	var urls []string
+	for _, page := range pages {
+		urls = append(urls, fmt.Sprintf("%s@%d", page.URL, page.Version))
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestFormatFromAccept(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"application/json", ""},
+		{"*/*", ""},
+		{"text/csv", FormatCSV},
+		{"Text/CSV; charset=utf-8", FormatCSV},
+		{"application/jsonl", FormatNDJSON},
+		{"application/json, application/x-ndjson;q=0.9", FormatNDJSON},
+		{"application/x-parquet, text/csv", FormatParquet},
+		{"text/html, application/vnd.sqlite3;q=0.5", FormatSQLite},
+	}
+	for _, test := range tests {
+		if got := FormatFromAccept(test.accept); got != test.want {
+			t.Errorf("FormatFromAccept(%q) = %q, want %q", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	store := newTestStore(t, testPages)
+
+	var pages []models.PageData
+	decoder := json.NewDecoder(bytes.NewReader(exportPages(t, store, FormatNDJSON, storage.PageFilter{})))
+	for decoder.More() {
+		var page models.PageData
+		if err := decoder.Decode(&page); err != nil {
+			t.Fatalf("decoding line %d: %v", len(pages)+1, err)
+		}
+		pages = append(pages, page)
+	}
+
+	want := []string{"https://example.com/@1", "https://example.com/@2", "https://example.com/about@1", "https://example.org/@1", "https://example.org/legacy@1"}
+	if got := urlsOf(pages); !reflect.DeepEqual(got, want) {
+		t.Errorf("got pages %v, want %v", got, want)
+	}
+	for _, page := range pages {
+		if page.URL == "https://example.com/about" && (page.Content != "line one\nline two" || len(page.Links) != 2 || !page.CrawledAt.Equal(crawledAt.Add(time.Minute))) {
+			t.Errorf("got %+v, want the page unchanged", page)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	store := newTestStore(t, testPages)
+
+	records, err := csv.NewReader(bytes.NewReader(exportPages(t, store, FormatCSV, storage.PageFilter{JobID: "job-a"}))).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV: %v", err)
+	}
+	if len(records) != 4 || !reflect.DeepEqual(records[0], csvHeader) {
+		t.Fatalf("got %d records with header %v, want the header and the 3 pages of job-a", len(records), records[0])
+	}
+
+	for _, record := range records[1:] {
+		if record[2] != "https://example.com/about" {
+			continue
+		}
+		want := []string{storage.PageIDFor(record[2]), "1", "https://example.com/about", `About "us", the team`, "line one\nline two",
+			storage.ContentHash("line one\nline two"), "job-a", "1", "2024-05-01T12:01:00Z", "https://example.com/ https://example.org/"}
+		if !reflect.DeepEqual(record, want) {
+			t.Errorf("got record %q, want %q", record, want)
+		}
+		return
+	}
+	t.Error("the about page is missing")
+}
+
+func TestWriteParquet(t *testing.T) {
+	store := newTestStore(t, testPages)
+
+	output := exportPages(t, store, FormatParquet, storage.PageFilter{Host: "example.org"})
+	rows, err := parquet.Read[parquetPage](bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("reading Parquet: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want the 2 pages of example.org", len(rows))
+	}
+	for _, row := range rows {
+		if row.URL == "https://example.org/" && (row.JobID != "job-b" || row.UserID != 2 || !row.CrawledAt.Equal(crawledAt.Add(-time.Hour))) {
+			t.Errorf("got row %+v", row)
+		}
+	}
+}
+
+func TestWriteSQLite(t *testing.T) {
+	store := newTestStore(t, testPages)
+
+	path := filepath.Join(t.TempDir(), "export.sqlite")
+	if err := os.WriteFile(path, exportPages(t, store, FormatSQLite, storage.PageFilter{}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var pages, links int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pages").Scan(&pages); err != nil {
+		t.Fatalf("counting pages: %v", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM links").Scan(&links); err != nil {
+		t.Fatalf("counting links: %v", err)
+	}
+	if pages != 5 || links != 3 {
+		t.Errorf("got %d pages and %d links, want 5 and 3", pages, links)
+	}
+
+	var title, content, crawled string
+	err = db.QueryRow("SELECT title, content, crawled_at FROM pages WHERE url = ? AND version = 2", "https://example.com/").Scan(&title, &content, &crawled)
+	if err != nil || title != "Home" || content != "second" || crawled != "2024-05-01T13:00:00Z" {
+		t.Errorf("got %q, %q, %q, %v, want the second version of the home page", title, content, crawled, err)
+	}
+
+	var linked []string
+	rows, err := db.Query("SELECT links.url FROM links JOIN pages USING (page_id, version) WHERE pages.url = ? ORDER BY links.url", "https://example.com/about")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var link string
+		rows.Scan(&link)
+		linked = append(linked, link)
+	}
+	if !reflect.DeepEqual(linked, []string{"https://example.com/", "https://example.org/"}) {
+		t.Errorf("got links %v", linked)
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, newTestStore(t, nil), "xml", storage.PageFilter{}); err == nil || !strings.Contains(err.Error(), "xml") {
+		t.Errorf("got %v, want the unsupported format reported", err)
+	}
+}
+
+func TestBuildManifest(t *testing.T) {
+	store := newTestStore(t, testPages)
+	snapshot, err := store.OpenSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+
+	manifest, err := BuildManifest(snapshot)
+	if err != nil {
+		t.Fatalf("BuildManifest: %v", err)
+	}
+	if manifest.TotalPages != 5 || len(manifest.Files) != 2 {
+		t.Fatalf("got %d pages in %d files, want 5 in 2", manifest.TotalPages, len(manifest.Files))
+	}
+
+	var totalSize int64
+	for _, file := range manifest.Files {
+		content, err := os.ReadFile(filepath.Join(filepath.Dir(snapshot.Files[0].File.Name()), file.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Size != int64(len(content)) || file.Pages != len(testPages[file.Name]) || len(file.SHA256) != 64 {
+			t.Errorf("got %+v, want the size, page count and hash of %s", file, file.Name)
+		}
+		totalSize += file.Size
+	}
+	if manifest.TotalSize != totalSize {
+		t.Errorf("got total size %d, want %d", manifest.TotalSize, totalSize)
+	}
+
+	// jobs come oldest first, the legacy page without a job belongs to none
+	want := []ManifestJob{
+		{ID: "job-b", UserID: 2, Pages: 1, Hosts: []string{"example.org.json"}, FirstCrawledAt: crawledAt.Add(-time.Hour), LastCrawledAt: crawledAt.Add(-time.Hour)},
+		{ID: "job-a", UserID: 1, Pages: 3, Hosts: []string{"example.com.json"}, FirstCrawledAt: crawledAt, LastCrawledAt: crawledAt.Add(time.Hour)},
+	}
+	if !reflect.DeepEqual(manifest.Jobs, want) {
+		t.Errorf("got jobs %+v, want %+v", manifest.Jobs, want)
+	}
+
+	// the files are rewound for the ZIP
+	var zipped bytes.Buffer
+	if err := WriteZip(&zipped, snapshot, manifest); err != nil {
+		t.Errorf("WriteZip after BuildManifest: %v", err)
+	}
+}
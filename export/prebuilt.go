@@ -0,0 +1,252 @@
+package export
+
+import (
+	"GoGrab/config"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrArchiveNotFound is returned when a prebuilt archive doesn't exist or has expired.
+var ErrArchiveNotFound = errors.New("archive not found")
+
+var archiveIDPattern = regexp.MustCompile(`^[a-f0-9]+$`)
+
+// Archive describes a prebuilt ZIP archive. SHA256 is the hash of the whole archive,
+// it doubles as the ETag so interrupted downloads can be resumed safely.
+type Archive struct {
+	ID        string    `json:"id"`
+	CreatedBy int       `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Manifest  *Manifest `json:"manifest,omitempty"`
+}
+
+/*
+Archives keeps the prebuilt ZIP archives of the pages of a store and their metadata files in its folder.
+Archives expire after their TTL.
+*/
+type Archives struct {
+	store  *storage.Store
+	folder string
+	ttl    time.Duration
+}
+
+// NewArchives returns the archives of the store, kept in the archive folder for the archive TTL of the configuration.
+func NewArchives(cfg config.StorageConfig, store *storage.Store) *Archives {
+	return &Archives{store: store, folder: cfg.ArchiveFolder, ttl: cfg.ArchiveTTL}
+}
+
+/*
+Build writes a ZIP archive of a snapshot of all host files to the archive folder.
+The archive is written to a temporary file first and only shows up once it is complete.
+*/
+func (a *Archives) Build(createdBy int) (*Archive, error) {
+	id, err := utils.GenerateID()
+	if err != nil {
+		return nil, fmt.Errorf("error generating archive ID: %v", err)
+	}
+
+	snapshot, err := a.store.OpenSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Close()
+
+	manifest, err := BuildManifest(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(a.folder, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating archive folder: %v", err)
+	}
+	file, err := os.CreateTemp(a.folder, id+".tmp*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating archive file: %v", err)
+	}
+	tempPath := file.Name()
+	defer os.Remove(tempPath) // no-op once the rename succeeded
+
+	hasher := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(file, hasher)}
+	if err := WriteZip(counter, snapshot, manifest); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("error writing archive: %v", err)
+	}
+
+	now := time.Now()
+	archive := &Archive{
+		ID:        id,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.ttl),
+		Size:      counter.n,
+		SHA256:    hex.EncodeToString(hasher.Sum(nil)),
+		Manifest:  manifest,
+	}
+
+	// the metadata is written before the archive is moved in place, so a listed archive always has it
+	metadata, err := json.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(a.metadataPath(id), metadata, 0644); err != nil {
+		return nil, fmt.Errorf("error writing archive metadata: %v", err)
+	}
+	if err := os.Rename(tempPath, a.archivePath(id)); err != nil {
+		os.Remove(a.metadataPath(id))
+		return nil, fmt.Errorf("error storing archive: %v", err)
+	}
+	return archive, nil
+}
+
+// Get returns the metadata of a prebuilt archive that hasn't expired.
+func (a *Archives) Get(id string) (*Archive, error) {
+	if !archiveIDPattern.MatchString(id) {
+		return nil, ErrArchiveNotFound
+	}
+	data, err := os.ReadFile(a.metadataPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrArchiveNotFound
+		}
+		return nil, fmt.Errorf("error reading archive metadata: %v", err)
+	}
+
+	var archive Archive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("error decoding archive metadata: %v", err)
+	}
+	if time.Now().After(archive.ExpiresAt) {
+		return nil, ErrArchiveNotFound
+	}
+	if _, err := os.Stat(a.archivePath(id)); err != nil {
+		return nil, ErrArchiveNotFound
+	}
+	return &archive, nil
+}
+
+// Open opens a prebuilt archive for download.
+func (a *Archives) Open(id string) (*os.File, *Archive, error) {
+	archive, err := a.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(a.archivePath(id))
+	if err != nil {
+		return nil, nil, ErrArchiveNotFound
+	}
+	return file, archive, nil
+}
+
+// List returns the prebuilt archives that haven't expired, newest first, without their manifests.
+func (a *Archives) List() ([]Archive, error) {
+	entries, err := os.ReadDir(a.folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Archive{}, nil
+		}
+		return nil, fmt.Errorf("error reading archive folder: %v", err)
+	}
+
+	archives := []Archive{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		archive, err := a.Get(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		archive.Manifest = nil
+		archives = append(archives, *archive)
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].CreatedAt.After(archives[j].CreatedAt)
+	})
+	return archives, nil
+}
+
+// Delete removes a prebuilt archive and its metadata.
+func (a *Archives) Delete(id string) error {
+	if !archiveIDPattern.MatchString(id) {
+		return ErrArchiveNotFound
+	}
+	if err := os.Remove(a.metadataPath(id)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrArchiveNotFound
+		}
+		return err
+	}
+	if err := os.Remove(a.archivePath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// PurgeExpired removes the prebuilt archives whose TTL is over.
+func (a *Archives) PurgeExpired() (int, error) {
+	entries, err := os.ReadDir(a.folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error reading archive folder: %v", err)
+	}
+
+	purged := 0
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if _, err := a.Get(id); !errors.Is(err, ErrArchiveNotFound) {
+			continue
+		}
+		if err := a.Delete(id); err != nil && !errors.Is(err, ErrArchiveNotFound) {
+			return purged, err
+		}
+		log.Printf("Purged archive %s", id)
+		purged++
+	}
+	return purged, nil
+}
+
+func (a *Archives) archivePath(id string) string {
+	return filepath.Join(a.folder, id+".zip")
+}
+
+func (a *Archives) metadataPath(id string) string {
+	return filepath.Join(a.folder, id+".json")
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,137 @@
+package export
+
+import (
+	"GoGrab/config"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newTestArchives returns the archives of a store with the test pages, kept in a temporary folder for ttl.
+func newTestArchives(t *testing.T, ttl time.Duration) *Archives {
+	t.Helper()
+	return NewArchives(config.StorageConfig{ArchiveFolder: t.TempDir(), ArchiveTTL: ttl}, newTestStore(t, testPages))
+}
+
+func TestArchivesBuild(t *testing.T) {
+	archives := newTestArchives(t, time.Hour)
+
+	archive, err := archives.Build(7)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if archive.CreatedBy != 7 || archive.Manifest == nil || archive.Manifest.TotalPages != 5 || archive.ExpiresAt.Sub(archive.CreatedAt) != time.Hour {
+		t.Errorf("got %+v, want an archive of user 7 with the 5 pages, expiring in an hour", archive)
+	}
+
+	file, stored, err := archives.Open(archive.ID)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(content)
+	if int64(len(content)) != stored.Size || hex.EncodeToString(hash[:]) != stored.SHA256 || stored.SHA256 != archive.SHA256 {
+		t.Errorf("got %d bytes with hash %s, want the size %d and hash %s of the metadata", len(content), hex.EncodeToString(hash[:]), stored.Size, stored.SHA256)
+	}
+
+	// the archive holds manifest.json first and every host file
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("reading ZIP: %v", err)
+	}
+	var names []string
+	for _, entry := range reader.File {
+		names = append(names, entry.Name)
+	}
+	if len(names) != 3 || names[0] != "manifest.json" {
+		t.Fatalf("got entries %v, want manifest.json and the 2 host files", names)
+	}
+	sort.Strings(names[1:])
+	if names[1] != "example.com.json" || names[2] != "example.org.json" {
+		t.Errorf("got entries %v", names)
+	}
+	manifestFile, err := reader.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(manifestFile).Decode(&manifest); err != nil || manifest.TotalPages != 5 {
+		t.Errorf("got manifest with %d pages, %v, want 5", manifest.TotalPages, err)
+	}
+
+	list, err := archives.List()
+	if err != nil || len(list) != 1 || list[0].ID != archive.ID || list[0].Manifest != nil {
+		t.Errorf("List = %+v, %v, want the archive without its manifest", list, err)
+	}
+}
+
+func TestArchivesExpiry(t *testing.T) {
+	// a negative TTL builds archives that have expired already
+	archives := newTestArchives(t, -time.Minute)
+
+	archive, err := archives.Build(1)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if _, err := archives.Get(archive.ID); !errors.Is(err, ErrArchiveNotFound) {
+		t.Errorf("Get: got %v, want ErrArchiveNotFound", err)
+	}
+	if _, _, err := archives.Open(archive.ID); !errors.Is(err, ErrArchiveNotFound) {
+		t.Errorf("Open: got %v, want ErrArchiveNotFound", err)
+	}
+	if list, err := archives.List(); err != nil || len(list) != 0 {
+		t.Errorf("List = %+v, %v, want no archives", list, err)
+	}
+
+	purged, err := archives.PurgeExpired()
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeExpired = %d, %v, want 1", purged, err)
+	}
+	for _, path := range []string{archives.archivePath(archive.ID), archives.metadataPath(archive.ID)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("got %v for %s, want it removed", err, path)
+		}
+	}
+}
+
+func TestArchivesInvalidID(t *testing.T) {
+	archives := newTestArchives(t, time.Hour)
+	for _, id := range []string{"", "../secret", "ABC", "0a/../0b"} {
+		if _, err := archives.Get(id); !errors.Is(err, ErrArchiveNotFound) {
+			t.Errorf("Get(%q): got %v, want ErrArchiveNotFound", id, err)
+		}
+		if err := archives.Delete(id); !errors.Is(err, ErrArchiveNotFound) {
+			t.Errorf("Delete(%q): got %v, want ErrArchiveNotFound", id, err)
+		}
+	}
+}
+
+func TestArchivesDelete(t *testing.T) {
+	archives := newTestArchives(t, time.Hour)
+	archive, err := archives.Build(1)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if err := archives.Delete(archive.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := archives.Get(archive.ID); !errors.Is(err, ErrArchiveNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrArchiveNotFound", err)
+	}
+	if err := archives.Delete(archive.ID); !errors.Is(err, ErrArchiveNotFound) {
+		t.Errorf("second Delete: got %v, want ErrArchiveNotFound", err)
+	}
+}
@@ -0,0 +1,110 @@
+package export
+
+import (
+	"GoGrab/models"
+	"GoGrab/storage"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of a SQLite export. Every link found on a page version is a row in links.
+const sqliteSchema = `
+CREATE TABLE pages (
+    page_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    title TEXT,
+    content TEXT,
+    content_hash TEXT,
+    job_id TEXT,
+    user_id INTEGER,
+    crawled_at TEXT,
+    PRIMARY KEY (page_id, version)
+);
+CREATE TABLE links (
+    page_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    FOREIGN KEY (page_id, version) REFERENCES pages (page_id, version)
+);
+CREATE INDEX links_page ON links (page_id, version);
+`
+
+/*
+writeSQLite builds a SQLite database with a pages and a links table in a temporary file
+and copies it to w. The temporary file is removed afterwards.
+*/
+func writeSQLite(w io.Writer, store *storage.Store, filter storage.PageFilter) error {
+	tempFile, err := os.CreateTemp("", "gograb-export-*.sqlite")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %v", err)
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	defer os.Remove(tempPath)
+
+	if err := buildSQLite(tempPath, store, filter); err != nil {
+		return err
+	}
+
+	file, err := os.Open(tempPath)
+	if err != nil {
+		return fmt.Errorf("error opening SQLite export: %v", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func buildSQLite(path string, store *storage.Store, filter storage.PageFilter) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("error opening SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("error creating SQLite schema: %v", err)
+	}
+
+	// insert everything in one transaction, SQLite is very slow with one transaction per row
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertPage, err := tx.Prepare("INSERT OR REPLACE INTO pages (page_id, version, url, title, content, content_hash, job_id, user_id, crawled_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertPage.Close()
+
+	insertLink, err := tx.Prepare("INSERT INTO links (page_id, version, url) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertLink.Close()
+
+	err = store.EachPage(filter, func(page models.PageData) error {
+		_, err := insertPage.Exec(page.PageID, page.Version, page.URL, page.Title, page.Content, page.ContentHash, page.JobID, page.UserID, formatTime(page.CrawledAt))
+		if err != nil {
+			return fmt.Errorf("error inserting page %s: %v", page.URL, err)
+		}
+		for _, link := range page.Links {
+			if _, err := insertLink.Exec(page.PageID, page.Version, link); err != nil {
+				return fmt.Errorf("error inserting link of %s: %v", page.URL, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
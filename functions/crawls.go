@@ -0,0 +1,250 @@
+package functions
+
+import (
+	"GoGrab/config"
+	"GoGrab/database"
+	"GoGrab/models"
+	"GoGrab/quota"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkpointGrace is how long a shutdown waits for the crawls to save their checkpoints once
+// their fetches have been cancelled.
+const checkpointGrace = 10 * time.Second
+
+// ErrInterrupted is returned when a shutdown of the server interrupted a crawl.
+var ErrInterrupted = errors.New("crawl interrupted by a shutdown")
+
+var (
+	crawlLock     sync.Mutex     // guards draining and the calls to crawlsRunning.Add
+	draining      bool           // set once the shutdown begins, no crawl starts after that
+	crawlsRunning sync.WaitGroup // the crawls a shutdown waits for
+
+	// shuttingDown is closed when the shutdown begins, the crawls don't start another fetch
+	shuttingDown = make(chan struct{})
+	// fetchContext is cancelled when the shutdown runs out of time, which closes the browsers
+	fetchContext, cancelFetches = context.WithCancel(context.Background())
+)
+
+// Frontier is the state of a crawl: the URLs still to visit, in order, and the normalized URLs already visited.
+// URLs are queued with Add, which keeps a URL out of ToVisit while it is visited or queued already.
+type Frontier struct {
+	ToVisit []string
+	Visited map[string]bool
+	// queued are the normalized URLs of ToVisit, so a page linked from every other page is queued once
+	queued map[string]bool
+}
+
+// NewFrontier returns the frontier of a new crawl of the given URLs.
+func NewFrontier(urls []string) *Frontier {
+	frontier := &Frontier{Visited: make(map[string]bool), queued: make(map[string]bool)}
+	for _, url := range urls {
+		frontier.Add(url)
+	}
+	return frontier
+}
+
+// FrontierFromCheckpoint returns the frontier saved by a checkpoint. Duplicates that checkpoints of
+// older versions may hold are dropped.
+func FrontierFromCheckpoint(checkpoint *models.CrawlCheckpoint) *Frontier {
+	frontier := NewFrontier(nil)
+	for _, url := range checkpoint.Visited {
+		frontier.Visited[url] = true
+	}
+	for _, url := range checkpoint.ToVisit {
+		frontier.Add(url)
+	}
+	return frontier
+}
+
+// Add queues a URL unless it was visited or is queued already, and reports whether it was queued.
+func (f *Frontier) Add(url string) bool {
+	normalizedURL := utils.NormalizeURL(url)
+	if f.Visited[normalizedURL] || f.queued[normalizedURL] {
+		return false
+	}
+	f.queued[normalizedURL] = true
+	f.ToVisit = append(f.ToVisit, url)
+	return true
+}
+
+// next removes the next URL from ToVisit and returns it.
+func (f *Frontier) next() string {
+	url := f.ToVisit[0]
+	f.ToVisit = f.ToVisit[1:]
+	delete(f.queued, utils.NormalizeURL(url))
+	return url
+}
+
+// requeue puts a URL whose fetch was cancelled back in front of ToVisit, so it is fetched first again.
+func (f *Frontier) requeue(url string) {
+	normalizedURL := utils.NormalizeURL(url)
+	delete(f.Visited, normalizedURL)
+	f.queued[normalizedURL] = true
+	f.ToVisit = append([]string{url}, f.ToVisit...)
+}
+
+// Checkpoint returns the state of the frontier to save for the job.
+func (f *Frontier) Checkpoint(jobID string) models.CrawlCheckpoint {
+	visited := make([]string, 0, len(f.Visited))
+	for url := range f.Visited {
+		visited = append(visited, url)
+	}
+	sort.Strings(visited)
+	return models.CrawlCheckpoint{JobID: jobID, ToVisit: append([]string{}, f.ToVisit...), Visited: visited}
+}
+
+// AcceptingCrawls reports whether new crawl jobs can start, which they can't once the server shuts down.
+func AcceptingCrawls() bool {
+	crawlLock.Lock()
+	defer crawlLock.Unlock()
+	return !draining
+}
+
+/*
+RunCrawl runs a crawl job, which has been started or resumed with the meter, and records how it
+ended. A job interrupted by a shutdown is checkpointed and marked as interrupted, also when the
+shutdown began before it could start, so the next start of the server resumes it. While the job
+runs its frontier is checkpointed every cfg.CheckpointInterval, and a job stopped by the quota
+keeps its last checkpoint, so both a crashed and a stopped job can be resumed later.
+*/
+func RunCrawl(cfg config.CrawlerConfig, store *storage.Store, job models.CrawlJob, frontier *Frontier, meter *quota.Meter) error {
+	crawlLock.Lock()
+	if draining {
+		crawlLock.Unlock()
+		interruptCrawl(job, frontier)
+		return ErrInterrupted
+	}
+	crawlsRunning.Add(1)
+	crawlLock.Unlock()
+	defer crawlsRunning.Done()
+
+	checkpointCrawl(job, frontier)
+	if err := Crawl(cfg, store, frontier, job, meter); errors.Is(err, ErrInterrupted) {
+		interruptCrawl(job, frontier)
+		return err
+	}
+	if meter.Stopped() != nil {
+		// saved before the job counts as stopped, so it is never resumed from an older checkpoint
+		checkpointCrawl(job, frontier)
+		meter.Finish()
+		return nil
+	}
+	meter.Finish()
+	if err := database.DeleteCrawlCheckpoint(job.ID); err != nil {
+		log.Printf("Error deleting the checkpoint of job %s: %v", job.ID, err)
+	}
+	return nil
+}
+
+// checkpointCrawl saves the frontier of a running job, a job that can't be saved keeps its last checkpoint.
+func checkpointCrawl(job models.CrawlJob, frontier *Frontier) {
+	if err := database.SaveCrawlCheckpoint(frontier.Checkpoint(job.ID)); err != nil {
+		log.Printf("Error checkpointing job %s: %v", job.ID, err)
+	}
+}
+
+func interruptCrawl(job models.CrawlJob, frontier *Frontier) {
+	if err := database.InterruptCrawlJob(frontier.Checkpoint(job.ID)); err != nil {
+		log.Printf("Error checkpointing job %s, it can't be resumed: %v", job.ID, err)
+		return
+	}
+	log.Printf("Interrupted job %s with %d URLs left to visit", job.ID, len(frontier.ToVisit))
+}
+
+/*
+ResumeInterruptedCrawls continues the jobs interrupted by the last shutdown in the background.
+A job whose user is gone is stopped, one that doesn't fit the user's quota anymore stays interrupted
+until the next start.
+*/
+func ResumeInterruptedCrawls(cfg config.CrawlerConfig, store *storage.Store) {
+	jobs, err := database.GetCrawlJobsByStatus(models.CrawlJobInterrupted)
+	if err != nil {
+		log.Printf("Error loading interrupted crawl jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		go resumeCrawl(cfg, store, job)
+	}
+}
+
+func resumeCrawl(cfg config.CrawlerConfig, store *storage.Store, job models.CrawlJob) {
+	user, err := database.GetUserByID(job.UserID)
+	if err != nil {
+		log.Printf("Error resuming job %s: %v", job.ID, err)
+		return
+	}
+	if user.ID == 0 {
+		log.Printf("Not resuming job %s, its user is gone", job.ID)
+		if err := database.FinishCrawlJob(job.ID, models.CrawlJobStopped); err != nil {
+			log.Printf("Error finishing job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	checkpoint, err := database.GetCrawlCheckpoint(job.ID)
+	if err != nil {
+		log.Printf("Error loading the checkpoint of job %s: %v", job.ID, err)
+		return
+	}
+	if checkpoint == nil {
+		log.Printf("Not resuming job %s, it has no checkpoint", job.ID)
+		return
+	}
+
+	meter, err := quota.Resume(user, job)
+	if errors.Is(err, database.ErrCrawlJobNotResumable) {
+		return // another instance resumed it
+	}
+	if err != nil {
+		log.Printf("Not resuming job %s: %v", job.ID, err)
+		return
+	}
+
+	log.Printf("Resuming job %s with %d URLs left to visit", job.ID, len(checkpoint.ToVisit))
+	if err := RunCrawl(cfg, store, job, FrontierFromCheckpoint(checkpoint), meter); err == nil {
+		log.Printf("Resumed job %s is done", job.ID)
+	}
+}
+
+/*
+ShutdownCrawls stops the crawls for a shutdown of the server: no crawl starts a new fetch and the
+fetches in flight may finish until ctx is done. Then they are cancelled, closing their browsers.
+Every crawl checkpoints its frontier and visited set before ShutdownCrawls returns, unless that
+takes longer than checkpointGrace after the deadline.
+*/
+func ShutdownCrawls(ctx context.Context) error {
+	crawlLock.Lock()
+	if !draining {
+		draining = true
+		close(shuttingDown)
+	}
+	crawlLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		crawlsRunning.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	log.Println("Cancelling the page fetches still running")
+	cancelFetches()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(checkpointGrace):
+		return errors.New("crawls didn't stop in time, their jobs can't be resumed")
+	}
+}
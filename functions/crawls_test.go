@@ -0,0 +1,78 @@
+package functions
+
+import (
+	"GoGrab/config"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"errors"
+	"testing"
+	"time"
+)
+
+// shutDown closes shuttingDown for the test, as a shutdown of the server does.
+func shutDown(t *testing.T) {
+	t.Helper()
+	previous := shuttingDown
+	shuttingDown = make(chan struct{})
+	close(shuttingDown)
+	t.Cleanup(func() { shuttingDown = previous })
+}
+
+func TestCrawlStopsOnShutdownWithoutDelay(t *testing.T) {
+	shutDown(t)
+	cfg := config.CrawlerConfig{Delay: 0, PageTimeout: time.Minute, CheckpointInterval: time.Hour}
+	store := storage.New(config.StorageConfig{DataFolder: t.TempDir(), TrashFolder: t.TempDir()})
+
+	// select picks at random between ready cases, so a single run could pass by chance
+	for i := 0; i < 100; i++ {
+		frontier := NewFrontier([]string{"https://example.com/"})
+		if err := Crawl(cfg, store, frontier, models.CrawlJob{ID: "job"}, nil); !errors.Is(err, ErrInterrupted) {
+			t.Fatalf("run %d: got %v, want ErrInterrupted", i, err)
+		}
+		if len(frontier.ToVisit) != 1 || len(frontier.Visited) != 0 {
+			t.Fatalf("run %d: frontier %+v, want the URL still to visit", i, frontier)
+		}
+	}
+}
+
+func TestFrontierAdd(t *testing.T) {
+	frontier := NewFrontier([]string{"https://example.com/", "https://example.com"})
+	if len(frontier.ToVisit) != 1 {
+		t.Fatalf("ToVisit %v, want the seeds deduplicated", frontier.ToVisit)
+	}
+
+	frontier.next()
+	frontier.Visited[utils.NormalizeURL("https://example.com/")] = true
+	for _, link := range []string{"https://example.com/", "https://example.com/a", "https://example.com/b", "https://example.com/a"} {
+		frontier.Add(link)
+	}
+	if len(frontier.ToVisit) != 2 || frontier.ToVisit[0] != "https://example.com/a" || frontier.ToVisit[1] != "https://example.com/b" {
+		t.Errorf("ToVisit %v, want a and b once, without the visited page", frontier.ToVisit)
+	}
+
+	// once taken off the frontier a page is only queued again if its fetch is cancelled
+	url := frontier.next()
+	frontier.Visited[utils.NormalizeURL(url)] = true
+	if frontier.Add(url) {
+		t.Error("a page being visited was queued again")
+	}
+	frontier.requeue(url)
+	if frontier.ToVisit[0] != url || frontier.Add(url) {
+		t.Errorf("ToVisit %v, want the cancelled page first and once", frontier.ToVisit)
+	}
+}
+
+func TestFrontierFromCheckpoint(t *testing.T) {
+	checkpoint := &models.CrawlCheckpoint{
+		ToVisit: []string{"https://example.com/a", "https://example.com/b", "https://example.com/a", "https://example.com/"},
+		Visited: []string{utils.NormalizeURL("https://example.com/")},
+	}
+	frontier := FrontierFromCheckpoint(checkpoint)
+	if len(frontier.ToVisit) != 2 || frontier.Add("https://example.com/b") {
+		t.Errorf("ToVisit %v, want the duplicates and visited pages of an old checkpoint dropped", frontier.ToVisit)
+	}
+	if saved := frontier.Checkpoint("job"); len(saved.ToVisit) != 2 || len(saved.Visited) != 1 {
+		t.Errorf("checkpoint %+v, want the deduplicated frontier", saved)
+	}
+}
@@ -0,0 +1,149 @@
+package functions
+
+import (
+	"GoGrab/audit"
+	"GoGrab/config"
+	"GoGrab/database"
+	"GoGrab/export"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// JanitorStatus describes the last run of the retention janitor.
+type JanitorStatus struct {
+	Running        bool                       `json:"running"`
+	Interval       string                     `json:"interval"`
+	StartedAt      time.Time                  `json:"started_at"`
+	FinishedAt     time.Time                  `json:"finished_at"`
+	Policies       int                        `json:"policies"`
+	PagesRemoved   int                        `json:"pages_removed"`
+	TrashPurged    int                        `json:"trash_purged"`
+	ArchivesPurged int                        `json:"archives_purged"`
+	Error          string                     `json:"error,omitempty"`
+	Removed        []storage.RetentionRemoval `json:"removed"`
+}
+
+// Janitor enforces the retention policies on a store and purges its expired trash and archives.
+type Janitor struct {
+	store    *storage.Store
+	archives *export.Archives
+	interval time.Duration
+	// loadPolicies, recount and record reach the database, tests replace them
+	loadPolicies func() ([]models.RetentionPolicy, error)
+	recount      func() error
+	record       func(event models.AuditEvent)
+
+	status  JanitorStatus
+	lock    sync.Mutex // guards status
+	runLock sync.Mutex // makes sure only one janitor run happens at a time
+}
+
+// NewJanitor returns the janitor of the store and its archives, running every janitor interval of the configuration.
+func NewJanitor(cfg config.StorageConfig, store *storage.Store, archives *export.Archives) *Janitor {
+	return &Janitor{
+		store:        store,
+		archives:     archives,
+		interval:     cfg.JanitorInterval,
+		loadPolicies: database.GetRetentionPolicies,
+		recount:      store.RecountStoredBytes,
+		record:       audit.Record,
+		status:       JanitorStatus{Interval: cfg.JanitorInterval.String()},
+	}
+}
+
+/*
+Start runs the retention janitor in a background goroutine.
+It enforces the retention policies, purges the expired trash and archives and recounts the stored bytes
+of the quotas once at startup and then every janitor interval.
+*/
+func (j *Janitor) Start() {
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			j.Run()
+			<-ticker.C
+		}
+	}()
+}
+
+// Run performs a single janitor run and returns its status.
+func (j *Janitor) Run() JanitorStatus {
+	j.runLock.Lock()
+	defer j.runLock.Unlock()
+
+	j.lock.Lock()
+	status := JanitorStatus{Interval: j.status.Interval, StartedAt: time.Now()}
+	j.status.Running = true
+	j.lock.Unlock()
+
+	policies, err := j.loadPolicies()
+	if err != nil {
+		status.Error = "loading retention policies: " + err.Error()
+	} else {
+		status.Policies = len(policies)
+		removed, err := j.store.ApplyRetention(policies, status.StartedAt)
+		if err != nil {
+			status.Error = "applying retention: " + err.Error()
+		}
+		status.Removed = removed
+		status.PagesRemoved = len(removed)
+		for _, removal := range removed {
+			log.Printf("Janitor removed %s (crawled %s) under retention policy %d", removal.URL, removal.CrawledAt.Format(time.RFC3339), removal.PolicyID)
+		}
+	}
+
+	purged, err := j.store.PurgeExpiredTrash()
+	if err != nil && status.Error == "" {
+		status.Error = "purging trash: " + err.Error()
+	}
+	status.TrashPurged = purged
+
+	purged, err = j.archives.PurgeExpired()
+	if err != nil && status.Error == "" {
+		status.Error = "purging archives: " + err.Error()
+	}
+	status.ArchivesPurged = purged
+
+	// the counters are kept up to date on every write, the recount fills them after an upgrade and corrects any drift
+	if err := j.recount(); err != nil && status.Error == "" {
+		status.Error = "recounting stored bytes: " + err.Error()
+	}
+
+	status.FinishedAt = time.Now()
+	if status.Error != "" {
+		log.Printf("Janitor run failed: %s", status.Error)
+	}
+	log.Printf("Janitor run finished: %d pages removed, %d trash batches and %d archives purged", status.PagesRemoved, status.TrashPurged, status.ArchivesPurged)
+
+	// only runs that removed something or failed are worth an audit event, the janitor runs every hour
+	if status.PagesRemoved+status.TrashPurged+status.ArchivesPurged > 0 || status.Error != "" {
+		event := models.AuditEvent{
+			Action:  audit.ActionRetentionPurge,
+			Target:  "janitor",
+			Outcome: audit.OutcomeSuccess,
+			Details: fmt.Sprintf("%d pages removed, %d trash batches and %d archives purged", status.PagesRemoved, status.TrashPurged, status.ArchivesPurged),
+		}
+		if status.Error != "" {
+			event.Outcome = audit.OutcomeFailure
+			event.Details += ": " + status.Error
+		}
+		j.record(event)
+	}
+
+	j.lock.Lock()
+	j.status = status
+	j.lock.Unlock()
+	return status
+}
+
+// Status returns the status of the last janitor run.
+func (j *Janitor) Status() JanitorStatus {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.status
+}
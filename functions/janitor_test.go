@@ -0,0 +1,109 @@
+package functions
+
+import (
+	"GoGrab/audit"
+	"GoGrab/config"
+	"GoGrab/export"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestJanitor returns a janitor of empty temporary folders without policies that records its audit events in the returned slice.
+func newTestJanitor(t *testing.T) (*Janitor, config.StorageConfig, *[]models.AuditEvent) {
+	t.Helper()
+	cfg := config.StorageConfig{
+		DataFolder:       t.TempDir(),
+		TrashFolder:      t.TempDir(),
+		ArchiveFolder:    t.TempDir(),
+		TrashGracePeriod: time.Hour,
+		ArchiveTTL:       time.Hour,
+		JanitorInterval:  time.Hour,
+	}
+	store := storage.New(cfg)
+	janitor := NewJanitor(cfg, store, export.NewArchives(cfg, store))
+
+	events := &[]models.AuditEvent{}
+	janitor.loadPolicies = func() ([]models.RetentionPolicy, error) { return nil, nil }
+	janitor.recount = func() error { return nil }
+	janitor.record = func(event models.AuditEvent) { *events = append(*events, event) }
+	return janitor, cfg, events
+}
+
+func TestJanitorStatus(t *testing.T) {
+	janitor, cfg, events := newTestJanitor(t)
+	if status := janitor.Status(); status.Interval != "1h0m0s" || !status.StartedAt.IsZero() {
+		t.Errorf("got %+v before the first run, want only the interval", status)
+	}
+
+	// an expired trash batch and an archive that expired already
+	batch, err := json.Marshal(storage.TrashBatch{ID: "0abc", DeletedAt: time.Now().Add(-2 * time.Hour), ExpiresAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.TrashFolder, "0abc.json"), batch, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.ArchiveTTL = -time.Minute
+	if _, err := export.NewArchives(cfg, janitor.store).Build(1); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	janitor.loadPolicies = func() ([]models.RetentionPolicy, error) {
+		return []models.RetentionPolicy{{ID: 1, Scope: "host", Target: "example.com", KeepLast: 1}}, nil
+	}
+	recounted := false
+	janitor.recount = func() error {
+		recounted = true
+		return nil
+	}
+
+	status := janitor.Run()
+	if status.Running || status.Policies != 1 || status.PagesRemoved != 0 || status.TrashPurged != 1 || status.ArchivesPurged != 1 || status.Error != "" {
+		t.Errorf("got %+v, want 1 policy, 1 trash batch and 1 archive purged", status)
+	}
+	if status.StartedAt.IsZero() || status.FinishedAt.Before(status.StartedAt) || status.Interval != "1h0m0s" {
+		t.Errorf("got started %s, finished %s, interval %s", status.StartedAt, status.FinishedAt, status.Interval)
+	}
+	if !recounted {
+		t.Error("the stored bytes weren't recounted")
+	}
+	if !reflect.DeepEqual(janitor.Status(), status) {
+		t.Errorf("Status = %+v, want the status of the last run %+v", janitor.Status(), status)
+	}
+	if len(*events) != 1 || (*events)[0].Action != audit.ActionRetentionPurge || (*events)[0].Outcome != audit.OutcomeSuccess {
+		t.Errorf("got audit events %+v, want one successful purge", *events)
+	}
+
+	// nothing left to purge, a quiet run isn't audited
+	if status := janitor.Run(); status.TrashPurged != 0 || status.ArchivesPurged != 0 || status.Error != "" {
+		t.Errorf("got %+v on the second run, want nothing purged", status)
+	}
+	if len(*events) != 1 {
+		t.Errorf("got %d audit events, want the quiet run left out", len(*events))
+	}
+}
+
+func TestJanitorStatusError(t *testing.T) {
+	janitor, _, events := newTestJanitor(t)
+	janitor.loadPolicies = func() ([]models.RetentionPolicy, error) { return nil, errors.New("database down") }
+	janitor.recount = func() error { return errors.New("recount failed") }
+
+	// the first error is reported, the other steps still run
+	status := janitor.Run()
+	if status.Error != "loading retention policies: database down" || status.Policies != 0 {
+		t.Errorf("got %+v, want the policies error", status)
+	}
+	if len(*events) != 1 || (*events)[0].Outcome != audit.OutcomeFailure || !strings.Contains((*events)[0].Details, "database down") {
+		t.Errorf("got audit events %+v, want the failed run recorded", *events)
+	}
+	if janitor.Status().Error != status.Error {
+		t.Errorf("Status = %+v, want the error of the last run", janitor.Status())
+	}
+}
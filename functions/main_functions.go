@@ -1,91 +1,111 @@
 package functions
 
 import (
+	"GoGrab/config"
 	"GoGrab/models"
+	"GoGrab/quota"
+	"GoGrab/storage"
 	"GoGrab/utils"
 	"context"
 	"fmt"
 	"log"
 	"net/url"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
 
-var (
-	visited   = make(map[string]bool) // keeps track of visited URLs
-	visitLock sync.Mutex              // here using mutex i.e ensuring that only one goroutine at a time to access a shared resource at him
-)
-
 /*
-	 	Crawl initiates a web crawling process starting from the base URL. It visits the URL, extracts links from it, and adds
-		them to the visit queue if the haven't been visited yet. The function also uses locking to ensure thread-safe operations
-		when managing list of visited URLs.
+	 	Crawl visits the URLs of the frontier starting with its first one. It visits a URL, extracts links from it, and adds
+		them to the frontier if they haven't been visited or queued yet. Every saved page is tagged with the crawl job it belongs to.
+		The meter is asked before every fetch, the crawl stops once the user's quota is used up.
+		The delay between fetches and the page timeout come from the crawler configuration.
+		When the server shuts down no further fetch is started and ErrInterrupted is returned, the frontier
+		then holds exactly what is left to do, including a fetch cancelled by the shutdown deadline.
+		The frontier is checkpointed every CheckpointInterval, so a crash only repeats the fetches since then.
 */
-func Crawl(baseURL string) {
-	toVisit := []string{baseURL}     // List of URLs to visit
-	visitLock := sync.Mutex{}        // Mutex to ensure safe access to the visited map
-	visited := make(map[string]bool) // Tracks visited URLs
-	var wg sync.WaitGroup            // WaitGroup to manage concurent goroutines
+func Crawl(cfg config.CrawlerConfig, store *storage.Store, frontier *Frontier, job models.CrawlJob, meter *quota.Meter) error {
+	lastCheckpoint := time.Now()
+	for len(frontier.ToVisit) > 0 {
+		url := frontier.ToVisit[0] // Get the next URL to visit
+
+		// Save the frontier once the checkpoint interval has passed
+		if time.Since(lastCheckpoint) >= cfg.CheckpointInterval {
+			checkpointCrawl(job, frontier)
+			lastCheckpoint = time.Now()
+		}
 
-	for len(toVisit) > 0 {
-		url := toVisit[0]     // Get the next URL to visit
-		toVisit = toVisit[1:] // Remove the URL from the visit list
+		// Stop the crawl once the user's quota is used up
+		if err := meter.Allow(); err != nil {
+			log.Printf("Stopping job %s: %v", job.ID, err)
+			return nil
+		}
 
-		// Adding a delay to avoid overloading the target site
-		time.Sleep(1 * time.Second)
+		// Adding a delay to avoid overloading the target site, a shutdown doesn't wait for it
+		select {
+		case <-time.After(cfg.Delay):
+		case <-shuttingDown:
+			return ErrInterrupted
+		}
+		// without a delay both cases above can be ready and select picks one at random, so check again
+		select {
+		case <-shuttingDown:
+			return ErrInterrupted
+		default:
+		}
+		frontier.next() // Remove the URL from the visit list
 
 		// Normalize the URL to ensure consistent comparisons
 		normalizedURL := utils.NormalizeURL(url)
-
-		// Lock the visitLock to check and update the visited map safely
-		visitLock.Lock()
-		if visited[normalizedURL] {
-			visitLock.Unlock()
+		if frontier.Visited[normalizedURL] {
 			continue // Skip the URL if it has already been visited
 		}
-		visited[normalizedURL] = true // Mark the URL as visited
-		visitLock.Unlock()
+		frontier.Visited[normalizedURL] = true // Mark the URL as visited
 
 		// Log the fetching process
 		fmt.Println("Fetching:", url)
 
 		// Scrape the URL and extract links from the page
-		links, err := ScrapeAndExtractLinks(url)
+		links, err := ScrapeAndExtractLinks(cfg, store, url, job, meter)
+		if err != nil && fetchContext.Err() != nil {
+			// the shutdown deadline cancelled the fetch, it is done again when the job resumes
+			frontier.requeue(url)
+			return ErrInterrupted
+		}
 		if err != nil {
 			// Log the error if scraping fails
 			log.Printf("Error scraping %s: %v\n", url, err)
 			continue
 		}
 
-		// Process each extracted link
+		// Add the links that weren't visited or queued yet to the visit list
 		for _, link := range links {
-			normalizedLink := utils.NormalizeURL(link)
-			visitLock.Lock()
-			if !visited[normalizedLink] {
-				toVisit = append(toVisit, link) // Add new links to the visit list
-			}
-			visitLock.Unlock()
+			frontier.Add(link)
 		}
 	}
-	// Wait for all goroutines to finish before exiting
-	wg.Wait()
+	return nil
 }
 
 /*
 ScrapeAndExtractLinks scrapes a given page URL, extracts its content and internal links.
 It uses Chrome DevTools Protocol (CDP) to navigate the page, block unnecessary assets, and extract both text and links.
+The browser time and the saved page are metered, also when the fetch fails.
 */
-func ScrapeAndExtractLinks(pageURL string) ([]string, error) {
-	// Create a new browser context for the scraping task
-	ctx, cancel := chromedp.NewContext(context.Background())
+func ScrapeAndExtractLinks(cfg config.CrawlerConfig, store *storage.Store, pageURL string, job models.CrawlJob, meter *quota.Meter) ([]string, error) {
+	// Meter the browser time and what is saved once the fetch is done
+	started := time.Now()
+	var savedPages int
+	var savedBytes int64
+	defer func() { meter.Record(savedPages, savedBytes, time.Since(started)) }()
+
+	// Create a new browser for the scraping task, a shutdown that runs out of time closes it
+	ctx, cancel := chromedp.NewContext(fetchContext)
 	defer cancel()
 
 	// Set a timeout for the scraping operation
-	ctx, cancel = context.WithTimeout(ctx, 1*time.Minute)
+	ctx, cancel = context.WithTimeout(ctx, cfg.PageTimeout)
 	defer cancel()
 
 	var pageTitle, textContent string
@@ -108,17 +128,6 @@ func ScrapeAndExtractLinks(pageURL string) ([]string, error) {
 	finalText = utils.RemoveBlankLines(finalText)
 	finalText = utils.RemoveExtraSpaces(finalText)
 
-	// Create a PageData model and save the extracted data to a file
-	pageData := models.PageData{
-		Title:   pageTitle,
-		URL:     pageURL,
-		Content: finalText,
-	}
-	// Save the scraped page content to a file using the utility function
-	if err := utils.SavePageToFile(pageData); err != nil {
-		return nil, err
-	}
-
 	// Extract all links (<a> tags) from the page using CDP
 	var links []string
 	err = chromedp.Run(ctx,
@@ -128,6 +137,23 @@ func ScrapeAndExtractLinks(pageURL string) ([]string, error) {
 		// Return an error if link extraction fails
 		return nil, fmt.Errorf("error extracting links from %s: %v", pageURL, err)
 	}
+
+	// Create a PageData model with all the links found on the page and save it to a file
+	pageData := models.PageData{
+		Title:          pageTitle,
+		URL:            pageURL,
+		Content:        finalText,
+		Links:          links,
+		JobID:          job.ID,
+		UserID:         job.UserID,
+		OrganizationID: job.OrganizationID,
+		CrawledAt:      time.Now(),
+	}
+	// Save the scraped page content to a file using the storage package
+	if err := store.SavePageToFile(pageData); err != nil {
+		return nil, err
+	}
+	savedPages, savedBytes = 1, storage.PageSize(pageData)
 	// Parse the base URL to extract the hostname
 	base, err := url.Parse(pageURL)
 	if err != nil {
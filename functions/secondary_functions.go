@@ -1,13 +1,14 @@
 package functions
 
 import (
+	"GoGrab/config"
 	"GoGrab/database"
 	"log"
 )
 
-func CheckDatabaseConnection() {
+func CheckDatabaseConnection(cfg config.DatabaseConfig) {
 	// Attempt to connect to the database using the Connect function from the database package
-	db, err := database.Connect()
+	db, err := database.Connect(cfg)
 	if err != nil {
 		// If the connection fails, log a fatal error and exit the program
 		log.Fatalf("Failed to connect to the database: %v", err)
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeysHandler godoc
+// @Summary Lists or creates the user's API keys
+// @Description GET lists the active API keys of the logged in user. POST creates a key with a name, scopes (crawl, read-data, delete-data) and an optional expiry in days; the key itself is only returned in this response.
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param key body object false "{\"name\": \"ci\", \"scopes\": [\"crawl\"], \"expires_in_days\": 90} (POST only)"
+// @Success 200 {array} models.APIKey
+// @Success 201 {object} map[string]interface{} "key and api_key"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/api-keys [get]
+// @Router /api/v1/api-keys [post]
+
+func APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := database.GetUserAPIKeys(user.ID)
+		if err != nil {
+			log.Printf("Error loading API keys: %v", err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if keys == nil {
+			keys = []models.APIKey{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+
+	case http.MethodPost:
+		createAPIKey(w, r, user)
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func createAPIKey(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var request struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 255 {
+		utils.WriteError(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if len(request.Scopes) == 0 {
+		utils.WriteError(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !auth.ValidScope(scope) {
+			utils.WriteError(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+	if request.ExpiresInDays < 0 {
+		utils.WriteError(w, "expires_in_days must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	// no expiry means the key is valid until it is revoked
+	var expiresAt *time.Time
+	if request.ExpiresInDays > 0 {
+		expiration := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &expiration
+	}
+
+	rawKey, key, err := auth.CreateAPIKey(user.ID, request.Name, request.Scopes, expiresAt)
+	if err != nil {
+		log.Printf("Error creating API key: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":     rawKey,
+		"api_key": key,
+	})
+}
+
+// APIKeyHandler godoc
+// @Summary Revokes an API key
+// @Description Revokes one of the logged in user's API keys, it can't be used anymore afterwards.
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]string "API key revoked"
+// @Failure 400 {object} utils.ErrorResponse "Invalid API key ID"
+// @Failure 404 {object} utils.ErrorResponse "API key not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/api-keys/{id} [delete]
+
+func APIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := database.RevokeAPIKey(user.ID, id)
+	if err != nil {
+		log.Printf("Error revoking API key %d: %v", id, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		utils.WriteError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked"})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/export"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ArchivesHandler godoc
+// @Summary Lists or builds prebuilt ZIP archives
+// @Description GET lists the prebuilt archives of the scraped data. POST builds a new archive, with the same content and manifest.json as /api/v1/data, that can be downloaded with range requests until it expires. Archives contain every workspace, so they need the data:read:any permission; building one also needs crawl:create.
+// @Tags Scraping
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} export.Archive
+// @Success 201 {object} export.Archive
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Failed to build archive"
+// @Router /api/v1/archives [get]
+// @Router /api/v1/archives [post]
+
+func ArchivesHandler(archives *export.Archives) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireAllWorkspaces(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			list, err := archives.List()
+			if err != nil {
+				log.Printf("Error listing archives: %v", err)
+				utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(list)
+
+		case http.MethodPost:
+			user, err := middleware.GetUserFromContext(r.Context())
+			if err != nil {
+				utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			archive, err := archives.Build(user.ID)
+			if err != nil {
+				log.Printf("Error building archive: %v", err)
+				utils.WriteError(w, "Failed to build archive", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(archive)
+
+		default:
+			utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// ArchiveHandler godoc
+// @Summary Downloads or deletes a prebuilt ZIP archive
+// @Description GET downloads the archive. Range and If-Range requests are supported, the ETag is the SHA-256 hash of the archive. DELETE removes it, it needs data:delete and is allowed for its creator and for users with the data:delete:any permission.
+// @Tags Scraping
+// @Security BearerAuth
+// @Produce application/zip
+// @Param id path string true "Archive ID"
+// @Success 200 {file} file "ZIP file containing scraped data"
+// @Success 206 {file} file "Requested range of the ZIP file"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Archive not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Router /api/v1/archives/{id} [get]
+// @Router /api/v1/archives/{id} [delete]
+
+func ArchiveHandler(archives *export.Archives) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireAllWorkspaces(w, r) {
+			return
+		}
+		id := r.PathValue("id")
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			file, archive, err := archives.Open(id)
+			if errors.Is(err, export.ErrArchiveNotFound) {
+				utils.WriteError(w, "Archive not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("Error opening archive %s: %v", id, err)
+				utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			defer file.Close()
+
+			// a download resumed with range requests is recorded once, when it starts
+			if r.Method == http.MethodGet && (r.Header.Get("Range") == "" || strings.HasPrefix(r.Header.Get("Range"), "bytes=0-")) {
+				recordAudit(r, models.AuditEvent{Action: audit.ActionDataDownload, Target: "archive:" + archive.ID, Outcome: audit.OutcomeSuccess})
+			}
+
+			// ServeContent takes care of Range, If-Range and HEAD requests
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Disposition", `attachment; filename="scraped_data_`+archive.ID+`.zip"`)
+			w.Header().Set("ETag", `"`+archive.SHA256+`"`)
+			http.ServeContent(w, r, "", archive.CreatedAt, file)
+
+		case http.MethodDelete:
+			user, err := middleware.GetUserFromContext(r.Context())
+			if err != nil {
+				utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			archive, err := archives.Get(id)
+			if errors.Is(err, export.ErrArchiveNotFound) {
+				utils.WriteError(w, "Archive not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("Error reading archive %s: %v", id, err)
+				utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if archive.CreatedBy != user.ID && !auth.HasPermission(user.Role, models.PermDataDeleteAny) {
+				utils.WriteError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			if err := archives.Delete(id); err != nil && !errors.Is(err, export.ErrArchiveNotFound) {
+				log.Printf("Error deleting archive %s: %v", id, err)
+				utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			recordAudit(r, models.AuditEvent{Action: audit.ActionDataDelete, ActorID: user.ID, Target: "archive:" + id, Outcome: audit.OutcomeSuccess})
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Archive deleted"})
+
+		default:
+			utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// requireAllWorkspaces answers with 403 unless the request works on every workspace, which archives of the raw host files need.
+func requireAllWorkspaces(w http.ResponseWriter, r *http.Request) bool {
+	if !middleware.GetWorkspaceFromContext(r.Context()).All {
+		utils.WriteError(w, "Forbidden: Archives contain every workspace and need data:read:any", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"GoGrab/config"
+	"GoGrab/export"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestArchives returns the archives of a store with a single host file, kept in temporary folders for ttl.
+func newTestArchives(t *testing.T, ttl time.Duration) *export.Archives {
+	t.Helper()
+	cfg := config.StorageConfig{DataFolder: t.TempDir(), TrashFolder: t.TempDir(), ArchiveFolder: t.TempDir(), ArchiveTTL: ttl}
+	pages := []models.PageData{{URL: "https://example.com/", Title: "Home", Content: "hello", UserID: 1, CrawledAt: time.Now()}}
+	content, err := json.Marshal(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.DataFolder, "example.com.json"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return export.NewArchives(cfg, storage.New(cfg))
+}
+
+// archiveRequest returns a request of user 1 working on every workspace, as RequireWorkspace resolves it for admins.
+func archiveRequest(method, id string, header http.Header) *http.Request {
+	r := httptest.NewRequest(method, "/api/v1/archives/"+id, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	r.SetPathValue("id", id)
+	ctx := middleware.SetUserInContext(r.Context(), &models.User{ID: 1, Username: "admin", Role: "admin"})
+	return r.WithContext(middleware.SetWorkspaceInContext(ctx, models.Workspace{All: true}))
+}
+
+// buildArchive builds an archive through ArchivesHandler and returns it.
+func buildArchive(t *testing.T, archives *export.Archives) export.Archive {
+	t.Helper()
+	w := httptest.NewRecorder()
+	ArchivesHandler(archives)(w, archiveRequest(http.MethodPost, "", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /api/v1/archives: got %d %s, want 201", w.Code, w.Body)
+	}
+	var archive export.Archive
+	if err := json.NewDecoder(w.Body).Decode(&archive); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+// archiveContent returns the content of an archive that hasn't expired.
+func archiveContent(t *testing.T, archives *export.Archives, id string) []byte {
+	t.Helper()
+	file, _, err := archives.Open(id)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestArchiveDownloadRange(t *testing.T) {
+	// the downloads skip the first byte, a download starting there records an audit event, which needs the database
+	archives := newTestArchives(t, time.Hour)
+	archive := buildArchive(t, archives)
+	content := archiveContent(t, archives, archive.ID)
+	etag := `"` + archive.SHA256 + `"`
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+		body   []byte
+	}{
+		{"range", http.Header{"Range": {"bytes=10-19"}}, http.StatusPartialContent, content[10:20]},
+		{"open range", http.Header{"Range": {"bytes=100-"}}, http.StatusPartialContent, content[100:]},
+		{"suffix range", http.Header{"Range": {"bytes=-16"}}, http.StatusPartialContent, content[len(content)-16:]},
+		{"if-range with the etag", http.Header{"Range": {"bytes=10-19"}, "If-Range": {etag}}, http.StatusPartialContent, content[10:20]},
+		{"if-range with another etag", http.Header{"Range": {"bytes=10-19"}, "If-Range": {`"stale"`}}, http.StatusOK, content},
+		{"range past the end", http.Header{"Range": {"bytes=" + strconv.Itoa(len(content)) + "-"}}, http.StatusRequestedRangeNotSatisfiable, nil},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		ArchiveHandler(archives)(w, archiveRequest(http.MethodGet, archive.ID, test.header))
+		if w.Code != test.status {
+			t.Errorf("%s: got %d, want %d", test.name, w.Code, test.status)
+			continue
+		}
+		if test.body != nil && w.Body.String() != string(test.body) {
+			t.Errorf("%s: got %d bytes, want %d", test.name, w.Body.Len(), len(test.body))
+		}
+		if test.status != http.StatusRequestedRangeNotSatisfiable && w.Header().Get("ETag") != etag {
+			t.Errorf("%s: got ETag %q, want %q", test.name, w.Header().Get("ETag"), etag)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	ArchiveHandler(archives)(w, archiveRequest(http.MethodGet, archive.ID, http.Header{"Range": {"bytes=10-19"}}))
+	if want := "bytes 10-19/" + strconv.Itoa(len(content)); w.Header().Get("Content-Range") != want {
+		t.Errorf("got Content-Range %q, want %q", w.Header().Get("Content-Range"), want)
+	}
+}
+
+func TestArchiveHead(t *testing.T) {
+	archives := newTestArchives(t, time.Hour)
+	archive := buildArchive(t, archives)
+	content := archiveContent(t, archives, archive.ID)
+
+	w := httptest.NewRecorder()
+	ArchiveHandler(archives)(w, archiveRequest(http.MethodHead, archive.ID, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Length") != strconv.Itoa(len(content)) || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("got %d with headers %v, want the length %d and byte ranges", w.Code, w.Header(), len(content))
+	}
+	if w.Header().Get("Content-Type") != "application/zip" {
+		t.Errorf("got Content-Type %q", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestArchiveExpired(t *testing.T) {
+	// a negative TTL builds archives that have expired already
+	archives := newTestArchives(t, -time.Minute)
+	archive := buildArchive(t, archives)
+
+	w := httptest.NewRecorder()
+	ArchiveHandler(archives)(w, archiveRequest(http.MethodGet, archive.ID, http.Header{"Range": {"bytes=10-19"}}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got %d, want 404 for an expired archive", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	ArchivesHandler(archives)(w, archiveRequest(http.MethodGet, "", nil))
+	var list []export.Archive
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil || len(list) != 0 {
+		t.Errorf("got %v, %v, want expired archives left out of the list", list, err)
+	}
+}
+
+func TestArchiveNotFound(t *testing.T) {
+	archives := newTestArchives(t, time.Hour)
+	for _, id := range []string{"0123abcd", "..%2fsecret"} {
+		w := httptest.NewRecorder()
+		ArchiveHandler(archives)(w, archiveRequest(http.MethodGet, id, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", id, w.Code)
+		}
+	}
+}
+
+func TestArchivesNeedEveryWorkspace(t *testing.T) {
+	archives := newTestArchives(t, time.Hour)
+	r := archiveRequest(http.MethodPost, "", nil)
+	r = r.WithContext(middleware.SetWorkspaceInContext(r.Context(), models.Workspace{}))
+
+	w := httptest.NewRecorder()
+	ArchivesHandler(archives)(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got %d, want 403 in the personal workspace", w.Code)
+	}
+	if list, err := archives.List(); err != nil || len(list) != 0 {
+		t.Errorf("got %v, %v, want no archive built", list, err)
+	}
+}
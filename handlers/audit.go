@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"GoGrab/audit"
+	"GoGrab/database"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// AuditEventsHandler godoc
+// @Summary Queries the audit log
+// @Description Lists the audit events matching the filters, newest first, with limit and offset paging. With format=ndjson (or Accept: application/x-ndjson) every matching event is streamed oldest first as newline-delimited JSON, for archiving or a SIEM. Each event carries the hash of the event before it, see /api/v1/audit/verify.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Produce application/x-ndjson
+// @Param action query string false "Action, e.g. login.failure"
+// @Param actor_id query int false "User ID of the actor"
+// @Param ip query string false "Client IP"
+// @Param request_id query string false "Request ID"
+// @Param target query string false "Part of the target"
+// @Param outcome query string false "success, failure or denied"
+// @Param since query string false "RFC 3339 timestamp"
+// @Param until query string false "RFC 3339 timestamp"
+// @Param limit query int false "Page size, 100 by default and at most 1000"
+// @Param offset query int false "Number of events to skip"
+// @Param format query string false "json (default) or ndjson"
+// @Success 200 {object} map[string]interface{} "total and events"
+// @Failure 400 {object} utils.ErrorResponse "Invalid query parameter"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/audit [get]
+
+func AuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := database.AuditFilter{
+		Action:    query.Get("action"),
+		IP:        query.Get("ip"),
+		RequestID: query.Get("request_id"),
+		Target:    query.Get("target"),
+		Outcome:   query.Get("outcome"),
+		Limit:     defaultAuditPageSize,
+	}
+	var err error
+	if value := query.Get("actor_id"); value != "" {
+		if filter.ActorID, err = strconv.Atoi(value); err != nil {
+			utils.WriteError(w, "Invalid actor_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("since"); value != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, value); err != nil {
+			utils.WriteError(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, value); err != nil {
+			utils.WriteError(w, "until must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+
+	format := query.Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		format = "ndjson"
+	}
+	switch format {
+	case "ndjson":
+		exportAuditEvents(w, filter)
+		return
+	case "", "json":
+	default:
+		utils.WriteError(w, "format must be json or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditPageSize {
+			utils.WriteError(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			utils.WriteError(w, "Invalid offset parameter", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	events, total, err := database.SearchAuditEvents(filter)
+	if err != nil {
+		log.Printf("Error searching audit events: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":  total,
+		"events": events,
+	})
+}
+
+// exportAuditEvents streams the matching events as NDJSON. Once the first event is written
+// errors can only be logged, the client notices the cut off stream.
+func exportAuditEvents(w http.ResponseWriter, filter database.AuditFilter) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+
+	encoder := json.NewEncoder(w)
+	err := database.EachAuditEvent(filter, func(event models.AuditEvent) error {
+		return encoder.Encode(event)
+	})
+	if err != nil {
+		log.Printf("Error exporting audit events: %v", err)
+	}
+}
+
+// AuditVerifyHandler godoc
+// @Summary Verifies the audit log
+// @Description Walks the hash chain of the audit log and reports the first event that was removed, changed or cut off.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} audit.Verification
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/audit/verify [get]
+
+func AuditVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := audit.Verify()
+	if err != nil {
+		log.Printf("Error verifying the audit log: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// recordAudit records an event of the request, with its IP, request ID and, unless set, the authenticated user as actor.
+func recordAudit(r *http.Request, event models.AuditEvent) {
+	if event.ActorID == 0 {
+		if user, err := middleware.GetUserFromContext(r.Context()); err == nil {
+			event.ActorID = user.ID
+		}
+	}
+	event.IP = utils.ClientIP(r)
+	event.RequestID = audit.RequestID(r.Context())
+	audit.Record(event)
+}
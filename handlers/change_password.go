@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChangePasswordHandler godoc
+// @Summary Changes a user's password
+// @Description Changes the password of a user given the current one, this is also how a password reset forced by an admin is completed. The new password has to meet the password policy. All sessions of the user are revoked afterwards.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param password body object true "{\"username\": \"...\", \"old_password\": \"...\", \"new_password\": \"...\"}"
+// @Success 200 {object} map[string]string "Password changed"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload, missing fields or password refused by the policy"
+// @Failure 401 {object} utils.ErrorResponse "Invalid credentials"
+// @Failure 403 {object} utils.ErrorResponse "Account is locked"
+// @Failure 429 {object} utils.ErrorResponse "Too many failed logins"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/change-password [post]
+
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Username    string `json:"username"`
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if request.Username == "" || request.OldPassword == "" || request.NewPassword == "" {
+		utils.WriteError(w, "Username, old and new password are required", http.StatusBadRequest)
+		return
+	}
+	if request.NewPassword == request.OldPassword {
+		utils.WriteError(w, "The new password must differ from the old one", http.StatusBadRequest)
+		return
+	}
+
+	// the same checks as a login, including the backoff after failed attempts
+	ip := utils.ClientIP(r)
+	if loginThrottled(w, request.Username, ip) {
+		return
+	}
+	user, err := database.GetUserByUsername(request.Username)
+	if err != nil || user.ID == 0 || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.OldPassword)) != nil {
+		recordLoginFailure(r, request.Username, ip, "invalid credentials")
+		utils.WriteError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err := auth.RecordLoginSuccess(request.Username); err != nil {
+		log.Printf("Error clearing failed logins of %s: %v", request.Username, err)
+	}
+	if user.LockedAt != nil {
+		utils.WriteError(w, "Account is locked", http.StatusForbidden)
+		return
+	}
+
+	if !setPassword(w, user, request.NewPassword) {
+		return
+	}
+
+	// whoever knew the old password is logged out everywhere
+	if _, err := auth.RevokeAllSessions(user.ID); err != nil {
+		log.Printf("Error revoking sessions of user %d: %v", user.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed"})
+}
+
+// MyPasswordHandler godoc
+// @Summary Changes the password of the logged in user
+// @Description Changes the password of the logged in user given the current one. The new password has to meet the password policy; all other sessions of the user are revoked, the current one stays logged in.
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param password body object true "{\"current_password\": \"...\", \"new_password\": \"...\"}"
+// @Success 200 {object} map[string]interface{} "message and revoked_sessions"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or password refused by the policy"
+// @Failure 401 {object} utils.ErrorResponse "Invalid credentials"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 409 {object} utils.ErrorResponse "Password is managed by the directory or identity provider"
+// @Failure 429 {object} utils.ErrorResponse "Too many failed logins"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/me/password [post]
+
+func MyPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	current, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if request.CurrentPassword == "" || request.NewPassword == "" {
+		utils.WriteError(w, "Current and new password are required", http.StatusBadRequest)
+		return
+	}
+	if request.NewPassword == request.CurrentPassword {
+		utils.WriteError(w, "The new password must differ from the old one", http.StatusBadRequest)
+		return
+	}
+
+	user, err := database.GetUserByID(current.ID)
+	if err != nil || user.ID == 0 {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !hasLocalPassword(w, user) {
+		return
+	}
+
+	// a stolen session must not be enough to guess the password, so failures count like failed logins
+	ip := utils.ClientIP(r)
+	if loginThrottled(w, user.Username, ip) {
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.CurrentPassword)) != nil {
+		recordLoginFailure(r, user.Username, ip, "invalid current password")
+		utils.WriteError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if !setPassword(w, user, request.NewPassword) {
+		return
+	}
+
+	revoked, err := auth.RevokeOtherSessions(user.ID, middleware.GetSessionIDFromContext(r.Context()))
+	if err != nil {
+		log.Printf("Error revoking sessions of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Password changed",
+		"revoked_sessions": revoked,
+	})
+}
+
+// PasswordResetHandler godoc
+// @Summary Sets a new password with a reset token
+// @Description Redeems a one-time password reset token issued by an admin and sets a new password, which has to meet the password policy. All sessions of the user are revoked.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param reset body object true "{\"token\": \"...\", \"new_password\": \"...\"}"
+// @Success 200 {object} map[string]string "Password changed"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload, invalid token or password refused by the policy"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/password-reset [post]
+
+func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" || request.NewPassword == "" {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := auth.RedeemPasswordResetToken(request.Token, request.NewPassword)
+	switch {
+	case errors.Is(err, auth.ErrInvalidResetToken):
+		utils.WriteError(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrWeakPassword):
+		utils.WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error resetting password: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed"})
+}
+
+// setPassword stores a new password for the user, answering with 400 if the policy refuses it.
+func setPassword(w http.ResponseWriter, user *models.User, password string) bool {
+	err := auth.SetPassword(user.ID, user.Username, password)
+	if errors.Is(err, auth.ErrWeakPassword) {
+		utils.WriteError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error updating password of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// hasLocalPassword answers with 409 for users whose password is checked by LDAP or an identity provider.
+func hasLocalPassword(w http.ResponseWriter, user *models.User) bool {
+	if user.AuthSource != "" && user.AuthSource != models.AuthSourceLocal {
+		utils.WriteError(w, "Password is managed by "+user.AuthSource, http.StatusConflict)
+		return false
+	}
+	return true
+}
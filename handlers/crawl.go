@@ -1,56 +1,219 @@
 package handlers
 
 import (
+	"GoGrab/audit"
+	"GoGrab/config"
+	"GoGrab/database"
 	"GoGrab/functions"
+	"GoGrab/middleware"
 	"GoGrab/models"
+	"GoGrab/quota"
+	"GoGrab/storage"
+	"GoGrab/utils"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
 )
 
 // StartCrawlHandler godoc
 // @Summary Starts a web crawl process
-// @Description Initiates a web scraping process by accepting a list of URLs.
+// @Description Initiates a web scraping process by accepting a list of URLs. All pages saved by the crawl are tagged with a new job ID and belong to the workspace of the request: the organization of X-Organization-ID, which needs at least the member role, or the user's personal workspace. The job has to fit the user's quota of concurrent jobs, pages per day, browser minutes and storage, and stops when the quota is used up while it runs. A shutdown of the server interrupts the job, which resumes on the next start. A job stopped by the quota or by a crash can be resumed with POST /api/v1/crawl/{id}/resume.
 // @Tags Crawling
 // @Accept json
 // @Produce json
 // @Param request body models.URLDatastruct true "List of URLs to crawl"
+// @Param X-Organization-ID header int false "Organization to crawl for"
 // @Success 200 {string} string "Crawling completed"
-// @Failure 400 {string} string "Invalid request payload"
-// @Failure 405 {string} string "Invalid request method"
-// @Router /api/crawl [post]
-
-func StartCrawlHandler(w http.ResponseWriter, r *http.Request) {
-	// writing response that the crawling process has started
-	w.Write([]byte("Crawling started"))
-
-	// check if the request method is POST
-	if r.Method != http.MethodPost {
-		// If the request method is not POST, return a 405 method not allowed error
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 403 {object} utils.ErrorResponse "Not a member or only a viewer of the organization"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 429 {object} utils.ErrorResponse "Quota exceeded"
+// @Failure 503 {object} utils.ErrorResponse "The server is shutting down"
+// @Router /api/v1/crawl [post]
 
-	// a variable to store the request payload (list of URLs to crawl)
-	var requestData models.URLDatastruct
+func StartCrawlHandler(cfg config.CrawlerConfig, store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// a variable to store the request payload (list of URLs to crawl)
+		var requestData models.URLDatastruct
 
-	// decode the incoming JSON request body into the requestData struct
-	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-		// if there is an error in decoding e.g., invalid JSON, return a 400 bad request error
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
+		// decode the incoming JSON request body into the requestData struct
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			// if there is an error in decoding e.g., invalid JSON, return a 400 bad request error
+			utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		// close the request body when the function completes to free resources
+		defer r.Body.Close()
+
+		// retrieve the authenticated user, the crawl job belongs to them
+		user, err := middleware.GetUserFromContext(r.Context())
+		if err != nil {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// the crawl belongs to the workspace of the request, viewers of an organization can't crawl for it
+		workspace := middleware.GetWorkspaceFromContext(r.Context())
+		if !workspace.Allows(models.OrgRoleMember) {
+			utils.WriteError(w, "Forbidden: Viewers can't crawl for this organization", http.StatusForbidden)
+			return
+		}
+
+		// generate the job ID that tags every page saved by this crawl
+		jobID, err := utils.GenerateID()
+		if err != nil {
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		job := models.CrawlJob{ID: jobID, UserID: user.ID, OrganizationID: workspace.OrganizationID}
+		event := models.AuditEvent{
+			Action:  audit.ActionCrawlSubmit,
+			Target:  "job:" + job.ID,
+			Outcome: audit.OutcomeSuccess,
+			Details: fmt.Sprintf("organization %d, urls %s", job.OrganizationID, strings.Join(requestData.URLs, " ")),
+		}
+
+		// no new jobs while the server shuts down
+		if !functions.AcceptingCrawls() {
+			w.Header().Set("Retry-After", "60")
+			utils.WriteError(w, "The server is shutting down, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		// the job only starts within the user's quota, it counts as running until it is finished
+		meter, err := quota.Begin(user, job)
+		if errors.Is(err, quota.ErrQuotaExceeded) {
+			event.Outcome = audit.OutcomeDenied
+			event.Details = err.Error() + ", " + event.Details
+			recordAudit(r, event)
+			utils.WriteError(w, "Quota exceeded: "+strings.TrimPrefix(err.Error(), quota.ErrQuotaExceeded.Error()+": "), http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking the quota of user %d: %v", user.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit(r, event)
+
+		// writing response that the crawling process has started
+		w.Write([]byte("Crawling started"))
+		w.Write([]byte("\nJob ID: " + job.ID + "\n"))
+
+		// crawl the URLs provided in the request with the crawl function from the functions package
+		runCrawl(w, cfg, store, job, functions.NewFrontier(requestData.URLs), meter)
 	}
+}
+
+// ResumeCrawlHandler godoc
+// @Summary Resumes a crawl job
+// @Description Continues a crawl job of the current user from its last checkpoint: the URLs it still had to visit and the ones it already visited. Jobs interrupted by a shutdown, stopped by the quota or left running by a crashed server (no page for 10 minutes) can be resumed, a crash repeats the fetches since the last checkpoint. The request must be made in the workspace the job was submitted for, and the job has to fit the user's quota like a new one.
+// @Tags Crawling
+// @Produce json
+// @Param id path string true "Job ID"
+// @Param X-Organization-ID header int false "Organization the job was submitted for"
+// @Success 200 {string} string "Crawling completed"
+// @Failure 403 {object} utils.ErrorResponse "Not a member or only a viewer of the organization"
+// @Failure 404 {object} utils.ErrorResponse "Crawl job not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 409 {object} utils.ErrorResponse "The job is finished, still running or has no checkpoint"
+// @Failure 429 {object} utils.ErrorResponse "Quota exceeded"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Failure 503 {object} utils.ErrorResponse "The server is shutting down"
+// @Router /api/v1/crawl/{id}/resume [post]
+
+func ResumeCrawlHandler(cfg config.CrawlerConfig, store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := middleware.GetUserFromContext(r.Context())
+		if err != nil {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		workspace := middleware.GetWorkspaceFromContext(r.Context())
+		if !workspace.Allows(models.OrgRoleMember) {
+			utils.WriteError(w, "Forbidden: Viewers can't crawl for this organization", http.StatusForbidden)
+			return
+		}
+
+		// only the user who submitted the job resumes it, in the workspace it was submitted for
+		jobID := r.PathValue("id")
+		job, err := database.GetCrawlJob(jobID)
+		if err != nil {
+			log.Printf("Error loading job %s: %v", jobID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if job == nil || job.UserID != user.ID || job.OrganizationID != workspace.OrganizationID {
+			utils.WriteError(w, "Crawl job not found", http.StatusNotFound)
+			return
+		}
+
+		checkpoint, err := database.GetCrawlCheckpoint(job.ID)
+		if err != nil {
+			log.Printf("Error loading the checkpoint of job %s: %v", job.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if checkpoint == nil {
+			utils.WriteError(w, "Crawl job has no checkpoint to resume from", http.StatusConflict)
+			return
+		}
+		event := models.AuditEvent{
+			Action:  audit.ActionCrawlResume,
+			Target:  "job:" + job.ID,
+			Outcome: audit.OutcomeSuccess,
+			Details: fmt.Sprintf("organization %d, %d urls to visit", job.OrganizationID, len(checkpoint.ToVisit)),
+		}
+
+		if !functions.AcceptingCrawls() {
+			w.Header().Set("Retry-After", "60")
+			utils.WriteError(w, "The server is shutting down, try again later", http.StatusServiceUnavailable)
+			return
+		}
 
-	// close the request body when the function completes to free resources
-	defer r.Body.Close()
+		// the job runs again within the user's quota, unless it is finished or still runs
+		meter, err := quota.Resume(user, *job)
+		if errors.Is(err, database.ErrCrawlJobNotResumable) {
+			utils.WriteError(w, "Crawl job is finished or still running", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, quota.ErrQuotaExceeded) {
+			event.Outcome = audit.OutcomeDenied
+			event.Details = err.Error() + ", " + event.Details
+			recordAudit(r, event)
+			utils.WriteError(w, "Quota exceeded: "+strings.TrimPrefix(err.Error(), quota.ErrQuotaExceeded.Error()+": "), http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking the quota of user %d: %v", user.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit(r, event)
 
-	// loop through the list of URLs provided in the request
-	for _, url := range requestData.URLs {
-		// for each URL, initiate the crawling process using the Crawl function from the functions package
-		functions.Crawl(url)
+		w.Write([]byte("Crawling resumed"))
+		w.Write([]byte("\nJob ID: " + job.ID + "\n"))
+		runCrawl(w, cfg, store, *job, functions.FrontierFromCheckpoint(checkpoint), meter)
+	}
+}
+
+// runCrawl runs a started or resumed job and writes how it ended to the response.
+func runCrawl(w http.ResponseWriter, cfg config.CrawlerConfig, store *storage.Store, job models.CrawlJob, frontier *functions.Frontier, meter *quota.Meter) {
+	if err := functions.RunCrawl(cfg, store, job, frontier, meter); err != nil {
+		w.Write([]byte("Crawling interrupted by a server shutdown, it resumes when the server is back"))
+		return
 	}
 
 	//This here is optionally, if I want to send status code of 200 ----- w.WriteHeader(http.StatusOK)
 
-	// response that the crawling process has completed
+	// response that the crawling process has completed, or was stopped by the quota
+	if err := meter.Stopped(); err != nil {
+		w.Write([]byte("Crawling stopped, " + err.Error()))
+		return
+	}
 	w.Write([]byte("Crawling completed"))
 }
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeleteDataHandler godoc
+// @Summary Deletes selected scraped pages
+// @Description Deletes the scraped pages matching the given filters and moves them to the trash. At least one filter is required. Only pages of the workspace selected by X-Organization-ID are deleted. Users can only delete their own pages, organization admins any page of the organization and the data:delete:any permission allows deleting any page.
+// @Tags Data
+// @Security BearerAuth
+// @Produce json
+// @Param job_id query string false "Crawl job ID"
+// @Param host query string false "Hostname, e.g. example.com"
+// @Param url query string false "URL pattern, * matches any characters"
+// @Param crawled_before query string false "RFC 3339 timestamp"
+// @Param crawled_after query string false "RFC 3339 timestamp"
+// @Param dry_run query bool false "Only report what would be removed"
+// @Param X-Organization-ID header int false "Organization to delete pages of"
+// @Success 200 {object} storage.DeletionResult
+// @Failure 400 {object} utils.ErrorResponse "Invalid filter or no filter given"
+// @Failure 403 {object} utils.ErrorResponse "Not a member of the organization, or only a viewer"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Unable to delete scraped data"
+// @Router /api/v1/data [delete]
+
+func DeleteDataHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := middleware.GetUserFromContext(r.Context())
+		if err != nil {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// build the filter from the query string
+		filter, err := parsePageFilter(r)
+		if err != nil {
+			utils.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// refuse an empty filter, wiping everything stays an explicit admin action on /api/v1/data/all
+		if filter.IsEmpty() {
+			utils.WriteError(w, "At least one filter is required", http.StatusBadRequest)
+			return
+		}
+		workspace := middleware.GetWorkspaceFromContext(r.Context())
+		if !workspace.Allows(models.OrgRoleMember) {
+			utils.WriteError(w, "Forbidden: Viewers can't delete pages", http.StatusForbidden)
+			return
+		}
+		filter.InWorkspace(workspace, user.ID)
+		// without data:delete:any users can only ever touch the pages they crawled themselves,
+		// in an organization its admins can delete every page of it
+		if !auth.HasPermission(user.Role, models.PermDataDeleteAny) && !(workspace.OrganizationID != 0 && workspace.Allows(models.OrgRoleAdmin)) {
+			filter.UserID = user.ID
+		}
+
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+		result, err := store.DeletePages(filter, dryRun, user.ID)
+		if err != nil {
+			log.Printf("Error deleting scraped data: %v", err)
+			utils.WriteError(w, "Unable to delete scraped data", http.StatusInternalServerError)
+			return
+		}
+		if !dryRun {
+			selection, _ := json.Marshal(filter)
+			recordAudit(r, models.AuditEvent{
+				Action:  audit.ActionDataDelete,
+				ActorID: user.ID,
+				Target:  string(selection),
+				Outcome: audit.OutcomeSuccess,
+				Details: fmt.Sprintf("%d pages moved to trash %s", result.Matched, result.TrashID),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// ListTrashHandler godoc
+// @Summary Lists the trash
+// @Description Lists the deletion batches that can still be restored.
+// @Tags Data
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} storage.TrashBatch
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Unable to read trash"
+// @Router /api/v1/data/trash [get]
+
+func ListTrashHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batches, err := store.ListTrash()
+		if err != nil {
+			log.Printf("Error listing trash: %v", err)
+			utils.WriteError(w, "Unable to read trash", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(batches)
+	}
+}
+
+// RestoreTrashHandler godoc
+// @Summary Restores deleted pages
+// @Description Puts the pages of a trash batch back into the scraped data.
+// @Tags Data
+// @Security BearerAuth
+// @Produce json
+// @Param id query string true "Trash batch ID"
+// @Success 200 {object} map[string]int "restored"
+// @Failure 400 {object} utils.ErrorResponse "Trash ID is required"
+// @Failure 404 {object} utils.ErrorResponse "Trash batch not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Unable to restore trash"
+// @Router /api/v1/data/trash/restore [post]
+
+func RestoreTrashHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			utils.WriteError(w, "Trash ID is required", http.StatusBadRequest)
+			return
+		}
+
+		restored, err := store.RestoreTrash(id)
+		if errors.Is(err, storage.ErrTrashNotFound) {
+			utils.WriteError(w, "Trash batch not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error restoring trash %s: %v", id, err)
+			utils.WriteError(w, "Unable to restore trash", http.StatusInternalServerError)
+			return
+		}
+
+		recordAudit(r, models.AuditEvent{Action: audit.ActionTrashRestore, Target: "trash:" + id, Outcome: audit.OutcomeSuccess, Details: fmt.Sprintf("%d pages restored", restored)})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"restored": restored})
+	}
+}
+
+// parsePageFilter reads the page filter from the query string of the request.
+func parsePageFilter(r *http.Request) (storage.PageFilter, error) {
+	query := r.URL.Query()
+	filter := storage.PageFilter{
+		JobID:      query.Get("job_id"),
+		Host:       query.Get("host"),
+		URLPattern: query.Get("url"),
+	}
+
+	var err error
+	if value := query.Get("crawled_before"); value != "" {
+		if filter.CrawledBefore, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, errors.New("Invalid crawled_before, expected RFC 3339 timestamp")
+		}
+	}
+	if value := query.Get("crawled_after"); value != "" {
+		if filter.CrawledAfter, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, errors.New("Invalid crawled_after, expected RFC 3339 timestamp")
+		}
+	}
+	return filter, nil
+}
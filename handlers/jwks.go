@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"GoGrab/auth"
+	"GoGrab/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// JWKSHandler godoc
+// @Summary Public keys of the access tokens
+// @Description Returns the public keys that access tokens are signed with as a JSON Web Key Set, so other services can verify GoGrab tokens themselves. Tokens name their key in the kid header; retired keys stay listed until their tokens have expired. Empty when tokens are signed with HS256.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} auth.JSONWebKeySet
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /.well-known/jwks.json [get]
+
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := auth.JWKS()
+	if err != nil {
+		log.Printf("Error loading signing keys: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// verifiers may cache the keys, after a rotation they have to fetch them again for an unknown kid
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
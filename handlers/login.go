@@ -1,42 +1,40 @@
 package handlers
 
 import (
+	"GoGrab/audit"
+	"GoGrab/auth"
 	"GoGrab/database"
 	"GoGrab/models"
+	"GoGrab/utils"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
-
 // LoginHandler godoc
 // @Summary User login
-// @Description Authenticates a user and returns a JWT token if the login is successful.
+// @Description Authenticates a user against the backends of auth.backends (local passwords and/or LDAP) and returns a JWT access token and a refresh token if the login is successful. With two-factor authentication enabled, or required by the user's role, it returns a challenge_token for /api/v1/login/2fa instead.
 // @Tags Auth
 // @Accept  json
 // @Produce  json
-// @Param login body models.LoginRequest true "Login credentials"
-// @Success 200 {object} map[string]string "access_token"
-// @Failure 400 {string} string "Invalid request payload or missing fields"
-// @Failure 401 {string} string "Invalid credentials"
-// @Failure 500 {string} string "Internal Server Error"
-// @Router /api/login-user [post]
+// @Param login body object true "Login credentials, username and password"
+// @Success 200 {object} map[string]interface{} "access_token, refresh_token and their expiry, or two_factor_required with challenge_token"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or missing fields"
+// @Failure 401 {object} utils.ErrorResponse "Invalid credentials"
+// @Failure 403 {object} utils.ErrorResponse "Password change required"
+// @Failure 429 {object} utils.ErrorResponse "Too many failed logins"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Failure 503 {object} utils.ErrorResponse "Authentication backend unavailable"
+// @Router /api/v1/login [post]
 
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 
-	// check if the request method is POST
-	if r.Method != http.MethodPost {
-		// If the request method is not POST, return a 405 method not allowed error
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
 	// temp struct for storing login credentials
 	var credentials struct {
 		Username string `json:"username"`
@@ -46,63 +44,182 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Decoding the json body from the request into the credentials struct
 	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
 		// if the json is invalid, it returns error code 400 for bad request
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 	// here checks if the username or password is empty
 	if credentials.Username == "" || credentials.Password == "" {
 		// if it's empty, returns bad requesst error code 400
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		utils.WriteError(w, "Username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	// refuse the attempt while the account or the IP is backing off after failed logins
+	ip := utils.ClientIP(r)
+	if loginThrottled(w, credentials.Username, ip) {
+		return
+	}
+
+	// checking the credentials with the backends of auth.backends, the local password hashes and/or LDAP
+	user, err := auth.Authenticate(credentials.Username, credentials.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		// if the username or password is invalid it returns error code 401, unauthorized
+		recordLoginFailure(r, credentials.Username, ip, "invalid credentials")
+		utils.WriteError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error authenticating %s: %v", credentials.Username, err)
+		utils.WriteError(w, "Authentication backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	// locked accounts get the answer of a wrong password and count as a failure, so the response doesn't tell
+	// whether the password of a locked account was guessed right
+	if user.LockedAt != nil {
+		recordAudit(r, models.AuditEvent{Action: audit.ActionLoginFailure, ActorID: user.ID, Target: user.Username, Outcome: audit.OutcomeDenied, Details: "account is locked"})
+		if err := auth.RecordLoginFailure(credentials.Username, ip); err != nil {
+			log.Printf("Error recording failed login of %s: %v", credentials.Username, err)
+		}
+		utils.WriteError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	// a forced password reset has to go through /api/v1/change-password or /api/v1/password-reset first
+	if user.MustChangePassword {
+		utils.WriteError(w, "Password change required", http.StatusForbidden)
+		return
+	}
+	if err := auth.RecordLoginSuccess(credentials.Username); err != nil {
+		log.Printf("Error clearing failed logins of %s: %v", credentials.Username, err)
+	}
+
+	continueLogin(w, r, user, ip)
+}
+
+// continueLogin asks for the second factor if the user needs one and starts the login otherwise.
+func continueLogin(w http.ResponseWriter, r *http.Request, user *models.User, ip string) {
+	// with two-factor authentication the first factor only earns a challenge for the second step
+	purpose, err := auth.SecondFactorPurpose(user)
+	if err != nil {
+		log.Printf("Error checking two-factor authentication of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if purpose != "" {
+		challengeToken, expiresAt, err := auth.IssueLoginChallenge(user.ID, purpose)
+		if err != nil {
+			log.Printf("Error issuing login challenge: %v", err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"two_factor_required": true,
+			"purpose":             purpose,
+			"challenge_token":     challengeToken,
+			"expires_in":          int(time.Until(expiresAt).Seconds()),
+		})
 		return
 	}
 
-	// retrieving the user from the database by username
-	user, err := database.GetUserByUsername(credentials.Username)
+	startLogin(w, r, user, ip, nil)
+}
+
+// startLogin starts a session for a user whose credentials were checked and answers with its tokens.
+func startLogin(w http.ResponseWriter, r *http.Request, user *models.User, ip string, extra map[string]interface{}) {
+	// every login starts a new session, so logging in on another device doesn't log out this one
+	session, err := auth.StartSession(user.ID, r.UserAgent(), ip)
 	if err != nil {
-		// if the username is invalid it returns error code 401, unauthorized
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		log.Printf("Error creating session: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	// here compares provided password with the hashed password stored in the database
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)); err != nil {
-		// and again here, if the password doesn't match, it returns error code 401, unauthorized
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+
+	// the session ID is also the family of its refresh tokens
+	refreshToken, err := auth.IssueRefreshToken(user.ID, session.ID)
+	if err != nil {
+		log.Printf("Error issuing refresh token: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// here, I set the token expiration time to 60 minutes from now
-	expirationTime := time.Now().Add(60 * time.Minute)
+	recordAudit(r, models.AuditEvent{Action: audit.ActionLoginSuccess, ActorID: user.ID, Target: user.Username, Outcome: audit.OutcomeSuccess, Details: "session " + session.ID})
+	issueAccessToken(w, user, refreshToken, extra)
+}
+
+// loginThrottled answers with 429 and Retry-After while failed logins keep the account or IP waiting.
+func loginThrottled(w http.ResponseWriter, username, ip string) bool {
+	retryAfter, err := auth.LoginRetryAfter(username, ip)
+	if err != nil {
+		log.Printf("Error checking failed logins: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+	if retryAfter <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	utils.WriteError(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// recordLoginFailure counts a wrong password or code towards the lockout and records it in the audit log.
+func recordLoginFailure(r *http.Request, username, ip, reason string) {
+	recordAudit(r, models.AuditEvent{Action: audit.ActionLoginFailure, Target: username, Outcome: audit.OutcomeFailure, Details: reason})
+	if err := auth.RecordLoginFailure(username, ip); err != nil {
+		log.Printf("Error recording failed login of %s: %v", username, err)
+	}
+}
+
+/*
+issueAccessToken signs a new access token for the session of the refresh token, stores its hash on
+the session and writes it together with the refresh token and any extra fields as the JSON response.
+Used by both login and token refresh.
+*/
+func issueAccessToken(w http.ResponseWriter, user *models.User, refreshToken *auth.IssuedRefreshToken, extra map[string]interface{}) {
+	// the access token lifetime comes from auth.access_token_ttl, 60 minutes by default
+	expirationTime := time.Now().Add(auth.AccessTokenTTL())
 	// I use JWT claims, i.e creating for getting the metadata for user id as subject and role,  for not goint repeatedly in the database and checking
 	claims := &models.Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   strconv.Itoa(user.ID),
+			ID:        refreshToken.FamilyID, // the session ID
+			Issuer:    auth.AccessTokenIssuer(),
+			Audience:  jwt.ClaimStrings{auth.AccessTokenAudience()},
 		},
 		Role: user.Role,
 	}
-	// creating the jwt token using HS256 signing method and the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// signing the token using the secret key, in my case it's "JWT_SECRET_KEY" and because is not used in production
-	tokenString, err := token.SignedString(jwtKey)
+	// signing the token with the current signing key, see auth.SignAccessToken
+	tokenString, err := auth.SignAccessToken(claims)
 	if err != nil {
 		// if it fails returns code error 500, internal server error
 		log.Printf("Error signing token: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// save the generated JWT token to the database for the user along with the expiration time
-	if err := database.SaveUserToken(user.ID, tokenString, expirationTime); err != nil {
+	// save the hash of the generated JWT token on the session, the session lives as long as its refresh token
+	if err := database.UpdateSessionToken(refreshToken.FamilyID, auth.HashToken(tokenString), refreshToken.ExpiresAt); err != nil {
 		// if saving the token to the database fails, will return error 500, internal server error
 		log.Printf("Error saving token to database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	// setting the response header to indicate json content
 	w.Header().Set("Content-Type", "application/json")
 
-	// return the signed jwt token as a json response
-	json.NewEncoder(w).Encode(map[string]string{"access_token": tokenString})
+	// return the signed jwt token and the refresh token as a json response
+	response := map[string]interface{}{
+		"access_token":             tokenString,
+		"token_type":               "Bearer",
+		"expires_in":               int(time.Until(expirationTime).Seconds()),
+		"refresh_token":            refreshToken.Token,
+		"refresh_token_expires_at": refreshToken.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	json.NewEncoder(w).Encode(response)
 }
@@ -1,77 +1,43 @@
 package handlers
 
 import (
-	"GoGrab/database"
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/utils"
 	"net/http"
-	"strconv"
-
-	"github.com/golang-jwt/jwt/v4"
 )
 
 // LogoutHandler godoc
 // @Summary Logout user
-// @Description Logs out the user by deleting the JWT token from the database.
+// @Description Logs out the user by revoking the current session and its refresh tokens. Sessions on other devices stay logged in.
 // @Tags Auth
 // @Security BearerAuth
 // @Produce  plain
 // @Success 200 {string} string "Logged out successfully"
-// @Failure 401 {string} string "Authorization header missing or invalid token"
-// @Failure 500 {string} string "Failed to logout"
-// @Router /api/logout [post]
+// @Failure 401 {object} utils.ErrorResponse "Authorization header missing or invalid token"
+// @Failure 500 {object} utils.ErrorResponse "Failed to logout"
+// @Router /api/v1/logout [post]
 
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	// check if the request method is GET
-	if r.Method != http.MethodGet {
-		// If the request method is not GET, return a 405 method not allowed error
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-	// retrieve the Authorization header from the request
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		// if the Authorization header is missing, return a 401 Unauthorized error
-		http.Error(w, "Authorization header missing", http.StatusUnauthorized)
-		return
-	}
-
-	// extract the token part from the "Bearer" scheme
-	tokenString := authHeader[len("Bearer "):]
-
-	// parse the JWT token using the provided key (jwtKey)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// return the signing key used to verify the token
-		return jwtKey, nil
-	})
-
-	// if there was an error parsing the token or it's not valid, return a 401 Unauthorized error
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
-	}
-
-	// extract claims from the token, specifically ensuring they are in the expected format
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		// if claims are not in the expected format, return a 401 Unauthorized error
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
-	}
-
-	// extract the user ID from the token's "sub" (subject) claim
-	userID, err := strconv.Atoi(claims["sub"].(string))
+	// the middleware already validated the token, retrieve the user and the session from the context
+	user, err := middleware.GetUserFromContext(r.Context())
 	if err != nil {
-		// if the user ID cannot be converted to an integer, return a 401 Unauthorized error
-		http.Error(w, "Invalid user ID", http.StatusUnauthorized)
+		utils.WriteError(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
+	sessionID := middleware.GetSessionIDFromContext(r.Context())
 
-	// call the database function to delete the token for the user
-	if err := database.DeleteUserToken(userID); err != nil {
-		// if there is an error deleting the token, return a 500 Internal Server Error
-		http.Error(w, "Failed to logout", http.StatusInternalServerError)
+	// revoke the session together with its refresh tokens, otherwise the client could simply log back in with them
+	if _, err := auth.RevokeSession(user.ID, sessionID); err != nil {
+		// if there is an error revoking the session, return a 500 Internal Server Error
+		utils.WriteError(w, "Failed to logout", http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(r, models.AuditEvent{Action: audit.ActionLogout, Target: user.Username, Outcome: audit.OutcomeSuccess, Details: "session " + sessionID})
+
 	// on successful logout, return a 200 OK status with a message
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Logged out successfully"))
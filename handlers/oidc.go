@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/config"
+	"GoGrab/models"
+	"GoGrab/oidc"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// AuthProvidersHandler godoc
+// @Summary List the available login methods
+// @Description Tells clients whether username and password logins and single sign-on with OpenID Connect are available, and where to start the single sign-on.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{} "local and oidc"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Router /api/v1/auth/providers [get]
+
+func AuthProvidersHandler(cfg config.AuthConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		providers := map[string]interface{}{"local": cfg.LocalLogin}
+		if oidcConfig := oidc.NewConfig(cfg.OIDC); oidcConfig.Enabled() {
+			providers["oidc"] = map[string]string{"issuer": oidcConfig.Issuer, "login_url": "/api/v1/oidc/login"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(providers)
+	}
+}
+
+// OIDCLoginHandler godoc
+// @Summary Start a single sign-on login
+// @Description Redirects to the login page of the OpenID Connect provider, using the authorization code flow with PKCE. The provider sends the user back to /api/v1/oidc/callback, which only completes the login in the browser that got the state cookie set here.
+// @Tags Auth
+// @Success 302 {string} string "Redirect to the provider"
+// @Failure 404 {object} utils.ErrorResponse "Single sign-on is not configured"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 429 {object} utils.ErrorResponse "Too many requests"
+// @Failure 502 {object} utils.ErrorResponse "Provider unavailable"
+// @Router /api/v1/oidc/login [get]
+
+func OIDCLoginHandler(cfg config.OIDCConfig) http.HandlerFunc {
+	oidcConfig := oidc.NewConfig(cfg)
+	return func(w http.ResponseWriter, r *http.Request) {
+		redirectURL, state, err := oidc.Begin(oidcConfig)
+		if errors.Is(err, oidc.ErrNotConfigured) {
+			utils.WriteError(w, "Single sign-on is not configured", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error starting OIDC login: %v", err)
+			utils.WriteError(w, "Provider unavailable", http.StatusBadGateway)
+			return
+		}
+		http.SetCookie(w, oidc.StateCookie(oidcConfig, state))
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+	}
+}
+
+// OIDCCallbackHandler godoc
+// @Summary Finish a single sign-on login
+// @Description Redirect target of the OpenID Connect provider. Exchanges the authorization code, validates the ID token and logs in the linked user, who is created on the first login with the role mapped from the provider's claims. Like /api/v1/login it answers with the tokens or with a two-factor challenge.
+// @Tags Auth
+// @Produce json
+// @Param state query string true "State of the login"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} map[string]interface{} "access_token, refresh_token and their expiry, or a two-factor challenge"
+// @Failure 400 {object} utils.ErrorResponse "Missing state or code"
+// @Failure 401 {object} utils.ErrorResponse "Login refused, or started in another browser"
+// @Failure 403 {object} utils.ErrorResponse "Account is locked"
+// @Failure 404 {object} utils.ErrorResponse "Single sign-on is not configured"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 409 {object} utils.ErrorResponse "Username already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/oidc/callback [get]
+
+func OIDCCallbackHandler(cfg config.OIDCConfig) http.HandlerFunc {
+	oidcConfig := oidc.NewConfig(cfg)
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if providerError := query.Get("error"); providerError != "" {
+			utils.WriteError(w, "Login refused by the provider: "+providerError, http.StatusUnauthorized)
+			return
+		}
+		state, code := query.Get("state"), query.Get("code")
+		if state == "" || code == "" {
+			utils.WriteError(w, "Missing state or code", http.StatusBadRequest)
+			return
+		}
+
+		// the state is only taken from the browser that started the login, a leaked callback URL is useless
+		if !oidcConfig.Enabled() {
+			utils.WriteError(w, "Single sign-on is not configured", http.StatusNotFound)
+			return
+		}
+		if err := oidc.CheckStateCookie(r, state); err != nil {
+			recordAudit(r, models.AuditEvent{Action: audit.ActionLoginFailure, Target: "oidc", Outcome: audit.OutcomeFailure, Details: err.Error()})
+			utils.WriteError(w, "Login was started in another browser, start again at /api/v1/oidc/login", http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, oidc.ClearStateCookie(oidcConfig))
+
+		user, err := oidc.Complete(oidcConfig, state, code)
+		if err != nil && !errors.Is(err, oidc.ErrNotConfigured) {
+			recordAudit(r, models.AuditEvent{Action: audit.ActionLoginFailure, Target: "oidc", Outcome: audit.OutcomeFailure, Details: err.Error()})
+		}
+		switch {
+		case errors.Is(err, oidc.ErrNotConfigured):
+			utils.WriteError(w, "Single sign-on is not configured", http.StatusNotFound)
+			return
+		case errors.Is(err, oidc.ErrInvalidState):
+			utils.WriteError(w, "Invalid or expired login, start again at /api/v1/oidc/login", http.StatusUnauthorized)
+			return
+		case errors.Is(err, auth.ErrUsernameTaken):
+			// linking to a local account by name alone would let the provider take over any account
+			utils.WriteError(w, "Username already exists", http.StatusConflict)
+			return
+		case errors.Is(err, oidc.ErrNoRole), errors.Is(err, oidc.ErrUsernameClaim):
+			utils.WriteError(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			log.Printf("Error completing OIDC login: %v", err)
+			utils.WriteError(w, "Login refused", http.StatusUnauthorized)
+			return
+		}
+
+		if user.LockedAt != nil {
+			recordAudit(r, models.AuditEvent{Action: audit.ActionLoginFailure, ActorID: user.ID, Target: user.Username, Outcome: audit.OutcomeDenied, Details: "account is locked"})
+			utils.WriteError(w, "Account is locked", http.StatusForbidden)
+			return
+		}
+		continueLogin(w, r, user, utils.ClientIP(r))
+	}
+}
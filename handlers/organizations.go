@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxOrganizationNameLength = 100
+
+// organizationRequest is the body of the organization endpoints.
+type organizationRequest struct {
+	Name string `json:"name"`
+}
+
+// memberRequest is the body of the member endpoints, the user is given by ID or username.
+type memberRequest struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// OrganizationsHandler godoc
+// @Summary Lists or creates organizations
+// @Description GET lists the organizations the user is a member of with their role, users with orgs:manage see every organization. POST creates an organization with the user as its owner.
+// @Tags Organizations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param organization body organizationRequest false "Name of the new organization (POST only)"
+// @Success 200 {array} models.Organization
+// @Success 201 {object} models.Organization
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or name"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 409 {object} utils.ErrorResponse "Organization name already taken"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/organizations [get]
+// @Router /api/v1/organizations [post]
+
+func OrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var orgs []models.Organization
+		if auth.HasPermission(user.Role, models.PermOrgsManage) {
+			orgs, err = database.GetOrganizations()
+		} else {
+			orgs, err = database.GetUserOrganizations(user.ID)
+		}
+		if err != nil {
+			log.Printf("Error listing organizations: %v", err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(orgs)
+
+	case http.MethodPost:
+		name, ok := decodeOrganizationName(w, r)
+		if !ok {
+			return
+		}
+		org := &models.Organization{Name: name, CreatedBy: user.ID}
+		if err := database.CreateOrganization(org); err != nil {
+			log.Printf("Error creating organization %s: %v", name, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		created, err := database.GetOrganization(org.ID)
+		if err != nil || created == nil {
+			log.Printf("Error loading organization %d: %v", org.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		created.Role = models.OrgRoleOwner
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// OrganizationHandler godoc
+// @Summary Shows, renames or deletes an organization
+// @Description GET returns the organization with its members. PATCH renames it and is reserved to owners. DELETE moves the organization's pages to the trash and removes the organization with its memberships; owners and users with orgs:manage can delete it.
+// @Tags Organizations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param organization body organizationRequest false "New name (PATCH only)"
+// @Success 200 {object} map[string]interface{} "organization and members"
+// @Failure 400 {object} utils.ErrorResponse "Invalid organization ID, request payload or name"
+// @Failure 403 {object} utils.ErrorResponse "Not an owner of the organization"
+// @Failure 404 {object} utils.ErrorResponse "Organization not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 409 {object} utils.ErrorResponse "Organization name already taken"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/organizations/{id} [get]
+// @Router /api/v1/organizations/{id} [patch]
+// @Router /api/v1/organizations/{id} [delete]
+
+func OrganizationHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		org, user, ok := loadOrganization(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			members, err := database.GetOrganizationMembers(org.ID)
+			if err != nil {
+				log.Printf("Error listing members of organization %d: %v", org.ID, err)
+				utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"organization": org,
+				"members":      members,
+			})
+
+		case http.MethodPatch:
+			if org.Role != models.OrgRoleOwner {
+				utils.WriteError(w, "Forbidden: Only owners can rename the organization", http.StatusForbidden)
+				return
+			}
+			name, ok := decodeOrganizationName(w, r)
+			if !ok {
+				return
+			}
+			if _, err := database.RenameOrganization(org.ID, name); err != nil {
+				log.Printf("Error renaming organization %d: %v", org.ID, err)
+				utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Organization renamed"})
+
+		case http.MethodDelete:
+			if org.Role != models.OrgRoleOwner {
+				utils.WriteError(w, "Forbidden: Only owners can delete the organization", http.StatusForbidden)
+				return
+			}
+			// the pages go to the trash first, a failure leaves the organization in place to retry
+			result, err := store.DeletePages(storage.PageFilter{Scoped: true, OrganizationID: org.ID}, false, user.ID)
+			if err != nil {
+				log.Printf("Error deleting pages of organization %d: %v", org.ID, err)
+				utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if _, err := database.DeleteOrganization(org.ID); err != nil {
+				log.Printf("Error deleting organization %d: %v", org.ID, err)
+				utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			recordAudit(r, models.AuditEvent{
+				Action:  audit.ActionOrgDelete,
+				ActorID: user.ID,
+				Target:  org.Name,
+				Outcome: audit.OutcomeSuccess,
+				Details: fmt.Sprintf("%d pages moved to trash %s", result.Matched, result.TrashID),
+			})
+
+			response := map[string]interface{}{"message": "Organization deleted", "pages_deleted": result.Matched}
+			if result.TrashID != "" {
+				response["trash_id"] = result.TrashID
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+
+		default:
+			utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// OrganizationMembersHandler godoc
+// @Summary Lists or adds members of an organization
+// @Description GET lists the members with their organization role. POST adds a user, given by user_id or username, as viewer, member, admin or owner; admins can add members, only owners can add owners.
+// @Tags Organizations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param member body memberRequest false "User and role (POST only)"
+// @Success 200 {array} models.OrganizationMember
+// @Success 201 {object} map[string]string "Member added"
+// @Failure 400 {object} utils.ErrorResponse "Invalid organization ID, request payload or role"
+// @Failure 403 {object} utils.ErrorResponse "Organization role too low"
+// @Failure 404 {object} utils.ErrorResponse "Organization or user not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 409 {object} utils.ErrorResponse "User is already a member"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/organizations/{id}/members [get]
+// @Router /api/v1/organizations/{id}/members [post]
+
+func OrganizationMembersHandler(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := loadOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		members, err := database.GetOrganizationMembers(org.ID)
+		if err != nil {
+			log.Printf("Error listing members of organization %d: %v", org.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(members)
+
+	case http.MethodPost:
+		var request memberRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if !canAssignOrgRole(w, org.Role, request.Role) {
+			return
+		}
+
+		var member *models.User
+		var err error
+		if request.UserID != 0 {
+			member, err = database.GetUserByID(request.UserID)
+		} else {
+			member, err = database.GetUserByUsername(request.Username)
+		}
+		if err != nil {
+			log.Printf("Error loading user for organization %d: %v", org.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if member.ID == 0 {
+			utils.WriteError(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		role, err := database.GetMembershipRole(org.ID, member.ID)
+		if err != nil {
+			log.Printf("Error loading membership of user %d in organization %d: %v", member.ID, org.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if role != "" {
+			utils.WriteError(w, "User is already a member", http.StatusConflict)
+			return
+		}
+		if err := database.AddOrganizationMember(org.ID, member.ID, request.Role); err != nil {
+			log.Printf("Error adding user %d to organization %d: %v", member.ID, org.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Member added"})
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// OrganizationMemberHandler godoc
+// @Summary Changes the role of a member or removes them
+// @Description PATCH changes the organization role of a member, DELETE removes them. Admins manage the members, only owners can promote to or change owners. Every member can leave with DELETE on their own user ID. The last owner can't leave or be demoted.
+// @Tags Organizations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param user_id path int true "User ID"
+// @Param member body memberRequest false "New role (PATCH only)"
+// @Success 200 {object} map[string]string "Member updated or removed"
+// @Failure 400 {object} utils.ErrorResponse "Invalid ID, request payload or role"
+// @Failure 403 {object} utils.ErrorResponse "Organization role too low"
+// @Failure 404 {object} utils.ErrorResponse "Organization or member not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 409 {object} utils.ErrorResponse "Last owner of the organization"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/organizations/{id}/members/{user_id} [patch]
+// @Router /api/v1/organizations/{id}/members/{user_id} [delete]
+
+func OrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	org, user, ok := loadOrganization(w, r)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		utils.WriteError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	memberRole, err := database.GetMembershipRole(org.ID, memberID)
+	if err != nil {
+		log.Printf("Error loading membership of user %d in organization %d: %v", memberID, org.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if memberRole == "" {
+		utils.WriteError(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		var request memberRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		// owners are only changed by owners, whether they are demoted or someone is promoted
+		if !canAssignOrgRole(w, org.Role, request.Role) || !canAssignOrgRole(w, org.Role, memberRole) {
+			return
+		}
+		if memberRole == models.OrgRoleOwner && request.Role != models.OrgRoleOwner && !keepsOwner(w, org.ID) {
+			return
+		}
+		if _, err := database.UpdateOrganizationMember(org.ID, memberID, request.Role); err != nil {
+			log.Printf("Error updating user %d in organization %d: %v", memberID, org.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Member updated"})
+
+	case http.MethodDelete:
+		if memberID != user.ID && !canAssignOrgRole(w, org.Role, memberRole) {
+			return
+		}
+		if memberRole == models.OrgRoleOwner && !keepsOwner(w, org.ID) {
+			return
+		}
+		if _, err := database.RemoveOrganizationMember(org.ID, memberID); err != nil {
+			log.Printf("Error removing user %d from organization %d: %v", memberID, org.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Member removed"})
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+/*
+loadOrganization reads the organization given by the id path value with the role of the requesting
+user, writing the error response if there is none. Users with orgs:manage act as owners of every
+organization; to everyone else organizations they aren't a member of don't exist.
+*/
+func loadOrganization(w http.ResponseWriter, r *http.Request) (*models.Organization, *models.User, bool) {
+	user, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	orgID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, "Invalid organization ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	org, err := database.GetOrganization(orgID)
+	if err != nil {
+		log.Printf("Error loading organization %d: %v", orgID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if org != nil {
+		org.Role, err = database.GetMembershipRole(orgID, user.ID)
+		if err != nil {
+			log.Printf("Error loading membership of user %d in organization %d: %v", user.ID, orgID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return nil, nil, false
+		}
+		if auth.HasPermission(user.Role, models.PermOrgsManage) {
+			org.Role = models.OrgRoleOwner
+		}
+	}
+	if org == nil || org.Role == "" {
+		utils.WriteError(w, "Organization not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return org, user, true
+}
+
+// decodeOrganizationName reads and checks the name of an organization from the request body.
+func decodeOrganizationName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var request organizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return "", false
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > maxOrganizationNameLength {
+		utils.WriteError(w, "Name must be between 1 and 100 characters", http.StatusBadRequest)
+		return "", false
+	}
+
+	exists, err := database.OrganizationNameExists(name)
+	if err != nil {
+		log.Printf("Error checking organization name %s: %v", name, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return "", false
+	}
+	if exists {
+		utils.WriteError(w, "Organization name already taken", http.StatusConflict)
+		return "", false
+	}
+	return name, true
+}
+
+// canAssignOrgRole checks that a user with the organization role actorRole may grant or take away role.
+func canAssignOrgRole(w http.ResponseWriter, actorRole, role string) bool {
+	if !models.ValidOrgRole(role) {
+		utils.WriteError(w, "Role must be viewer, member, admin or owner", http.StatusBadRequest)
+		return false
+	}
+	if !models.OrgRoleAtLeast(actorRole, models.OrgRoleAdmin) {
+		utils.WriteError(w, "Forbidden: Only admins can manage the members", http.StatusForbidden)
+		return false
+	}
+	if role == models.OrgRoleOwner && actorRole != models.OrgRoleOwner {
+		utils.WriteError(w, "Forbidden: Only owners can manage owners", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// keepsOwner refuses to take away the owner role when the organization has no other owner.
+func keepsOwner(w http.ResponseWriter, orgID int) bool {
+	owners, err := database.CountOrganizationOwners(orgID)
+	if err != nil {
+		log.Printf("Error counting owners of organization %d: %v", orgID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if owners <= 1 {
+		utils.WriteError(w, "The organization needs another owner first", http.StatusConflict)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// pageVersion is a stored version of a page as listed by PageVersionsHandler, without its content.
+type pageVersion struct {
+	Version     int       `json:"version"`
+	Title       string    `json:"title"`
+	ContentHash string    `json:"content_hash"`
+	Changed     bool      `json:"changed"`
+	JobID       string    `json:"job_id,omitempty"`
+	CrawledAt   time.Time `json:"crawled_at"`
+}
+
+// pageDiff is the structured result of PageDiffHandler.
+type pageDiff struct {
+	PageID  string         `json:"page_id"`
+	URL     string         `json:"url"`
+	From    int            `json:"from"`
+	To      int            `json:"to"`
+	Mode    string         `json:"mode"`
+	Added   int            `json:"added"`
+	Removed int            `json:"removed"`
+	Ops     []utils.DiffOp `json:"ops"`
+	Text    string         `json:"text"`
+}
+
+// PagesHandler godoc
+// @Summary Lists scraped pages
+// @Description Lists the scraped pages of the workspace with at least one version matching the filters, with their page ID and version count. The workspace is the organization of the X-Organization-ID header, or else the user's personal pages; users with data:read:any see every page.
+// @Tags Data
+// @Security BearerAuth
+// @Produce json
+// @Param job_id query string false "Crawl job ID"
+// @Param host query string false "Hostname, e.g. example.com"
+// @Param url query string false "URL pattern, * matches any characters"
+// @Param crawled_before query string false "RFC 3339 timestamp"
+// @Param crawled_after query string false "RFC 3339 timestamp"
+// @Param X-Organization-ID header int false "Organization to list the pages of"
+// @Success 200 {array} storage.PageSummary
+// @Failure 400 {object} utils.ErrorResponse "Invalid filter"
+// @Failure 403 {object} utils.ErrorResponse "Not a member of the organization"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Unable to read scraped data"
+// @Router /api/v1/pages [get]
+
+func PagesHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parsePageFilter(r)
+		if err != nil {
+			utils.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, err := middleware.GetUserFromContext(r.Context())
+		if err != nil {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		filter.InWorkspace(middleware.GetWorkspaceFromContext(r.Context()), user.ID)
+
+		pages, err := store.QueryPages(filter)
+		if err != nil {
+			log.Printf("Error querying pages: %v", err)
+			utils.WriteError(w, "Unable to read scraped data", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pages)
+	}
+}
+
+// PageVersionsHandler godoc
+// @Summary Lists the versions of a page
+// @Description Lists every stored fetch of a page in the workspace, oldest first, with its fetch timestamp and content hash.
+// @Tags Data
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Page ID"
+// @Success 200 {array} pageVersion
+// @Param X-Organization-ID header int false "Organization the page belongs to"
+// @Failure 403 {object} utils.ErrorResponse "Not a member of the organization"
+// @Failure 404 {object} utils.ErrorResponse "Page not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Unable to read scraped data"
+// @Router /api/v1/pages/{id}/versions [get]
+
+func PageVersionsHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		versions, err := workspaceVersions(r, store)
+		if errors.Is(err, storage.ErrPageNotFound) {
+			utils.WriteError(w, "Page not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading page versions: %v", err)
+			utils.WriteError(w, "Unable to read scraped data", http.StatusInternalServerError)
+			return
+		}
+
+		// a version is marked as changed when its content differs from the version before it
+		result := make([]pageVersion, 0, len(versions))
+		for i, version := range versions {
+			result = append(result, pageVersion{
+				Version:     version.Version,
+				Title:       version.Title,
+				ContentHash: version.ContentHash,
+				Changed:     i == 0 || version.ContentHash != versions[i-1].ContentHash,
+				JobID:       version.JobID,
+				CrawledAt:   version.CrawledAt,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// PageDiffHandler godoc
+// @Summary Diffs two versions of a page
+// @Description Compares the content of two versions of a page line by line or word by word. Without from and to the two latest versions are compared.
+// @Tags Data
+// @Security BearerAuth
+// @Produce json
+// @Produce plain
+// @Param id path string true "Page ID"
+// @Param from query int false "Older version"
+// @Param to query int false "Newer version"
+// @Param mode query string false "line (default) or word"
+// @Param format query string false "json (default) or text"
+// @Param X-Organization-ID header int false "Organization the page belongs to"
+// @Success 200 {object} pageDiff
+// @Failure 400 {object} utils.ErrorResponse "Invalid version, mode or format"
+// @Failure 403 {object} utils.ErrorResponse "Not a member of the organization"
+// @Failure 404 {object} utils.ErrorResponse "Page not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Unable to read scraped data"
+// @Router /api/v1/pages/{id}/diff [get]
+
+func PageDiffHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		mode := query.Get("mode")
+		if mode == "" {
+			mode = "line"
+		}
+		if mode != "line" && mode != "word" {
+			utils.WriteError(w, "Mode must be line or word", http.StatusBadRequest)
+			return
+		}
+		format := query.Get("format")
+		if format != "" && format != "json" && format != "text" {
+			utils.WriteError(w, "Format must be json or text", http.StatusBadRequest)
+			return
+		}
+
+		versions, err := workspaceVersions(r, store)
+		if errors.Is(err, storage.ErrPageNotFound) {
+			utils.WriteError(w, "Page not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading page versions: %v", err)
+			utils.WriteError(w, "Unable to read scraped data", http.StatusInternalServerError)
+			return
+		}
+
+		// default to comparing the two latest versions
+		from, to := versions[max(len(versions)-2, 0)].Version, versions[len(versions)-1].Version
+		if value := query.Get("from"); value != "" {
+			if from, err = strconv.Atoi(value); err != nil {
+				utils.WriteError(w, "Invalid from version", http.StatusBadRequest)
+				return
+			}
+		}
+		if value := query.Get("to"); value != "" {
+			if to, err = strconv.Atoi(value); err != nil {
+				utils.WriteError(w, "Invalid to version", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var oldContent, newContent *string
+		for i := range versions {
+			if versions[i].Version == from {
+				oldContent = &versions[i].Content
+			}
+			if versions[i].Version == to {
+				newContent = &versions[i].Content
+			}
+		}
+		if oldContent == nil || newContent == nil {
+			utils.WriteError(w, "Version not found", http.StatusNotFound)
+			return
+		}
+
+		diff := pageDiff{PageID: versions[0].PageID, URL: versions[0].URL, From: from, To: to, Mode: mode}
+		if mode == "word" {
+			diff.Ops = utils.DiffWords(*oldContent, *newContent)
+		} else {
+			diff.Ops = utils.DiffLines(*oldContent, *newContent)
+		}
+		diff.Text = utils.FormatDiff(diff.Ops, mode == "word")
+		diff.Added, diff.Removed = utils.CountDiffChanges(diff.Ops, mode == "word")
+
+		if format == "text" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(diff.Text))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(diff)
+	}
+}
+
+// workspaceVersions returns the versions of the requested page that belong to the workspace of the request.
+func workspaceVersions(r *http.Request, store *storage.Store) ([]models.PageData, error) {
+	user, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	versions, err := store.GetPageVersions(r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	var filter storage.PageFilter
+	filter.InWorkspace(middleware.GetWorkspaceFromContext(r.Context()), user.ID)
+	scoped := versions[:0]
+	for _, version := range versions {
+		if filter.Matches(version) {
+			scoped = append(scoped, version)
+		}
+	}
+	// pages of other workspaces are reported as missing, not as forbidden
+	if len(scoped) == 0 {
+		return nil, storage.ErrPageNotFound
+	}
+	return scoped, nil
+}
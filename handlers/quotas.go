@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/quota"
+	"GoGrab/utils"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MyUsageHandler godoc
+// @Summary Shows the usage of the current user
+// @Description Returns the quota that applies to the user with their running crawl jobs, the usage of today and of this month (UTC) and the size of their stored pages.
+// @Tags Account
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} quota.Report
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/me/usage [get]
+
+func MyUsageHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := quota.GetReport(user)
+	if err != nil {
+		log.Printf("Error reading the usage of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// QuotasHandler godoc
+// @Summary Lists the quotas
+// @Description Lists the quotas of roles and users. A user quota replaces the quota of the user's role, zero values don't limit anything.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.Quota
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/quotas [get]
+
+func QuotasHandler(w http.ResponseWriter, r *http.Request) {
+	quotas, err := database.GetQuotas()
+	if err != nil {
+		log.Printf("Error loading quotas: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quotas)
+}
+
+// QuotaHandler godoc
+// @Summary Sets or removes a quota
+// @Description PUT sets the quota of a role (by name) or user (by ID), DELETE removes it. Users without a quota of their own get the one of their role, without that they aren't limited. A zero value doesn't limit anything.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param scope path string true "role or user"
+// @Param target path string true "Role name or user ID"
+// @Param quota body models.Quota false "Limits (PUT only)"
+// @Success 200 {object} models.Quota
+// @Failure 400 {object} utils.ErrorResponse "Invalid scope, request payload or limit"
+// @Failure 404 {object} utils.ErrorResponse "Role, user or quota not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/quotas/{scope}/{target} [put]
+// @Router /api/v1/quotas/{scope}/{target} [delete]
+
+func QuotaHandler(w http.ResponseWriter, r *http.Request) {
+	scope, target := r.PathValue("scope"), r.PathValue("target")
+	if scope != models.QuotaScopeRole && scope != models.QuotaScopeUser {
+		utils.WriteError(w, "Scope must be role or user", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if !quotaTargetExists(w, scope, target) {
+			return
+		}
+		var request models.Quota
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if request.MaxConcurrentJobs < 0 || request.MaxPagesPerDay < 0 || request.MaxStoredBytes < 0 || request.MaxBrowserMinutes < 0 {
+			utils.WriteError(w, "Limits can't be negative, 0 means no limit", http.StatusBadRequest)
+			return
+		}
+		admin, err := middleware.GetUserFromContext(r.Context())
+		if err != nil {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		request.Scope, request.Target, request.UpdatedBy = scope, target, admin.ID
+		if err := database.SetQuota(&request); err != nil {
+			log.Printf("Error setting quota of %s %s: %v", scope, target, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		request.UpdatedAt = time.Now()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(request)
+
+	case http.MethodDelete:
+		deleted, err := database.DeleteQuota(scope, target)
+		if err != nil {
+			log.Printf("Error deleting quota of %s %s: %v", scope, target, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			utils.WriteError(w, "Quota not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Quota deleted"})
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// UsageExportHandler godoc
+// @Summary Exports the monthly usage
+// @Description Returns the crawl jobs, pages, written bytes and browser minutes of every user with usage in a calendar month (UTC), for chargeback. CSV by default, JSON with format=json. Deleted users keep their usage.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce text/csv
+// @Produce json
+// @Param month query string false "Month as YYYY-MM, the current month by default"
+// @Param format query string false "csv (default) or json"
+// @Success 200 {array} models.Usage
+// @Failure 400 {object} utils.ErrorResponse "Invalid month or format"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/usage [get]
+
+func UsageExportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	month := time.Now().UTC()
+	if value := query.Get("month"); value != "" {
+		parsed, err := time.Parse("2006-01", value)
+		if err != nil {
+			utils.WriteError(w, "month must be given as YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		month = parsed
+	}
+	format := query.Get("format")
+	if format != "" && format != "csv" && format != "json" {
+		utils.WriteError(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	usages, err := quota.MonthlyUsage(month)
+	if err != nil {
+		log.Printf("Error reading the usage of %s: %v", month.Format("2006-01"), err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(usages)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage_`+month.Format("2006-01")+`.csv"`)
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"month", "user_id", "username", "jobs", "pages", "bytes_written", "browser_minutes"})
+	for _, usage := range usages {
+		writer.Write([]string{
+			month.Format("2006-01"),
+			strconv.Itoa(usage.UserID),
+			usage.Username,
+			strconv.Itoa(usage.Jobs),
+			strconv.Itoa(usage.Pages),
+			strconv.FormatInt(usage.BytesWritten, 10),
+			fmt.Sprintf("%.2f", usage.BrowserMinutes),
+		})
+	}
+	writer.Flush()
+}
+
+// quotaTargetExists checks that the role or user a quota is set for exists.
+func quotaTargetExists(w http.ResponseWriter, scope, target string) bool {
+	if scope == models.QuotaScopeRole {
+		exists, err := auth.RoleExists(target)
+		if err != nil {
+			log.Printf("Error loading roles: %v", err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return false
+		}
+		if !exists {
+			utils.WriteError(w, "Role not found", http.StatusNotFound)
+			return false
+		}
+		return true
+	}
+
+	userID, err := strconv.Atoi(target)
+	if err != nil {
+		utils.WriteError(w, "Invalid user ID", http.StatusBadRequest)
+		return false
+	}
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if user.ID == 0 {
+		utils.WriteError(w, "User not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// RefreshTokenHandler godoc
+// @Summary Refresh the access token
+// @Description Exchanges a refresh token for a new access token and a new refresh token. Every refresh token can be used once; using one again revokes all refresh tokens issued since the login.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param refresh body object true "{\"refresh_token\": \"...\"}"
+// @Success 200 {object} map[string]interface{} "access_token, refresh_token and their expiry"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} utils.ErrorResponse "Invalid refresh token"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/token/refresh [post]
+
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// rotate the refresh token, a reused or invalid token gets the same 401 as any other bad token
+	refreshToken, err := auth.RotateRefreshToken(request.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		utils.WriteError(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating refresh token: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// the session must still be active, it may have been revoked from another device
+	session, err := database.GetSession(refreshToken.FamilyID)
+	if err != nil || !auth.IsSessionActive(session, refreshToken.UserID) {
+		utils.WriteError(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// load the user again, so a role change is picked up by the new access token
+	user, err := database.GetUserByID(refreshToken.UserID)
+	if err != nil || user.ID == 0 || user.LockedAt != nil {
+		utils.WriteError(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// a role that started requiring 2FA sends its users without it back to the login
+	if !user.TOTPEnabled {
+		required, err := auth.RoleRequires2FA(user.Role)
+		if err != nil {
+			log.Printf("Error checking two-factor authentication of user %d: %v", user.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if required {
+			if _, err := auth.RevokeSession(user.ID, refreshToken.FamilyID); err != nil {
+				log.Printf("Error revoking session %s: %v", refreshToken.FamilyID, err)
+			}
+			utils.WriteError(w, "Two-factor authentication required, log in again", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	issueAccessToken(w, user, refreshToken, nil)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"GoGrab/auth"
 	"GoGrab/database"
 	"GoGrab/models"
 	"GoGrab/utils"
@@ -10,26 +11,19 @@ import (
 
 // RegisterHandler godoc
 // @Summary Register a new user
-// @Description Registers a new user with a username and password. The password is hashed before saving.
+// @Description Registers a new user with a username and password. The password has to meet the password policy and is hashed before saving.
 // @Tags Auth
 // @Accept  json
 // @Produce  json
 // @Param  user  body  models.User  true  "User data"
 // @Success 201 {object} map[string]string "User registered successfully"
-// @Failure 400 {string} string "Username and password are required or Invalid request payload"
-// @Failure 409 {string} string "Username already exists"
-// @Failure 500 {string} string "Failed to register user or Error checking username"
-// @Router /api/register-user [post]
+// @Failure 400 {object} utils.ErrorResponse "Username and password are required, Invalid request payload or password refused by the policy"
+// @Failure 409 {object} utils.ErrorResponse "Username already exists"
+// @Failure 500 {object} utils.ErrorResponse "Failed to register user or Error checking username"
+// @Router /api/v1/register [post]
 
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
-	// check if the request method is POST
-	if r.Method != http.MethodPost {
-		// If the request method is not POST, return a 405 method not allowed error
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// declare a variable to hold the user data
 	var user models.User
 
@@ -38,7 +32,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	err := decoder.Decode(&user)
 	if err != nil {
 		// if the request body is not valid JSON or fails to decode, return a 400 Bad Request error
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
@@ -46,19 +40,25 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	exists, err := database.UsernameExists(user.Username)
 	if err != nil {
 		// if there is an error checking the username, return a 500 Internal Server Error
-		http.Error(w, "Error checking username", http.StatusInternalServerError)
+		utils.WriteError(w, "Error checking username", http.StatusInternalServerError)
 		return
 	}
 
 	// if the username already exists, return a 409 Conflict error
 	if exists {
-		http.Error(w, "Username already exists", http.StatusConflict)
+		utils.WriteError(w, "Username already exists", http.StatusConflict)
 		return
 	}
 
 	// ensure both username and password are provided, if not, return a 400 Bad Request error
 	if user.Username == "" || user.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		utils.WriteError(w, "Username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	// the password has to meet the password policy
+	if err := auth.ValidatePassword(user.Password, user.Username); err != nil {
+		utils.WriteError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -66,7 +66,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
 		// if there is an error hashing the password, return a 500 Internal Server Error
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		utils.WriteError(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 
@@ -74,7 +74,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	err = database.RegisterUser(user.Username, hashedPassword)
 	if err != nil {
 		// if registration fails, return a 500 Internal Server Error
-		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		utils.WriteError(w, "Failed to register user", http.StatusInternalServerError)
 		return
 	}
 
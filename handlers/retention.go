@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"GoGrab/database"
+	"GoGrab/functions"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// RetentionPoliciesHandler godoc
+// @Summary Manages retention policies
+// @Description GET lists all retention policies, POST creates one and DELETE removes the policy given by the id query parameter. Scope is "user", "job" or "host"; max_age_days and keep_last can be combined.
+// @Tags Data
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param policy body models.RetentionPolicy false "Policy to create (POST only)"
+// @Param id query int false "Policy ID (DELETE only)"
+// @Success 200 {array} models.RetentionPolicy
+// @Success 201 {object} models.RetentionPolicy
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 404 {object} utils.ErrorResponse "Retention policy not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/retention-policies [get]
+// @Router /api/v1/retention-policies [post]
+// @Router /api/v1/retention-policies [delete]
+
+func RetentionPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listRetentionPolicies(w)
+	case http.MethodPost:
+		createRetentionPolicy(w, r)
+	case http.MethodDelete:
+		deleteRetentionPolicy(w, r)
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func listRetentionPolicies(w http.ResponseWriter) {
+	policies, err := database.GetRetentionPolicies()
+	if err != nil {
+		log.Printf("Error loading retention policies: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if policies == nil {
+		policies = []models.RetentionPolicy{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+func createRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var policy models.RetentionPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// validate the scope and its target
+	switch policy.Scope {
+	case "user":
+		if id, err := strconv.Atoi(policy.Target); err != nil || id <= 0 {
+			utils.WriteError(w, "User scope requires a user ID as target", http.StatusBadRequest)
+			return
+		}
+	case "job", "host":
+		if policy.Target == "" {
+			utils.WriteError(w, "Target is required", http.StatusBadRequest)
+			return
+		}
+	default:
+		utils.WriteError(w, "Scope must be one of user, job or host", http.StatusBadRequest)
+		return
+	}
+	// a policy needs at least one rule, and negative values make no sense
+	if policy.MaxAgeDays < 0 || policy.KeepLast < 0 || (policy.MaxAgeDays == 0 && policy.KeepLast == 0) {
+		utils.WriteError(w, "Set max_age_days and/or keep_last to a positive value", http.StatusBadRequest)
+		return
+	}
+
+	policy.ID = 0
+	policy.CreatedBy = user.ID
+	if err := database.CreateRetentionPolicy(&policy); err != nil {
+		log.Printf("Error creating retention policy: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(policy)
+}
+
+func deleteRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.WriteError(w, "Invalid policy ID", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := database.DeleteRetentionPolicy(id)
+	if err != nil {
+		log.Printf("Error deleting retention policy %d: %v", id, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		utils.WriteError(w, "Retention policy not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Retention policy deleted"})
+}
+
+// JanitorStatusHandler godoc
+// @Summary Retention janitor status
+// @Description Returns the status of the last retention janitor run, including the pages it removed. POST triggers a run immediately.
+// @Tags Data
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} functions.JanitorStatus
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Router /api/v1/janitor [get]
+// @Router /api/v1/janitor [post]
+
+func JanitorStatusHandler(janitor *functions.Janitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var status functions.JanitorStatus
+		switch r.Method {
+		case http.MethodGet:
+			status = janitor.Status()
+		case http.MethodPost:
+			status = janitor.Run()
+		default:
+			utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,49}$`)
+
+// RolesHandler godoc
+// @Summary Lists or creates roles
+// @Description GET lists all roles with their own and their effective permissions, including the ones inherited from the parent role. POST creates a role.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param role body models.Role false "Role to create (POST only)"
+// @Success 200 {array} models.Role
+// @Success 201 {object} models.Role
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 409 {object} utils.ErrorResponse "Role already exists"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/roles [get]
+// @Router /api/v1/roles [post]
+
+func RolesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		roles, err := auth.ListRoles()
+		if err != nil {
+			log.Printf("Error loading roles: %v", err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(roles)
+
+	case http.MethodPost:
+		role, ok := decodeRole(w, r)
+		if !ok {
+			return
+		}
+		if !roleNamePattern.MatchString(role.Name) {
+			utils.WriteError(w, "Role name must be lowercase letters, digits, - or _", http.StatusBadRequest)
+			return
+		}
+		exists, err := auth.RoleExists(role.Name)
+		if err != nil {
+			log.Printf("Error loading roles: %v", err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			utils.WriteError(w, "Role already exists", http.StatusConflict)
+			return
+		}
+		if !validateRole(w, role) {
+			return
+		}
+
+		if err := database.CreateRole(role); err != nil {
+			log.Printf("Error creating role %s: %v", role.Name, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		auth.InvalidateRoles()
+		recordAudit(r, models.AuditEvent{Action: audit.ActionRoleCreate, Target: role.Name, Outcome: audit.OutcomeSuccess, Details: rolePermissionsDetails(role)})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(role)
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// RoleHandler godoc
+// @Summary Updates or deletes a role
+// @Description PUT replaces the description, parent and permissions of a role. DELETE removes a role that is neither assigned to a user nor the parent of another role; the admin role can't be deleted.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param role body models.Role false "New role definition (PUT only)"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 404 {object} utils.ErrorResponse "Role not found"
+// @Failure 409 {object} utils.ErrorResponse "Role is still in use"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/roles/{name} [put]
+// @Router /api/v1/roles/{name} [delete]
+
+func RoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	switch r.Method {
+	case http.MethodPut:
+		role, ok := decodeRole(w, r)
+		if !ok {
+			return
+		}
+		role.Name = name
+		if !validateRole(w, role) {
+			return
+		}
+
+		updated, err := database.UpdateRole(role)
+		if err != nil {
+			log.Printf("Error updating role %s: %v", name, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !updated {
+			utils.WriteError(w, "Role not found", http.StatusNotFound)
+			return
+		}
+		auth.InvalidateRoles()
+		recordAudit(r, models.AuditEvent{Action: audit.ActionRoleUpdate, Target: role.Name, Outcome: audit.OutcomeSuccess, Details: rolePermissionsDetails(role)})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(role)
+
+	case http.MethodDelete:
+		deleteRole(w, r, name)
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// PermissionsHandler godoc
+// @Summary Lists the permissions
+// @Description Lists every permission that can be granted to a role.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} string
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Router /api/v1/permissions [get]
+
+func PermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.Permissions)
+}
+
+func deleteRole(w http.ResponseWriter, r *http.Request, name string) {
+	if name == auth.AdminRole {
+		utils.WriteError(w, "The admin role can't be deleted", http.StatusBadRequest)
+		return
+	}
+
+	// a role in use can't go away, users would lose their permissions silently
+	users, err := database.CountUsersWithRole(name)
+	if err != nil {
+		log.Printf("Error counting users of role %s: %v", name, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if users > 0 {
+		utils.WriteError(w, "Role is still assigned to users", http.StatusConflict)
+		return
+	}
+	roles, err := database.GetRoles()
+	if err != nil {
+		log.Printf("Error loading roles: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	for _, role := range roles {
+		if role.Parent == name {
+			utils.WriteError(w, "Role is the parent of "+role.Name, http.StatusConflict)
+			return
+		}
+	}
+
+	deleted, err := database.DeleteRole(name)
+	if err != nil {
+		log.Printf("Error deleting role %s: %v", name, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		utils.WriteError(w, "Role not found", http.StatusNotFound)
+		return
+	}
+	auth.InvalidateRoles()
+	recordAudit(r, models.AuditEvent{Action: audit.ActionRoleDelete, Target: name, Outcome: audit.OutcomeSuccess})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role deleted"})
+}
+
+// decodeRole reads a role from the request body, with its permissions deduplicated and sorted.
+func decodeRole(w http.ResponseWriter, r *http.Request) (*models.Role, bool) {
+	var role models.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, permission := range role.Permissions {
+		if !seen[permission] {
+			seen[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.Strings(permissions)
+	role.Permissions = permissions
+	role.EffectivePermissions = nil
+	return &role, true
+}
+
+func validateRole(w http.ResponseWriter, role *models.Role) bool {
+	err := auth.ValidateRole(*role)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrRoleCycle):
+		utils.WriteError(w, "Role can't inherit from itself", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrUnknownRole):
+		utils.WriteError(w, "Unknown parent role", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrInvalidRole):
+		utils.WriteError(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Error validating role %s: %v", role.Name, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// rolePermissionsDetails describes a role for the audit log.
+func rolePermissionsDetails(role *models.Role) string {
+	return "parent " + role.Parent + ", permissions " + strings.Join(role.Permissions, " ")
+}
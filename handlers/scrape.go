@@ -1,83 +1,124 @@
 package handlers
 
 import (
-	"archive/zip"
-	"io"
+	"GoGrab/audit"
+	"GoGrab/export"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"encoding/json"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 )
 
 // GetScrapedDataHandler godoc
-// @Summary Download scraped data as a ZIP file
-// @Description Retrieves all scraped data from the "scraping_folder" and provides it as a downloadable ZIP file.
+// @Summary Download scraped data
+// @Description Retrieves the scraped data as a ZIP file of the raw host files (the default), or as NDJSON, flattened CSV, Parquet or a SQLite database.
+// @Description The ZIP file starts with manifest.json, listing the files with their sizes and SHA-256 hashes and the crawl jobs they contain. Use /api/v1/archives for resumable downloads.
+// @Description The format is selected by the format query parameter or else by the Accept header. The other formats accept the same filters as /api/v1/pages and only contain the pages of the workspace of the request, like /api/v1/pages. The ZIP file contains every workspace and needs the data:read:any permission.
 // @Tags Scraping
 // @Produce application/zip
-// @Success 200 {file} file "ZIP file containing scraped data"
-// @Failure 405 {string} string "Invalid request method"
-// @Failure 500 {string} string "Failed to zip folder"
-// @Router /api/get-data [get]
+// @Produce application/x-ndjson
+// @Produce text/csv
+// @Produce application/vnd.apache.parquet
+// @Produce application/vnd.sqlite3
+// @Param format query string false "zip, ndjson, csv, parquet or sqlite"
+// @Param X-Organization-ID header int false "Organization whose pages are exported"
+// @Param job_id query string false "Crawl job ID"
+// @Param host query string false "Hostname, e.g. example.com"
+// @Param url query string false "URL pattern, * matches any characters"
+// @Param crawled_before query string false "RFC 3339 timestamp"
+// @Param crawled_after query string false "RFC 3339 timestamp"
+// @Success 200 {file} file "Scraped data in the requested format"
+// @Failure 400 {object} utils.ErrorResponse "Unsupported format or invalid filter"
+// @Failure 403 {object} utils.ErrorResponse "Not a member of the organization, or ZIP download without data:read:any"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Failed to zip folder"
+// @Router /api/v1/data [get]
 
-func GetScrapedDataHandler(w http.ResponseWriter, r *http.Request) {
-	// check if the request method is GET, as only GET is allowed for downloading the ZIP file
-	if r.Method != http.MethodGet {
-		// if the method is not GET, return a 405 Method Not Allowed error
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// create a new ZIP writer that will write the ZIP file to the response
-	zipWriter := zip.NewWriter(w)
-
-	// ensure that the ZIP writer is closed after the function returns
-	defer zipWriter.Close()
-
-	// define the path to the folder where the scraped data is stored
-	folderPath := "scraping_folder"
-
-	// walk through all the files in the "scraping_folder"
-	err := filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
+func GetScrapedDataHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the format query parameter takes precedence over the Accept header
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = export.FormatFromAccept(r.Header.Get("Accept"))
+		}
+		if format != "" && format != "zip" {
+			exportScrapedData(w, r, store, format)
+			return
+		}
 
-		// if there's an error accessing a file, return the error to terminate the walk
-		if err != nil {
-			return err
+		// the ZIP archive contains the raw host files of every workspace, so it can't be filtered
+		if !middleware.GetWorkspaceFromContext(r.Context()).All {
+			utils.WriteError(w, "ZIP downloads contain every workspace and need data:read:any, use another format", http.StatusForbidden)
+			return
 		}
-		// skip any non-regular files (e.g., directories, symlinks)
-		if !info.Mode().IsRegular() {
-			return nil
+		if filter, err := parsePageFilter(r); err != nil || !filter.IsEmpty() {
+			utils.WriteError(w, "Filters are not supported for ZIP downloads, use another format", http.StatusBadRequest)
+			return
 		}
-		// create a file in the ZIP archive with the same relative path as in the folder
-		fileInZip, err := zipWriter.Create(path[len(folderPath)+1:])
+
+		// open a consistent snapshot of all host files, later writes don't affect it
+		snapshot, err := store.OpenSnapshot()
 		if err != nil {
-			// return the error if the file can't be added to the ZIP
-			return err
+			log.Printf("Error opening scraped data: %v", err)
+			utils.WriteError(w, "Failed to zip folder", http.StatusInternalServerError)
+			return
 		}
+		// ensure that the files are closed after the function returns
+		defer snapshot.Close()
 
-		// open the current file in the folder
-		file, err := os.Open(path)
+		// build the manifest before anything is written, so errors can still be reported with a 500
+		manifest, err := export.BuildManifest(snapshot)
 		if err != nil {
-			// return the error if the file can't be opened
-			return err
+			log.Printf("Error building manifest: %v", err)
+			utils.WriteError(w, "Failed to zip folder", http.StatusInternalServerError)
+			return
 		}
 
-		// ensure that the file is closed after copying its contents
-		defer file.Close()
+		// set the content type and the Content-Disposition header before the body is written
+		recordAudit(r, models.AuditEvent{Action: audit.ActionDataDownload, Target: "zip", Outcome: audit.OutcomeSuccess})
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="scraped_data.zip"`)
+		w.WriteHeader(http.StatusOK)
 
-		// copy the contents of the file into the ZIP archive
-		_, err = io.Copy(fileInZip, file)
-		// return any errors that occurred during the copy operation
-		return err
-	})
+		if err := export.WriteZip(w, snapshot, manifest); err != nil {
+			// abort the connection, so the client sees a failed download instead of a broken archive
+			log.Printf("Error streaming ZIP: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
 
-	// if there was an error during the folder walk or zipping process, return a 500 error
+// exportScrapedData streams the pages matching the request's filters in one of the export formats.
+func exportScrapedData(w http.ResponseWriter, r *http.Request, store *storage.Store, format string) {
+	if !export.IsFormat(format) {
+		utils.WriteError(w, "Unsupported format", http.StatusBadRequest)
+		return
+	}
+	filter, err := parsePageFilter(r)
+	if err != nil {
+		utils.WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := middleware.GetUserFromContext(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to zip folder: "+err.Error(), http.StatusInternalServerError)
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	// set the content type to application/zip for the ZIP file download
-	w.Header().Set("Content-Type", "application/zip")
-	// set the Content-Disposition header to trigger a file download with the given filename
-	w.Header().Set("Content-Disposition", `attachment; filename="scraped_data.zip"`)
-	/*// write the HTTP 200 OK status code to indicate success
-	w.WriteHeader(http.StatusOK) */
+	filter.InWorkspace(middleware.GetWorkspaceFromContext(r.Context()), user.ID)
+	selection, _ := json.Marshal(filter)
+	recordAudit(r, models.AuditEvent{Action: audit.ActionDataDownload, Target: format, Outcome: audit.OutcomeSuccess, Details: string(selection)})
+
+	// headers have to be set before the first byte of the export is written
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.FileName(format)+`"`)
+
+	if err := export.Write(w, store, format, filter); err != nil {
+		// the status line is already sent, so abort the connection instead of
+		// letting the client believe the truncated export is complete
+		log.Printf("Error exporting scraped data as %s: %v", format, err)
+		panic(http.ErrAbortHandler)
+	}
 }
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// sessionInfo is a session as listed to its user, with the session of the request marked as current.
+type sessionInfo struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// SessionsHandler godoc
+// @Summary Lists the user's sessions
+// @Description Lists the active sessions of the logged in user, with device, IP and timestamps. The session of the request is marked as current.
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} sessionInfo
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/sessions [get]
+
+func SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := database.GetActiveSessions(user.ID)
+	if err != nil {
+		log.Printf("Error loading sessions: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	currentID := middleware.GetSessionIDFromContext(r.Context())
+	result := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, sessionInfo{Session: session, Current: session.ID == currentID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// SessionHandler godoc
+// @Summary Revokes one of the user's sessions
+// @Description Revokes a session of the logged in user together with its refresh tokens, e.g. to log out a lost device.
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]string "Session revoked"
+// @Failure 404 {object} utils.ErrorResponse "Session not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/sessions/{id} [delete]
+
+func SessionHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// users can only revoke their own sessions, someone else's session ID is simply not found
+	revoked, err := auth.RevokeSession(user.ID, r.PathValue("id"))
+	if err != nil {
+		log.Printf("Error revoking session: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		utils.WriteError(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
+
+// UserSessionsHandler godoc
+// @Summary Revokes all sessions of a user
+// @Description Revokes every session and refresh token of the given user, logging them out everywhere.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]int64 "revoked"
+// @Failure 400 {object} utils.ErrorResponse "Invalid user ID"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/{id}/sessions [delete]
+
+func UserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := auth.RevokeAllSessions(userID)
+	if err != nil {
+		log.Printf("Error revoking sessions of user %d: %v", userID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked})
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// LoginTwoFactorHandler godoc
+// @Summary Second step of a login with two-factor authentication
+// @Description Completes a login with the challenge_token returned by /api/v1/login and a TOTP code or a recovery code. For an enrollment challenge the code confirms the new authenticator, and the response also contains the recovery codes. After five wrong codes the login has to start over.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param challenge body object true "{\"challenge_token\": \"...\", \"code\": \"123456\"}"
+// @Success 200 {object} map[string]interface{} "access_token, refresh_token and their expiry"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} utils.ErrorResponse "Invalid or expired challenge, or invalid code"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 429 {object} utils.ErrorResponse "Too many failed logins"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/login/2fa [post]
+
+func LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ChallengeToken == "" || request.Code == "" {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	challenge, user, ok := loadLoginChallenge(w, request.ChallengeToken)
+	if !ok {
+		return
+	}
+	ip := utils.ClientIP(r)
+	if loginThrottled(w, user.Username, ip) {
+		return
+	}
+
+	var extra map[string]interface{}
+	var err error
+	if challenge.Purpose == models.ChallengeEnroll {
+		var codes []string
+		codes, err = auth.ConfirmTOTPEnrollment(user.ID, request.Code)
+		if errors.Is(err, auth.ErrTOTPNotPending) {
+			utils.WriteError(w, "Start the enrollment at /api/v1/login/2fa/enroll first", http.StatusBadRequest)
+			return
+		}
+		extra = map[string]interface{}{"recovery_codes": codes}
+	} else {
+		err = auth.VerifySecondFactor(user, request.Code)
+	}
+	if errors.Is(err, auth.ErrInvalidCode) {
+		if err := auth.FailLoginChallenge(challenge); err != nil {
+			log.Printf("Error counting failed login challenge: %v", err)
+		}
+		recordLoginFailure(r, user.Username, ip, "invalid second factor")
+		utils.WriteError(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying second factor of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// only one request can use up the challenge
+	if err := auth.CompleteLoginChallenge(challenge); err != nil {
+		utils.WriteError(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+	startLogin(w, r, user, ip, extra)
+}
+
+// LoginTwoFactorEnrollHandler godoc
+// @Summary Sets up two-factor authentication during login
+// @Description For users whose role requires two-factor authentication but who haven't set it up yet. Takes the enrollment challenge_token returned by /api/v1/login and returns a new TOTP secret with its otpauth:// provisioning URI; the login is completed at /api/v1/login/2fa with a code of it.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param challenge body object true "{\"challenge_token\": \"...\"}"
+// @Success 200 {object} map[string]string "secret and provisioning_uri"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} utils.ErrorResponse "Invalid or expired challenge"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/login/2fa/enroll [post]
+
+func LoginTwoFactorEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ChallengeToken string `json:"challenge_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ChallengeToken == "" {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	challenge, user, ok := loadLoginChallenge(w, request.ChallengeToken)
+	if !ok {
+		return
+	}
+	if challenge.Purpose != models.ChallengeEnroll {
+		utils.WriteError(w, "Two-factor authentication is already set up", http.StatusBadRequest)
+		return
+	}
+	beginTOTPEnrollment(w, user)
+}
+
+// MyTwoFactorHandler godoc
+// @Summary Manages the user's two-factor authentication
+// @Description GET shows whether two-factor authentication is enabled or required and how many recovery codes are left. POST starts the enrollment and returns a new TOTP secret with its otpauth:// provisioning URI, confirmed at /api/v1/users/me/2fa/verify. DELETE turns it off given a current code, unless the user's role requires it.
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param code body object false "{\"code\": \"123456\"} (DELETE only)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or 2FA required by the role"
+// @Failure 401 {object} utils.ErrorResponse "Invalid code"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 429 {object} utils.ErrorResponse "Too many failed attempts"
+// @Failure 409 {object} utils.ErrorResponse "Two-factor authentication is already enabled"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/me/2fa [get]
+// @Router /api/v1/users/me/2fa [post]
+// @Router /api/v1/users/me/2fa [delete]
+
+func MyTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		required, err := auth.RoleRequires2FA(user.Role)
+		if err != nil {
+			log.Printf("Error loading roles: %v", err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		left, err := database.CountRecoveryCodes(user.ID)
+		if err != nil {
+			log.Printf("Error counting recovery codes of user %d: %v", user.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled":             user.TOTPEnabled,
+			"required":            required,
+			"recovery_codes_left": left,
+		})
+
+	case http.MethodPost:
+		beginTOTPEnrollment(w, user)
+
+	case http.MethodDelete:
+		if !verifyCode(w, r, user) {
+			return
+		}
+		err := auth.DisableTOTP(user)
+		if errors.Is(err, auth.ErrTwoFactorRequired) {
+			utils.WriteError(w, "Your role requires two-factor authentication", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error disabling two-factor authentication of user %d: %v", user.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// MyTwoFactorVerifyHandler godoc
+// @Summary Confirms the two-factor enrollment
+// @Description Enables two-factor authentication with a code of the secret returned by POST /api/v1/users/me/2fa and returns the recovery codes. They are only shown once.
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param code body object true "{\"code\": \"123456\"}"
+// @Success 200 {object} map[string][]string "recovery_codes"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or no pending enrollment"
+// @Failure 401 {object} utils.ErrorResponse "Invalid code"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/me/2fa/verify [post]
+
+func MyTwoFactorVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := auth.ConfirmTOTPEnrollment(user.ID, code)
+	switch {
+	case errors.Is(err, auth.ErrTOTPNotPending):
+		utils.WriteError(w, "Start the enrollment with POST /api/v1/users/me/2fa first", http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrInvalidCode):
+		utils.WriteError(w, "Invalid code", http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("Error confirming two-factor enrollment of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// MyRecoveryCodesHandler godoc
+// @Summary Regenerates the recovery codes
+// @Description Replaces all recovery codes of the user with new ones, given a current TOTP or recovery code. The new codes are only shown once.
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param code body object true "{\"code\": \"123456\"}"
+// @Success 200 {object} map[string][]string "recovery_codes"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} utils.ErrorResponse "Invalid code"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/me/2fa/recovery-codes [post]
+
+func MyRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if !verifyCode(w, r, user) {
+		return
+	}
+
+	codes, err := auth.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		log.Printf("Error regenerating recovery codes of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// UserTwoFactorHandler godoc
+// @Summary Resets the two-factor authentication of a user
+// @Description Turns off two-factor authentication for a user who lost their authenticator and recovery codes, and revokes their sessions. If their role requires it, they set it up again at the next login.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string "Two-factor authentication reset"
+// @Failure 400 {object} utils.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/{id}/2fa [delete]
+
+func UserTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := refuseSelf(w, r, user.ID); !ok {
+		return
+	}
+
+	if _, err := database.DisableTOTP(user.ID); err != nil {
+		log.Printf("Error resetting two-factor authentication of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !revokeUserSessions(w, user.ID) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication reset"})
+}
+
+// loadLoginChallenge looks up a login challenge and its user, answering with 401 if either is gone.
+func loadLoginChallenge(w http.ResponseWriter, token string) (*models.LoginChallenge, *models.User, bool) {
+	challenge, err := auth.GetLoginChallenge(token)
+	if errors.Is(err, auth.ErrInvalidChallenge) {
+		utils.WriteError(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading login challenge: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	// the account may have been locked since the password step
+	user, err := database.GetUserByID(challenge.UserID)
+	if err != nil || user.ID == 0 || user.LockedAt != nil {
+		utils.WriteError(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	return challenge, user, true
+}
+
+// loadCurrentUser reads the logged in user from the database, with the 2FA state the context doesn't carry.
+func loadCurrentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	current, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	user, err := database.GetUserByID(current.ID)
+	if err != nil || user.ID == 0 {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return user, true
+}
+
+func beginTOTPEnrollment(w http.ResponseWriter, user *models.User) {
+	secret, uri, err := auth.BeginTOTPEnrollment(user)
+	if errors.Is(err, auth.ErrTOTPEnabled) {
+		utils.WriteError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error starting two-factor enrollment of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": uri,
+	})
+}
+
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return "", false
+	}
+	return request.Code, true
+}
+
+// verifyCode checks the TOTP or recovery code in the request body, which guards changes to the 2FA setup.
+func verifyCode(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return false
+	}
+	// wrong codes count like failed logins, so they can't be guessed through a stolen session
+	ip := utils.ClientIP(r)
+	if loginThrottled(w, user.Username, ip) {
+		return false
+	}
+	err := auth.VerifySecondFactor(user, code)
+	if errors.Is(err, auth.ErrInvalidCode) {
+		recordLoginFailure(r, user.Username, ip, "invalid second factor")
+		utils.WriteError(w, "Invalid code", http.StatusUnauthorized)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error verifying second factor of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 500
+)
+
+// UsersHandler godoc
+// @Summary Lists and searches users
+// @Description Lists the users ordered by ID. q searches the usernames, role and locked filter them; limit and offset page through the result.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param q query string false "Part of the username"
+// @Param role query string false "Role"
+// @Param locked query bool false "Only locked or only unlocked users"
+// @Param limit query int false "Page size, 50 by default and at most 500"
+// @Param offset query int false "Number of users to skip"
+// @Success 200 {object} map[string]interface{} "total and users"
+// @Failure 400 {object} utils.ErrorResponse "Invalid query parameter"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users [get]
+
+func UsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := database.UserFilter{Query: query.Get("q"), Role: query.Get("role"), Limit: defaultUserPageSize}
+	if value := query.Get("locked"); value != "" {
+		locked, err := strconv.ParseBool(value)
+		if err != nil {
+			utils.WriteError(w, "Invalid locked parameter", http.StatusBadRequest)
+			return
+		}
+		filter.Locked = &locked
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxUserPageSize {
+			utils.WriteError(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			utils.WriteError(w, "Invalid offset parameter", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	users, total, err := database.SearchUsers(filter)
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total": total,
+		"users": users,
+	})
+}
+
+// UserHandler godoc
+// @Summary Shows or deletes a user
+// @Description GET returns a user. DELETE removes the user with their sessions and API keys; their scraped pages are moved to the trash (data=delete, the default) or handed over to another user (data=reassign with reassign_to). Admins can't delete themselves.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Param data query string false "delete or reassign (DELETE only)"
+// @Param reassign_to query int false "User ID that receives the pages (DELETE with data=reassign only)"
+// @Success 200 {object} models.User
+// @Failure 400 {object} utils.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/{id} [get]
+// @Router /api/v1/users/{id} [delete]
+
+func UserHandler(store *storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadTargetUser(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			user.Password = ""
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(user)
+
+		case http.MethodDelete:
+			deleteUser(w, r, store, user)
+
+		default:
+			utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func deleteUser(w http.ResponseWriter, r *http.Request, store *storage.Store, user *models.User) {
+	admin, ok := refuseSelf(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	response := map[string]interface{}{"message": "User deleted"}
+
+	// take care of the scraped data first, a failure leaves the user in place to retry
+	switch r.URL.Query().Get("data") {
+	case "", "delete":
+		result, err := store.DeletePages(storage.PageFilter{UserID: user.ID}, false, admin.ID)
+		if err != nil {
+			log.Printf("Error deleting pages of user %d: %v", user.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		response["pages_deleted"] = result.Matched
+		if result.TrashID != "" {
+			response["trash_id"] = result.TrashID
+		}
+
+	case "reassign":
+		targetID, err := strconv.Atoi(r.URL.Query().Get("reassign_to"))
+		if err != nil || targetID == user.ID {
+			utils.WriteError(w, "reassign_to must be the ID of another user", http.StatusBadRequest)
+			return
+		}
+		target, err := database.GetUserByID(targetID)
+		if err != nil || target.ID == 0 {
+			utils.WriteError(w, "reassign_to must be the ID of another user", http.StatusBadRequest)
+			return
+		}
+		reassigned, err := store.ReassignPages(user.ID, target.ID)
+		if err != nil {
+			log.Printf("Error reassigning pages of user %d: %v", user.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		response["pages_reassigned"] = reassigned
+
+	default:
+		utils.WriteError(w, "data must be delete or reassign", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := database.DeleteUser(user.ID); err != nil {
+		log.Printf("Error deleting user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	details := fmt.Sprintf("%v pages deleted, trash %v", response["pages_deleted"], response["trash_id"])
+	if reassigned, ok := response["pages_reassigned"]; ok {
+		details = fmt.Sprintf("%v pages reassigned to user %s", reassigned, r.URL.Query().Get("reassign_to"))
+	}
+	recordAudit(r, models.AuditEvent{Action: audit.ActionUserDelete, Target: user.Username, Outcome: audit.OutcomeSuccess, Details: details})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UserRoleHandler godoc
+// @Summary Changes the role of a user
+// @Description Assigns another role to a user. The user's sessions are revoked, so the new role applies right away. Admins can't change their own role.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body object true "{\"role\": \"viewer\"}"
+// @Success 200 {object} map[string]string "Role changed"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or unknown role"
+// @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/{id}/role [put]
+
+func UserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := refuseSelf(w, r, user.ID); !ok {
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Role == "" {
+		utils.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	exists, err := auth.RoleExists(request.Role)
+	if err != nil {
+		log.Printf("Error loading roles: %v", err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		utils.WriteError(w, "Unknown role", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := database.UpdateUserRole(user.ID, request.Role); err != nil {
+		log.Printf("Error changing role of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r, models.AuditEvent{Action: audit.ActionUserRoleChange, Target: user.Username, Outcome: audit.OutcomeSuccess, Details: user.Role + " -> " + request.Role})
+	// access tokens carry the role, so the old ones have to go
+	if !revokeUserSessions(w, user.ID) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role changed"})
+}
+
+// UserLockHandler godoc
+// @Summary Locks or unlocks a user
+// @Description POST locks the account: the user can't log in anymore, their sessions are revoked and their API keys stop working. DELETE unlocks it again, including a temporary lockout after failed logins. Admins can't lock themselves.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string "User locked or unlocked"
+// @Failure 400 {object} utils.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/{id}/lock [post]
+// @Router /api/v1/users/{id}/lock [delete]
+
+func UserLockHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+	admin, ok := refuseSelf(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	locked := r.Method == http.MethodPost
+	if _, err := database.SetUserLocked(user.ID, locked); err != nil {
+		log.Printf("Error locking user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	message := "User unlocked"
+	if !locked {
+		// unlocking also lifts a lockout after failed logins
+		if _, err := auth.UnlockLogin(models.LoginFailureAccount, user.Username, admin.ID, utils.ClientIP(r)); err != nil {
+			log.Printf("Error clearing failed logins of user %d: %v", user.ID, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		message = "User locked"
+		if !revokeUserSessions(w, user.ID) {
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// UserPasswordResetHandler godoc
+// @Summary Forces a password reset
+// @Description Logs the user out everywhere and issues a one-time reset token, which the user redeems at /api/v1/password-reset. Until then the user can't log in; knowing the old password, /api/v1/change-password works as well. Issuing a new token invalidates the earlier ones.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "reset_token and expires_at"
+// @Failure 400 {object} utils.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 409 {object} utils.ErrorResponse "Password is managed by the directory or identity provider"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/{id}/password-reset [post]
+
+func UserPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	admin, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, ok := loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if !hasLocalPassword(w, user) {
+		return
+	}
+
+	if _, err := database.SetMustChangePassword(user.ID, true); err != nil {
+		log.Printf("Error forcing password reset of user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !revokeUserSessions(w, user.ID) {
+		return
+	}
+	token, expiresAt, err := auth.IssuePasswordResetToken(user.ID, admin.ID)
+	if err != nil {
+		log.Printf("Error issuing password reset token for user %d: %v", user.ID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     "Password reset required",
+		"reset_token": token,
+		"expires_at":  expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// loadTargetUser reads the user given by the id path value, writing the error response if there is none.
+func loadTargetUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if user.ID == 0 {
+		utils.WriteError(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
+
+// refuseSelf keeps admins from locking, demoting or deleting themselves, and returns the acting user.
+func refuseSelf(w http.ResponseWriter, r *http.Request, userID int) (*models.User, bool) {
+	admin, err := middleware.GetUserFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if admin.ID == userID {
+		utils.WriteError(w, "You can't do this to your own account", http.StatusBadRequest)
+		return nil, false
+	}
+	return admin, true
+}
+
+func revokeUserSessions(w http.ResponseWriter, userID int) bool {
+	if _, err := auth.RevokeAllSessions(userID); err != nil {
+		log.Printf("Error revoking sessions of user %d: %v", userID, err)
+		utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// LoginLockoutsHandler godoc
+// @Summary Lists or lifts login lockouts
+// @Description GET lists the accounts and IPs that are locked out after too many failed logins. DELETE lifts the lockout given by kind (account or ip) and subject (the username or IP).
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param kind query string false "account or ip (DELETE only)"
+// @Param subject query string false "Username or IP (DELETE only)"
+// @Success 200 {array} models.LoginFailure
+// @Failure 400 {object} utils.ErrorResponse "Invalid kind or subject"
+// @Failure 404 {object} utils.ErrorResponse "Lockout not found"
+// @Failure 405 {object} utils.ErrorResponse "Invalid request method"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/login-lockouts [get]
+// @Router /api/v1/login-lockouts [delete]
+
+func LoginLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		lockouts, err := database.GetActiveLoginLockouts()
+		if err != nil {
+			log.Printf("Error loading login lockouts: %v", err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if lockouts == nil {
+			lockouts = []models.LoginFailure{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(lockouts)
+
+	case http.MethodDelete:
+		admin, err := middleware.GetUserFromContext(r.Context())
+		if err != nil {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		kind, subject := r.URL.Query().Get("kind"), r.URL.Query().Get("subject")
+		if (kind != models.LoginFailureAccount && kind != models.LoginFailureIP) || subject == "" {
+			utils.WriteError(w, "kind must be account or ip and subject is required", http.StatusBadRequest)
+			return
+		}
+
+		cleared, err := auth.UnlockLogin(kind, subject, admin.ID, utils.ClientIP(r))
+		if err != nil {
+			log.Printf("Error lifting login lockout of %s %s: %v", kind, subject, err)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !cleared {
+			utils.WriteError(w, "Lockout not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Lockout lifted"})
+
+	default:
+		utils.WriteError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
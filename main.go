@@ -1,18 +1,29 @@
 package main
 
 import (
-	"GoGrab/functions"
-	"GoGrab/routes"
-	"fmt"
+	"GoGrab/config"
+	"GoGrab/server"
 	"log"
-	"net/http"
+	"os"
 )
 
-func main() {
-
-	functions.CheckDatabaseConnection()
-	routes.SetupRoutes()
+// @title Web Scraper API
+// @version 1.0
+// @description This is the API documentation for the Web Scraper application.
+// @host localhost:8080
+// @BasePath /
+// @schemes http
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description An access token or API key as "Bearer <token>".
 
-	fmt.Println("Server started at port:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := server.Run(cfg); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -1,58 +1,73 @@
 package middleware
 
 import (
+	"GoGrab/audit"
+	"GoGrab/auth"
 	"GoGrab/database"
 	"GoGrab/models"
+	"GoGrab/utils"
 	"context"
 	"errors"
+	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
-
-	"github.com/golang-jwt/jwt/v4"
 )
 
 type contextKey string
 
-const userContextKey contextKey = "user"
-
-var jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
+const (
+	userContextKey    contextKey = "user"
+	sessionContextKey contextKey = "session"
+	apiKeyContextKey  contextKey = "api_key"
+)
 
 // JWTAuthMiddleware checks the JWT token and sets the user information in the context.
+// API keys are accepted as well, either in the X-API-Key header or as a "Bearer gg_..." token.
 func JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
 
 		// Extract the token from the "Bearer <token>" format
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Parse and validate the JWT token
-		claims := &models.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(w, r, apiKey, next)
+			return
+		}
+		if auth.IsAPIKey(tokenString) {
+			authenticateAPIKey(w, r, tokenString, next)
+			return
+		}
+
+		if authHeader == "" {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		// Parse and validate the JWT token, including its issuer and audience
+		claims, err := auth.ParseAccessToken(tokenString)
+		if err != nil {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		// Convert Subject claim (user ID) from string to int
 		userID, err := strconv.Atoi(claims.Subject)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			utils.WriteError(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		if valid, err := database.CheckUserToken(userID, tokenString); !valid || err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		// the token must be the latest one of an active session of the user
+		session, err := database.GetSession(claims.ID)
+		if err != nil || !auth.IsSessionActive(session, userID) || session.TokenHash != auth.HashToken(tokenString) {
+			utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if err := database.TouchSession(session.ID); err != nil {
+			log.Printf("Error updating session %s: %v", session.ID, err)
+		}
 
 		// Extract user information from claims and store it in context
 		user := &models.User{
@@ -60,33 +75,101 @@ func JWTAuthMiddleware(next http.Handler) http.Handler {
 			Role: claims.Role, // Setting the Role from the JWT claims
 		}
 
-		// Store the user information in the request context
+		// Store the user information and the session ID in the request context
 		ctx := SetUserInContext(r.Context(), user)
+		ctx = context.WithValue(ctx, sessionContextKey, session.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func RequireRole(role string, next http.Handler) http.Handler {
+// authenticateAPIKey validates an API key and stores its owner and the key itself in the context.
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, rawKey string, next http.Handler) {
+	key, err := auth.AuthenticateAPIKey(rawKey)
+	if err != nil {
+		if !errors.Is(err, auth.ErrInvalidAPIKey) {
+			log.Printf("Error authenticating API key: %v", err)
+		}
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// API keys carry no claims, so the role is read from the database; keys of locked users stop working
+	user, err := database.GetUserByID(key.UserID)
+	if err != nil || user.ID == 0 || user.LockedAt != nil {
+		utils.WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := SetUserInContext(r.Context(), &models.User{ID: user.ID, Role: user.Role})
+	ctx = context.WithValue(ctx, apiKeyContextKey, key)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireScope lets API keys through only if they were granted the scope.
+// Requests authenticated with a session token are not restricted by scopes.
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := GetAPIKeyFromContext(r.Context()); key != nil && !key.HasScope(scope) {
+			utils.WriteError(w, "Forbidden: API key lacks the "+scope+" scope", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession rejects API keys, for endpoints that need an interactive login,
+// like managing sessions and API keys or the admin endpoints.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetAPIKeyFromContext(r.Context()) != nil {
+			utils.WriteError(w, "Forbidden: API keys can't be used for this endpoint", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireLocalLogin turns off the username and password endpoints unless local logins are enabled,
+// leaving single sign-on as the only way to log in.
+func RequireLocalLogin(enabled bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !enabled {
+			utils.WriteError(w, "Local login is disabled, use single sign-on", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission only lets users through whose role grants the permission, directly or inherited.
+func RequirePermission(permission string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// retrieve the user from the request context
-		user, err := getUserFromContext(r.Context())
+		user, err := GetUserFromContext(r.Context())
 		if err != nil {
-			http.Error(w, "Forbidden: User not found", http.StatusForbidden)
+			utils.WriteError(w, "Forbidden: User not found", http.StatusForbidden)
 			return
 		}
-		// check if the user's role matches the required role
-		if user.Role != role {
-			// if the user doesn't have the required role, return a 403 Forbidden status
-			http.Error(w, "Forbidden: Insufficient role", http.StatusForbidden)
+		if !auth.HasPermission(user.Role, permission) {
+			audit.Record(models.AuditEvent{
+				Action:    audit.ActionPermissionDenied,
+				ActorID:   user.ID,
+				IP:        utils.ClientIP(r),
+				RequestID: audit.RequestID(r.Context()),
+				Target:    r.Method + " " + r.URL.Path,
+				Outcome:   audit.OutcomeDenied,
+				Details:   "missing " + permission,
+			})
+			utils.WriteError(w, "Forbidden: Missing the "+permission+" permission", http.StatusForbidden)
 			return
 		}
 
-		// if the user has the required role, proceed to the next handler
 		next.ServeHTTP(w, r)
 	})
 }
 
-func getUserFromContext(ctx context.Context) (*models.User, error) {
+// GetUserFromContext returns the authenticated user stored in the context by JWTAuthMiddleware.
+func GetUserFromContext(ctx context.Context) (*models.User, error) {
 	// attempt to retrieve the user from the context using a specific key (userContextKey)
 	user, ok := ctx.Value(userContextKey).(*models.User)
 	if !ok {
@@ -97,6 +180,18 @@ func getUserFromContext(ctx context.Context) (*models.User, error) {
 	return user, nil
 }
 
+// GetAPIKeyFromContext returns the API key the request was authenticated with, or nil for session tokens.
+func GetAPIKeyFromContext(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey).(*models.APIKey)
+	return key
+}
+
+// GetSessionIDFromContext returns the ID of the session the request was authenticated with.
+func GetSessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionContextKey).(string)
+	return sessionID
+}
+
 // SetUserInContext adds the user information to the context.
 // this function is used during authentication to store the user in the request context for later use
 func SetUserInContext(ctx context.Context, user *models.User) context.Context {
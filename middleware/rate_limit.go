@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"GoGrab/ratelimit"
+	"GoGrab/utils"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+/*
+RateLimit limits the requests of every principal to the routes of a policy of the limiter with a
+token bucket, see ratelimit.New for the policies. Requests are counted per API key, else per user, else per
+client IP: after JWTAuthMiddleware it tells users apart, before it every request counts against
+its IP, also one with invalid credentials. Requests over the limit get 429 with a Retry-After
+header. If the store fails the request is let through.
+*/
+func RateLimit(limiter *ratelimit.Limiter, policy string, next http.Handler) http.Handler {
+	limits := limiter.Policy(policy)
+	store := limiter.Store()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind, id := ratelimit.PrincipalIP, utils.ClientIP(r)
+		if key := GetAPIKeyFromContext(r.Context()); key != nil {
+			kind, id = ratelimit.PrincipalAPIKey, strconv.Itoa(key.ID)
+		} else if user, err := GetUserFromContext(r.Context()); err == nil {
+			kind, id = ratelimit.PrincipalUser, strconv.Itoa(user.ID)
+		}
+
+		limit, ok := limits[kind]
+		if !ok || !limit.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, retryAfter, err := store.Take(policy+":"+kind+":"+id, limit)
+		if err != nil {
+			log.Printf("Error checking the rate limit of %s %s: %v", kind, id, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !allowed {
+			seconds := int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			utils.WriteErrorDetails(w, "Too many requests, try again later", http.StatusTooManyRequests, map[string]int{"retry_after": seconds})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
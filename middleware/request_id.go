@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"GoGrab/audit"
+	"GoGrab/utils"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// validRequestID limits the request IDs taken over from clients or proxies to something safe to log and store.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+/*
+RequestID gives every request an ID, taken from the X-Request-ID header of a proxy in front of
+GoGrab or generated, and echoes it in the response. Audit events carry it, so an event can be
+matched to the access logs.
+*/
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(requestID) {
+			var err error
+			if requestID, err = utils.GenerateID(); err != nil {
+				log.Printf("Error generating request ID: %v", err)
+				requestID = ""
+			}
+		}
+		if requestID != "" {
+			w.Header().Set("X-Request-ID", requestID)
+		}
+		next.ServeHTTP(w, r.WithContext(audit.WithRequestID(r.Context(), requestID)))
+	})
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey scopes, each one grants access to a group of endpoints.
+const (
+	ScopeCrawl      = "crawl"
+	ScopeReadData   = "read-data"
+	ScopeDeleteData = "delete-data"
+)
+
+// APIKey is a long-lived credential for machine clients. The full key is only shown once
+// at creation, afterwards it is identified by its Prefix; only the hash of the key is stored.
+// Scopes is stored as a comma separated list.
+type APIKey struct {
+	ID         int        `gorm:"primaryKey" json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     string     `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the key grants the given scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range strings.Split(k.Scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+/*
+AuditEvent records a security relevant or data changing action. ActorID is 0 when nobody was
+authenticated, Target names what the action was about, e.g. a username or an IP, and RequestID ties
+the event to the request it happened in. Hash covers every field and PrevHash, the hash of the event
+before it, so removing or editing an event breaks the chain.
+*/
+type AuditEvent struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	Action    string    `json:"action"`
+	ActorID   int       `json:"actor_id"`
+	IP        string    `json:"ip"`
+	RequestID string    `json:"request_id,omitempty"`
+	Target    string    `json:"target"`
+	Outcome   string    `json:"outcome"`
+	Details   string    `json:"details"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// CrawlJob identifies a single crawl request, the user who submitted it and the organization it
+// was submitted for, 0 for the user's personal workspace.
+// Every page saved during the crawl is tagged with the job ID, user ID and organization ID.
+type CrawlJob struct {
+	ID             string     `json:"id"`
+	UserID         int        `json:"user_id"`
+	OrganizationID int        `json:"organization_id,omitempty"`
+	Status         string     `json:"status,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// Statuses of a crawl job, a job is stopped when it runs out of quota and interrupted by a shutdown of
+// the server, which resumes it on its next start.
+const (
+	CrawlJobRunning     = "running"
+	CrawlJobFinished    = "finished"
+	CrawlJobStopped     = "stopped"
+	CrawlJobInterrupted = "interrupted"
+)
+
+// CrawlCheckpoint is the saved state of a crawl: the URLs it still has to visit, in order, and the
+// normalized URLs it already visited.
+type CrawlCheckpoint struct {
+	JobID     string    `json:"job_id"`
+	ToVisit   []string  `json:"to_visit"`
+	Visited   []string  `json:"visited"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Purposes of a LoginChallenge.
+const (
+	ChallengeVerify = "verify" // the user has to enter a TOTP or recovery code
+	ChallengeEnroll = "enroll" // the user's role requires 2FA and the user has to set it up first
+)
+
+// LoginChallenge is the second step of a login with two-factor authentication.
+// It is handed out as a short-lived token after the password was checked; only its hash is stored.
+type LoginChallenge struct {
+	ID        int       `gorm:"primaryKey" json:"id"`
+	UserID    int       `json:"user_id"`
+	TokenHash string    `json:"-"`
+	Purpose   string    `json:"purpose"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
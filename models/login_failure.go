@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Kinds of LoginFailure, failed logins are counted per account and per client IP.
+const (
+	LoginFailureAccount = "account"
+	LoginFailureIP      = "ip"
+)
+
+// LoginFailure counts the recent failed logins of an account (by username) or an IP.
+// LockedUntil is set once the failures reach the lockout threshold.
+type LoginFailure struct {
+	Kind          string     `json:"kind"`
+	Subject       string     `json:"subject"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// OIDCState is a pending single sign-on login. The state parameter is stored hashed,
+// together with the nonce and the PKCE code verifier that the callback needs.
+type OIDCState struct {
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// UserIdentity links a user to an account at an OpenID Connect provider.
+type UserIdentity struct {
+	ID        int       `gorm:"primaryKey" json:"id"`
+	UserID    int       `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Roles of a user within an organization, from least to most privileged.
+// Viewers read the organization's data, members also crawl and delete the pages they crawled,
+// admins delete any page and manage the members, owners also rename and delete the organization.
+const (
+	OrgRoleViewer = "viewer"
+	OrgRoleMember = "member"
+	OrgRoleAdmin  = "admin"
+	OrgRoleOwner  = "owner"
+)
+
+var orgRoleRanks = map[string]int{OrgRoleViewer: 1, OrgRoleMember: 2, OrgRoleAdmin: 3, OrgRoleOwner: 4}
+
+// ValidOrgRole reports whether role is one of the organization roles.
+func ValidOrgRole(role string) bool {
+	return orgRoleRanks[role] > 0
+}
+
+// OrgRoleAtLeast reports whether role grants everything min grants.
+func OrgRoleAtLeast(role, min string) bool {
+	return orgRoleRanks[role] > 0 && orgRoleRanks[role] >= orgRoleRanks[min]
+}
+
+// Organization is a team sharing crawl jobs and scraped data. Role is the role of the
+// requesting user when organizations are listed for them.
+type Organization struct {
+	ID        int       `gorm:"primaryKey" json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy int       `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      string    `json:"role,omitempty"`
+}
+
+// OrganizationMember is the membership of a user in an organization.
+type OrganizationMember struct {
+	OrganizationID int       `json:"organization_id"`
+	UserID         int       `json:"user_id"`
+	Username       string    `json:"username"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+/*
+Workspace is the data a request works on: the pages of an organization, or with OrganizationID 0
+the personal pages of the user, which belong to no organization. Role is the user's role in the
+organization. All is set for users with data:read:any who didn't pick a workspace, they see every page.
+*/
+type Workspace struct {
+	OrganizationID int
+	Role           string
+	All            bool
+}
+
+// Allows reports whether the user may do what needs the given organization role. In the personal
+// workspace and across all workspaces only the user's global permissions count.
+func (w Workspace) Allows(min string) bool {
+	return w.OrganizationID == 0 || OrgRoleAtLeast(w.Role, min)
+}
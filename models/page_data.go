@@ -1,7 +1,19 @@
 package models
 
+import "time"
+
+// PageData is a single fetch of a page. Every crawl of a URL is stored as a new version,
+// all versions of a URL share the same PageID.
 type PageData struct {
-	Title   string `json:"title"`
-	URL     string `json:"url"`
-	Content string `json:"content"`
+	PageID         string    `json:"page_id,omitempty"`
+	Version        int       `json:"version,omitempty"`
+	Title          string    `json:"title"`
+	URL            string    `json:"url"`
+	Content        string    `json:"content"`
+	ContentHash    string    `json:"content_hash,omitempty"`
+	Links          []string  `json:"links,omitempty"`
+	JobID          string    `json:"job_id,omitempty"`
+	UserID         int       `json:"user_id,omitempty"`
+	OrganizationID int       `json:"organization_id,omitempty"`
+	CrawledAt      time.Time `json:"crawled_at"`
 }
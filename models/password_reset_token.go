@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a one-time token an admin issues so a user can set a new password.
+// Only the hash of the token is stored, UsedAt is set once it was redeemed.
+type PasswordResetToken struct {
+	ID        int        `gorm:"primaryKey" json:"id"`
+	UserID    int        `json:"user_id"`
+	TokenHash string     `json:"-"`
+	CreatedBy int        `json:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
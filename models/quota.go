@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Quota scopes.
+const (
+	QuotaScopeRole = "role"
+	QuotaScopeUser = "user"
+)
+
+/*
+Quota limits the crawling of a role or a single user. Scope is "role" or "user" and Target the
+role name or user ID it applies to; a user quota replaces the quota of the user's role.
+MaxBrowserMinutes is per calendar month, MaxPagesPerDay per UTC day. A zero value disables the
+respective limit.
+*/
+type Quota struct {
+	Scope             string    `json:"scope"`
+	Target            string    `json:"target"`
+	MaxConcurrentJobs int       `json:"max_concurrent_jobs"`
+	MaxPagesPerDay    int       `json:"max_pages_per_day"`
+	MaxStoredBytes    int64     `json:"max_stored_bytes"`
+	MaxBrowserMinutes int       `json:"max_browser_minutes"`
+	UpdatedBy         int       `json:"updated_by"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Usage is what a user consumed in a period, as metered while crawling.
+type Usage struct {
+	UserID         int     `json:"user_id"`
+	Username       string  `json:"username,omitempty"`
+	Jobs           int     `json:"jobs"`
+	Pages          int     `json:"pages"`
+	BytesWritten   int64   `json:"bytes_written"`
+	BrowserSeconds int64   `json:"-"`
+	BrowserMinutes float64 `json:"browser_minutes"`
+}
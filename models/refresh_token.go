@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the token is kept.
+// All tokens descending from the same login share a FamilyID; UsedAt is set once the token
+// has been rotated, so any later use of it is a reuse.
+type RefreshToken struct {
+	ID        int        `gorm:"primaryKey" json:"id"`
+	UserID    int        `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
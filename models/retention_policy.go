@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RetentionPolicy limits how long scraped pages are kept.
+// Scope is "user", "job" or "host" and Target is the user ID, job ID or hostname it applies to.
+// MaxAgeDays removes pages older than that many days, KeepLast keeps only the N newest
+// snapshots of every URL. A zero value disables the respective rule.
+type RetentionPolicy struct {
+	ID         int       `gorm:"primaryKey" json:"id"`
+	Scope      string    `json:"scope"`
+	Target     string    `json:"target"`
+	MaxAgeDays int       `json:"max_age_days"`
+	KeepLast   int       `json:"keep_last"`
+	CreatedBy  int       `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Permissions checked by the API. Roles grant them, RequirePermission enforces them.
+const (
+	PermCrawlCreate     = "crawl:create"
+	PermDataRead        = "data:read"
+	PermDataReadAny     = "data:read:any"
+	PermDataDelete      = "data:delete"
+	PermDataDeleteAny   = "data:delete:any"
+	PermTrashManage     = "trash:manage"
+	PermRetentionManage = "retention:manage"
+	PermUsersManage     = "users:manage"
+	PermRolesManage     = "roles:manage"
+	PermOrgsManage      = "orgs:manage"
+	PermAuditRead       = "audit:read"
+	PermUsageRead       = "usage:read"
+)
+
+// Permissions lists every permission a role can be granted.
+var Permissions = []string{
+	PermCrawlCreate,
+	PermDataRead,
+	PermDataReadAny,
+	PermDataDelete,
+	PermDataDeleteAny,
+	PermTrashManage,
+	PermRetentionManage,
+	PermUsersManage,
+	PermRolesManage,
+	PermOrgsManage,
+	PermAuditRead,
+	PermUsageRead,
+}
+
+// Role is a named set of permissions. A role inherits all permissions of its Parent,
+// an empty Parent means it inherits nothing. Users of a role with Require2FA can only log in
+// with two-factor authentication; this is not inherited.
+type Role struct {
+	Name                 string    `gorm:"primaryKey" json:"name"`
+	Description          string    `json:"description"`
+	Parent               string    `json:"parent"`
+	Require2FA           bool      `json:"require_2fa"`
+	Permissions          []string  `gorm:"-" json:"permissions"`
+	EffectivePermissions []string  `gorm:"-" json:"effective_permissions,omitempty"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// RolePermission grants a permission to a role.
+type RolePermission struct {
+	Role       string
+	Permission string
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is a login of a user on one device. The access tokens issued for it carry the
+// session ID, and only the hash of the latest access token is stored.
+type Session struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	UserID     int        `json:"user_id"`
+	TokenHash  string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
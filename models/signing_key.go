@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SigningKey is a key pair used to sign access tokens. The newest key that isn't retired signs new tokens,
+// retired keys are kept for verification until the tokens signed with them have expired.
+type SigningKey struct {
+	KID        string     `gorm:"primaryKey" json:"kid"`
+	Algorithm  string     `json:"algorithm"`
+	PrivateKey string     `json:"-"` // PKCS #8, PEM encoded
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"`
+}
@@ -2,10 +2,27 @@ package models
 
 import "time"
 
+// AuthSource values, where the password of a user is checked.
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+	AuthSourceOIDC  = "oidc"
+)
+
+// User is an account. A locked user can't log in, and a user with MustChangePassword
+// has to set a new password before logging in again. TOTPSecret is set once the user started
+// enrolling in two-factor authentication, TOTPEnabled once the enrollment was confirmed.
+// Users provisioned from a directory or an identity provider have no local password.
 type User struct {
-	ID        int       `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"unique;not null" json:"username"`
-	Password  string    `gorm:"not null" json:"password"`
-	Role      string    `gorm:"not null" json:"role"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                 int        `gorm:"primaryKey" json:"id"`
+	Username           string     `gorm:"unique;not null" json:"username"`
+	Password           string     `gorm:"not null" json:"password,omitempty"`
+	Role               string     `gorm:"not null" json:"role"`
+	AuthSource         string     `json:"auth_source"`
+	LockedAt           *time.Time `json:"locked_at,omitempty"`
+	MustChangePassword bool       `json:"must_change_password"`
+	TOTPSecret         string     `json:"-"`
+	TOTPEnabled        bool       `json:"totp_enabled"`
+	TOTPLastStep       int64      `json:"-"`
+	CreatedAt          time.Time  `json:"created_at"`
 }
@@ -0,0 +1,55 @@
+package oidc
+
+import (
+	"GoGrab/config"
+	"strings"
+)
+
+// Config holds the OpenID Connect settings as used by the login, see NewConfig.
+type Config struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string
+	RoleClaim     string
+	// RoleMapping maps values of the role claim, e.g. IdP groups, to GoGrab roles
+	RoleMapping map[string]string
+	// DefaultRole is given to new users none of whose claim values are mapped; empty refuses them
+	DefaultRole string
+}
+
+/*
+NewConfig turns the auth.oidc settings into the login's settings. The scopes are space separated,
+the role mapping holds comma separated claim=role pairs, e.g. "gograb-admins=admin,staff=user", and
+the default role "none" refuses new users without a mapped claim value.
+*/
+func NewConfig(cfg config.OIDCConfig) Config {
+	oidcConfig := Config{
+		Issuer:        strings.TrimSuffix(cfg.Issuer, "/"),
+		ClientID:      cfg.ClientID,
+		ClientSecret:  cfg.ClientSecret,
+		RedirectURL:   cfg.RedirectURL,
+		Scopes:        strings.Fields(cfg.Scopes),
+		UsernameClaim: cfg.UsernameClaim,
+		RoleClaim:     cfg.RoleClaim,
+		RoleMapping:   make(map[string]string),
+		DefaultRole:   cfg.DefaultRole,
+	}
+	if oidcConfig.DefaultRole == "none" {
+		oidcConfig.DefaultRole = ""
+	}
+	for _, pair := range strings.Split(cfg.RoleMapping, ",") {
+		claim, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && claim != "" && role != "" {
+			oidcConfig.RoleMapping[claim] = role
+		}
+	}
+	return oidcConfig
+}
+
+// Enabled reports whether single sign-on is configured.
+func (c Config) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != "" && c.RedirectURL != ""
+}
@@ -0,0 +1,247 @@
+package oidc
+
+import (
+	"GoGrab/audit"
+	"GoGrab/auth"
+	"GoGrab/database"
+	"GoGrab/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// stateTTL is how long the user has to log in at the provider.
+const stateTTL = 10 * time.Minute
+
+// stateCookieName is the cookie that ties the callback to the browser that started the login.
+const stateCookieName = "gograb_oidc_state"
+
+var (
+	// ErrNotConfigured is returned when no OIDC provider is configured.
+	ErrNotConfigured = errors.New("single sign-on is not configured")
+	// ErrInvalidState is returned for unknown, expired or already used state parameters.
+	ErrInvalidState = errors.New("invalid or expired login state")
+	// ErrBrowserMismatch is returned when the callback doesn't come from the browser that started the login.
+	ErrBrowserMismatch = errors.New("login was started in another browser")
+	// ErrNoRole is returned when a new user has no mapped role and auth.oidc.default_role is "none".
+	ErrNoRole = errors.New("no role is mapped for this account")
+	// ErrUsernameClaim is returned when the ID token lacks the configured username claim.
+	ErrUsernameClaim = errors.New("ID token lacks the username claim")
+)
+
+/*
+Begin starts a login at the provider and returns the URL to redirect the user to and the state,
+which has to be set in the user's browser with StateCookie. The state, the nonce and the PKCE code
+verifier are kept until the callback, the state only as hash.
+*/
+func Begin(config Config) (string, string, error) {
+	if !config.Enabled() {
+		return "", "", ErrNotConfigured
+	}
+	doc, err := cached.getDiscovery(config.Issuer)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = database.SaveOIDCState(&models.OIDCState{
+		StateHash:    auth.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(stateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	return authCodeURL(config, doc, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:])), state, nil
+}
+
+/*
+StateCookie returns the cookie that binds a login started by Begin to the browser, only a callback
+from that browser can complete it. Without it anyone who got hold of the callback URL could. The
+cookie is sent along when the provider redirects back, but not with requests from other sites.
+*/
+func StateCookie(config Config, state string) *http.Cookie {
+	path := "/"
+	if redirect, err := url.Parse(config.RedirectURL); err == nil && redirect.Path != "" {
+		path = redirect.Path
+	}
+	return &http.Cookie{
+		Name:     stateCookieName,
+		Value:    state,
+		Path:     path,
+		MaxAge:   int(stateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ClearStateCookie returns the cookie that removes the one of StateCookie once the callback is done.
+func ClearStateCookie(config Config) *http.Cookie {
+	cookie := StateCookie(config, "")
+	cookie.MaxAge = -1
+	return cookie
+}
+
+// CheckStateCookie returns ErrBrowserMismatch unless the request carries the cookie of the login with the state.
+func CheckStateCookie(r *http.Request, state string) error {
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return ErrBrowserMismatch
+	}
+	return nil
+}
+
+/*
+Complete finishes a login with the state and the authorization code of the callback.
+It exchanges the code, validates the ID token and returns the user of the provider account,
+provisioning it on its first login.
+*/
+func Complete(config Config, state, code string) (*models.User, error) {
+	if !config.Enabled() {
+		return nil, ErrNotConfigured
+	}
+	pending, err := database.TakeOIDCState(auth.HashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil || time.Now().After(pending.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+
+	doc, err := cached.getDiscovery(config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := exchangeCode(config, doc, code, pending.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := verifyIDToken(config, doc, idToken, pending.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return provisionUser(config, claims)
+}
+
+/*
+provisionUser returns the user linked to the subject of the ID token and creates it on the first login.
+With a role mapping the provider stays in charge of the role, it is updated on every login and a
+change revokes the user's other sessions.
+An existing local user with the same username is never linked automatically.
+*/
+func provisionUser(config Config, claims jwt.MapClaims) (*models.User, error) {
+	subject, _ := claims["sub"].(string)
+	mappedRole := mapRole(config, claims)
+
+	user, err := database.GetUserByIdentity(config.Issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		if mappedRole != "" && mappedRole != user.Role {
+			if _, err := database.UpdateUserRole(user.ID, mappedRole); err != nil {
+				return nil, err
+			}
+			log.Printf("Role of user %d changed from %s to %s by OIDC claims", user.ID, user.Role, mappedRole)
+			audit.Record(models.AuditEvent{
+				Action:  audit.ActionUserRoleChange,
+				Target:  user.Username,
+				Outcome: audit.OutcomeSuccess,
+				Details: user.Role + " -> " + mappedRole + " by OIDC claims",
+			})
+			// access tokens carry the role, so the sessions started with the old one have to go
+			if _, err := auth.RevokeAllSessions(user.ID); err != nil {
+				return nil, err
+			}
+			user.Role = mappedRole
+		}
+		return user, nil
+	}
+
+	username, _ := claims[config.UsernameClaim].(string)
+	if username == "" {
+		return nil, ErrUsernameClaim
+	}
+	role := mappedRole
+	if role == "" {
+		role = config.DefaultRole
+	}
+	if role == "" {
+		return nil, ErrNoRole
+	}
+	taken, err := database.UsernameExists(username)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, auth.ErrUsernameTaken
+	}
+
+	// single sign-on users have no local password, an empty hash never matches one
+	user = &models.User{Username: username, Role: role, AuthSource: models.AuthSourceOIDC}
+	if err := database.CreateUserWithIdentity(user, config.Issuer, subject); err != nil {
+		return nil, err
+	}
+	log.Printf("Provisioned user %d (%s) with role %s from OIDC", user.ID, username, role)
+	return user, nil
+}
+
+// mapRole returns the GoGrab role of the first mapped value of the role claim, which can be a string or a list.
+func mapRole(config Config, claims jwt.MapClaims) string {
+	var values []string
+	switch claim := claims[config.RoleClaim].(type) {
+	case string:
+		values = []string{claim}
+	case []interface{}:
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+	for _, value := range values {
+		if role, ok := config.RoleMapping[value]; ok {
+			exists, err := auth.RoleExists(role)
+			if err != nil || !exists {
+				log.Printf("OIDC role mapping %s=%s points to an unknown role", value, role)
+				continue
+			}
+			return role
+		}
+	}
+	return ""
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating random token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
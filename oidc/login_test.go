@@ -0,0 +1,45 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStateCookie(t *testing.T) {
+	config := Config{RedirectURL: "https://gograb.example.com/api/v1/oidc/callback"}
+	cookie := StateCookie(config, "the-state")
+
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie %+v, want HttpOnly, Secure and SameSite=Lax", cookie)
+	}
+	if cookie.Path != "/api/v1/oidc/callback" {
+		t.Errorf("cookie path %q, want the path of the callback", cookie.Path)
+	}
+	if cleared := ClearStateCookie(config); cleared.MaxAge >= 0 || cleared.Path != cookie.Path {
+		t.Errorf("cleared cookie %+v, want it to remove the state cookie", cleared)
+	}
+}
+
+func TestCheckStateCookie(t *testing.T) {
+	config := Config{RedirectURL: "http://localhost:8080/api/v1/oidc/callback"}
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   error
+	}{
+		{"same browser", StateCookie(config, "the-state"), nil},
+		{"no cookie", nil, ErrBrowserMismatch},
+		{"other login", StateCookie(config, "another-state"), ErrBrowserMismatch},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/oidc/callback?state=the-state&code=code", nil)
+		if test.cookie != nil {
+			r.AddCookie(test.cookie)
+		}
+		if err := CheckStateCookie(r, "the-state"); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package oidc
+
+import (
+	"GoGrab/auth"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	discoveryTTL = time.Hour
+	// jwksRefreshInterval limits how often an unknown key ID makes us fetch the JWKS again
+	jwksRefreshInterval = time.Minute
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrInvalidIDToken is returned for ID tokens that fail validation.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// discovery is the part of the provider metadata we use.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// provider caches the discovery document and the signing keys of the configured issuer.
+type provider struct {
+	lock          sync.Mutex
+	issuer        string
+	discovery     *discovery
+	discoveredAt  time.Time
+	keys          auth.JSONWebKeySet
+	keysFetchedAt time.Time
+}
+
+var cached = &provider{}
+
+// getDiscovery returns the provider metadata, fetched again after an hour.
+func (p *provider) getDiscovery(issuer string) (*discovery, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.discovery != nil && p.issuer == issuer && time.Since(p.discoveredAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	var doc discovery
+	if err := getJSON(issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("error reading OIDC discovery: %v", err)
+	}
+	// the metadata has to be about the issuer we asked, otherwise anything could be injected
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC discovery is for issuer %q instead of %q", doc.Issuer, issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery lacks an endpoint")
+	}
+
+	if p.issuer != issuer {
+		p.keys = auth.JSONWebKeySet{}
+		p.keysFetchedAt = time.Time{}
+	}
+	p.issuer = issuer
+	p.discovery = &doc
+	p.discoveredAt = time.Now()
+	return p.discovery, nil
+}
+
+// publicKey returns the signing key with the given ID, fetching the JWKS again when the provider rotated its keys.
+func (p *provider) publicKey(jwksURI, kid string) (crypto.PublicKey, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := p.keys.Key(kid)
+	if key == nil && time.Since(p.keysFetchedAt) > jwksRefreshInterval {
+		var keys auth.JSONWebKeySet
+		if err := getJSON(jwksURI, &keys); err != nil {
+			return nil, fmt.Errorf("error reading OIDC signing keys: %v", err)
+		}
+		p.keys = keys
+		p.keysFetchedAt = time.Now()
+		key = p.keys.Key(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+	return key.PublicKey()
+}
+
+// authCodeURL returns the URL of the provider's login page for an authorization code flow with PKCE.
+func authCodeURL(config Config, doc *discovery, state, nonce, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", config.ClientID)
+	query.Set("redirect_uri", config.RedirectURL)
+	query.Set("scope", strings.Join(config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// exchangeCode redeems an authorization code at the token endpoint and returns the ID token.
+func exchangeCode(config Config, doc *discovery, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", config.RedirectURL)
+	form.Set("client_id", config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	request, err := http.NewRequest(http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("error calling the token endpoint: %v", err)
+	}
+	defer response.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("error decoding the token response: %v", err)
+	}
+	if response.StatusCode != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("token endpoint returned %d: %s %s", response.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token response lacks an ID token")
+	}
+	return tokens.IDToken, nil
+}
+
+/*
+verifyIDToken checks the signature of an ID token against the provider's keys and validates its
+issuer, audience, authorized party, expiry and nonce, as required by OpenID Connect Core 3.1.3.7.
+*/
+func verifyIDToken(config Config, doc *discovery, rawToken, nonce string) (jwt.MapClaims, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}))
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return cached.publicKey(doc.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if !claims.VerifyIssuer(config.Issuer, true) && !claims.VerifyIssuer(config.Issuer+"/", true) {
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidIDToken)
+	}
+	if !claims.VerifyAudience(config.ClientID, true) {
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidIDToken)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != config.ClientID {
+		return nil, fmt.Errorf("%w: wrong authorized party", ErrInvalidIDToken)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidIDToken)
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, fmt.Errorf("%w: wrong nonce", ErrInvalidIDToken)
+	}
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+func getJSON(url string, target interface{}) error {
+	response, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(target)
+}
@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"GoGrab/oidc/oidctest"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newTestProvider serves a mock provider and returns it with a configuration pointing at it.
+func newTestProvider(t *testing.T) (*oidctest.Provider, Config) {
+	t.Helper()
+	idp, err := oidctest.NewProvider("gograb")
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	server := httptest.NewServer(idp.Handler())
+	t.Cleanup(server.Close)
+	idp.Issuer = server.URL
+
+	config := Config{
+		Issuer:        server.URL,
+		ClientID:      "gograb",
+		RedirectURL:   "http://localhost:8080/api/v1/oidc/callback",
+		Scopes:        []string{"openid", "profile"},
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+	}
+	return idp, config
+}
+
+// authorize follows the login at the provider and returns the code and state of the callback.
+func authorize(t *testing.T, config Config, doc *discovery, state, nonce, verifier, loginHint string) (string, string) {
+	t.Helper()
+	challenge := sha256.Sum256([]byte(verifier))
+	loginURL := authCodeURL(config, doc, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if loginHint != "" {
+		loginURL += "&login_hint=" + url.QueryEscape(loginHint)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(loginURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d, want a redirect", response.StatusCode)
+	}
+	callback, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("callback URL: %v", err)
+	}
+	if got := callback.Scheme + "://" + callback.Host + callback.Path; got != config.RedirectURL {
+		t.Fatalf("redirected to %s, want %s", got, config.RedirectURL)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestLoginFlow(t *testing.T) {
+	_, config := newTestProvider(t)
+	doc, err := cached.getDiscovery(config.Issuer)
+	if err != nil {
+		t.Fatalf("getDiscovery: %v", err)
+	}
+
+	code, state := authorize(t, config, doc, "the-state", "the-nonce", "the-verifier", "bob:gograb-admins,staff")
+	if state != "the-state" {
+		t.Fatalf("callback state is %q, want the one of the login", state)
+	}
+	idToken, err := exchangeCode(config, doc, code, "the-verifier")
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+	claims, err := verifyIDToken(config, doc, idToken, "the-nonce")
+	if err != nil {
+		t.Fatalf("verifyIDToken: %v", err)
+	}
+
+	if claims["sub"] != "mock|bob" || claims[config.UsernameClaim] != "bob" {
+		t.Errorf("claims %v, want the subject and username of bob", claims)
+	}
+	groups, _ := claims[config.RoleClaim].([]interface{})
+	if len(groups) != 2 || groups[0] != "gograb-admins" || groups[1] != "staff" {
+		t.Errorf("groups %v, want gograb-admins and staff", claims[config.RoleClaim])
+	}
+}
+
+func TestExchangeCodeRequiresVerifier(t *testing.T) {
+	_, config := newTestProvider(t)
+	doc, err := cached.getDiscovery(config.Issuer)
+	if err != nil {
+		t.Fatalf("getDiscovery: %v", err)
+	}
+
+	code, _ := authorize(t, config, doc, "state", "nonce", "the-verifier", "")
+	if _, err := exchangeCode(config, doc, code, "another-verifier"); err == nil {
+		t.Fatal("exchangeCode accepted a wrong PKCE code verifier")
+	}
+	// the code is spent by the failed attempt
+	if _, err := exchangeCode(config, doc, code, "the-verifier"); err == nil {
+		t.Fatal("exchangeCode redeemed a code twice")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	_, config := newTestProvider(t)
+	doc, err := cached.getDiscovery(config.Issuer)
+	if err != nil {
+		t.Fatalf("getDiscovery: %v", err)
+	}
+	code, _ := authorize(t, config, doc, "state", "the-nonce", "verifier", "")
+	idToken, err := exchangeCode(config, doc, code, "verifier")
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		token  string
+		nonce  string
+	}{
+		{"wrong nonce", config, idToken, "another-nonce"},
+		{"wrong audience", Config{Issuer: config.Issuer, ClientID: "another-client"}, idToken, "the-nonce"},
+		{"wrong issuer", Config{Issuer: "https://idp.example.com", ClientID: config.ClientID}, idToken, "the-nonce"},
+		{"tampered token", config, idToken[:len(idToken)-4] + "AAAA", "the-nonce"},
+	}
+	for _, test := range tests {
+		if _, err := verifyIDToken(test.config, doc, test.token, test.nonce); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: got %v, want ErrInvalidIDToken", test.name, err)
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp, config := newTestProvider(t)
+	idp.Issuer = "https://idp.example.com"
+	cached.discovery = nil
+
+	if _, err := cached.getDiscovery(config.Issuer); err == nil {
+		t.Fatal("getDiscovery accepted metadata of another issuer")
+	}
+}
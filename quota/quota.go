@@ -0,0 +1,259 @@
+package quota
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// staleJobAfter is how long a running job can go without fetching a page before it no longer
+// counts as running, a page fetch times out after a minute.
+const staleJobAfter = 10 * time.Minute
+
+// ErrQuotaExceeded is returned when a crawl would go beyond the user's quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Report is the usage of a user against their quota, as shown by /api/users/me/usage.
+type Report struct {
+	Quota       models.Quota `json:"quota"`
+	RunningJobs int64        `json:"running_jobs"`
+	Today       models.Usage `json:"today"`
+	Month       models.Usage `json:"month"`
+	StoredBytes int64        `json:"stored_bytes"`
+}
+
+// Effective returns the quota that applies to the user: their own one, or else the one of their role.
+// Without either nothing is limited.
+func Effective(user *models.User) (models.Quota, error) {
+	quota, err := database.GetQuota(models.QuotaScopeUser, strconv.Itoa(user.ID))
+	if err != nil || quota != nil {
+		return derefQuota(quota), err
+	}
+	quota, err = database.GetQuota(models.QuotaScopeRole, user.Role)
+	return derefQuota(quota), err
+}
+
+// GetReport returns the usage of the user today, this month and in storage together with their quota.
+func GetReport(user *models.User) (*Report, error) {
+	quota, err := Effective(user)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Quota: quota}
+
+	now := time.Now()
+	if report.RunningJobs, err = database.CountRunningCrawlJobs(user.ID, now.Add(-staleJobAfter)); err != nil {
+		return nil, err
+	}
+	day, month := startOfDay(now), startOfMonth(now)
+	if report.Today, err = usage(user.ID, day, day.AddDate(0, 0, 1)); err != nil {
+		return nil, err
+	}
+	if report.Month, err = usage(user.ID, month, month.AddDate(0, 1, 0)); err != nil {
+		return nil, err
+	}
+	if report.StoredBytes, err = database.GetStoredBytes(user.ID); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// MonthlyUsage returns the usage of every user in the calendar month (UTC) that starts at month, for chargeback.
+func MonthlyUsage(month time.Time) ([]models.Usage, error) {
+	month = startOfMonth(month)
+	usages, err := database.GetUsageByUser(month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	for i := range usages {
+		usages[i].BrowserMinutes = browserMinutes(usages[i].BrowserSeconds)
+	}
+	return usages, nil
+}
+
+/*
+Meter enforces the quota of a user while one of their crawl jobs runs and meters what it consumes.
+A nil Meter allows everything, so crawls started without one aren't limited.
+*/
+type Meter struct {
+	job   models.CrawlJob
+	quota models.Quota
+
+	lock    sync.Mutex
+	stored  int64 // bytes stored by the user when the job started, plus what the job wrote since
+	stopped error
+}
+
+/*
+Begin checks the user's quota before a crawl job starts and records the job as running.
+It returns an error wrapping ErrQuotaExceeded if the user already runs as many jobs as allowed,
+or used up their pages for today, their browser minutes for this month or their storage.
+*/
+func Begin(user *models.User, job models.CrawlJob) (*Meter, error) {
+	return begin(user, job, database.StartCrawlJob)
+}
+
+/*
+Resume checks the user's quota like Begin before an interrupted, stopped or crashed job continues
+and records it as running again. It returns database.ErrCrawlJobNotResumable if the job is finished
+or still running.
+*/
+func Resume(user *models.User, job models.CrawlJob) (*Meter, error) {
+	return begin(user, job, database.ResumeCrawlJob)
+}
+
+func begin(user *models.User, job models.CrawlJob, start func(*models.CrawlJob, int, time.Time) (bool, error)) (*Meter, error) {
+	quota, err := Effective(user)
+	if err != nil {
+		return nil, err
+	}
+	meter := &Meter{job: job, quota: quota}
+	if quota.MaxStoredBytes > 0 {
+		if meter.stored, err = database.GetStoredBytes(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := meter.check(); err != nil {
+		return nil, err
+	}
+
+	started, err := start(&meter.job, quota.MaxConcurrentJobs, time.Now().Add(-staleJobAfter))
+	if err != nil {
+		return nil, err
+	}
+	if !started {
+		return nil, fmt.Errorf("%w: %d crawl jobs are running already", ErrQuotaExceeded, quota.MaxConcurrentJobs)
+	}
+	return meter, nil
+}
+
+/*
+Allow reports whether the job may fetch another page. Once the quota is used up it keeps returning
+the same error. Errors reading the counters are only logged, Begin already checked the quota and a
+database hiccup shouldn't end a long crawl.
+*/
+func (m *Meter) Allow() error {
+	if m == nil {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stopped != nil {
+		return m.stopped
+	}
+
+	err := m.check()
+	if errors.Is(err, ErrQuotaExceeded) {
+		m.stopped = err
+		return err
+	}
+	if err != nil {
+		log.Printf("Error checking the quota of job %s: %v", m.job.ID, err)
+	}
+	return nil
+}
+
+// Record adds a fetch to the user's usage: the page if one was saved, its size and the time the browser took.
+func (m *Meter) Record(pages int, bytes int64, browser time.Duration) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	m.stored += bytes
+	m.lock.Unlock()
+
+	// browser time is billed in started seconds
+	usage := models.Usage{Pages: pages, BytesWritten: bytes, BrowserSeconds: int64(math.Ceil(browser.Seconds()))}
+	if err := database.AddUsage(m.job.UserID, time.Now(), usage); err != nil {
+		log.Printf("Error recording the usage of job %s: %v", m.job.ID, err)
+	}
+	if err := database.TouchCrawlJob(m.job.ID); err != nil {
+		log.Printf("Error updating job %s: %v", m.job.ID, err)
+	}
+}
+
+// Stopped returns the reason the quota stopped the job, or nil.
+func (m *Meter) Stopped() error {
+	if m == nil {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.stopped
+}
+
+// Finish marks the job as no longer running, so it stops counting towards the concurrent jobs.
+func (m *Meter) Finish() {
+	if m == nil {
+		return
+	}
+	status := models.CrawlJobFinished
+	if m.Stopped() != nil {
+		status = models.CrawlJobStopped
+	}
+	if err := database.FinishCrawlJob(m.job.ID, status); err != nil {
+		log.Printf("Error finishing job %s: %v", m.job.ID, err)
+	}
+}
+
+// check compares the usage with the quota, the caller must hold the lock or own the meter.
+func (m *Meter) check() error {
+	now := time.Now()
+	if m.quota.MaxPagesPerDay > 0 {
+		day := startOfDay(now)
+		today, err := database.GetUsage(m.job.UserID, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		if today.Pages >= m.quota.MaxPagesPerDay {
+			return fmt.Errorf("%w: %d pages per day", ErrQuotaExceeded, m.quota.MaxPagesPerDay)
+		}
+	}
+	if m.quota.MaxBrowserMinutes > 0 {
+		month := startOfMonth(now)
+		used, err := database.GetUsage(m.job.UserID, month, month.AddDate(0, 1, 0))
+		if err != nil {
+			return err
+		}
+		if used.BrowserSeconds >= int64(m.quota.MaxBrowserMinutes)*60 {
+			return fmt.Errorf("%w: %d browser minutes per month", ErrQuotaExceeded, m.quota.MaxBrowserMinutes)
+		}
+	}
+	if m.quota.MaxStoredBytes > 0 && m.stored >= m.quota.MaxStoredBytes {
+		return fmt.Errorf("%w: %d bytes of stored pages", ErrQuotaExceeded, m.quota.MaxStoredBytes)
+	}
+	return nil
+}
+
+func usage(userID int, from, until time.Time) (models.Usage, error) {
+	used, err := database.GetUsage(userID, from, until)
+	used.BrowserMinutes = browserMinutes(used.BrowserSeconds)
+	return used, err
+}
+
+func browserMinutes(seconds int64) float64 {
+	return math.Round(float64(seconds)/60*100) / 100
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func derefQuota(quota *models.Quota) models.Quota {
+	if quota == nil {
+		return models.Quota{}
+	}
+	return *quota
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"GoGrab/config"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Principals a request is limited as: its API key, else its user, else its IP.
+const (
+	PrincipalIP     = "ip"
+	PrincipalUser   = "user"
+	PrincipalAPIKey = "apikey"
+)
+
+// Limit is a token bucket: Rate tokens per second are added up to Burst, every request takes one.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%g/s:%d", l.Rate, l.Burst)
+}
+
+var units = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+/*
+ParseLimit reads a limit written as COUNT/UNIT[:BURST] with the unit s, m or h, e.g. "20/m" or
+"600/m:100". The burst defaults to the count. "off" disables the limit.
+*/
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" {
+		return Limit{}, nil
+	}
+	rate, burstValue, hasBurst := strings.Cut(value, ":")
+	countValue, unit, ok := strings.Cut(rate, "/")
+	count, err := strconv.Atoi(countValue)
+	if !ok || err != nil || count <= 0 || units[unit] == 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected e.g. 20/m or 600/m:100", value)
+	}
+	limit := Limit{Rate: float64(count) / units[unit].Seconds(), Burst: count}
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burstValue); err != nil || limit.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid burst in rate limit %q", value)
+		}
+	}
+	return limit, nil
+}
+
+// Store keeps the token buckets. Take takes a token from the bucket of key; when the bucket is
+// empty it returns false and how long it takes until the next token.
+type Store interface {
+	Take(key string, limit Limit) (bool, time.Duration, error)
+}
+
+// take refills a bucket with tokens left at updatedAt and takes a token from it if there is one.
+// It returns the tokens left, whether one was taken and the wait for the next token otherwise.
+func take(tokens float64, updatedAt, now time.Time, limit Limit) (float64, bool, time.Duration) {
+	tokens = math.Min(float64(limit.Burst), tokens+now.Sub(updatedAt).Seconds()*limit.Rate)
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	wait := time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	return tokens, false, wait
+}
+
+// Limiter holds the limits of the policies used in the routes, per principal, and the store of their buckets.
+type Limiter struct {
+	policies map[string]map[string]Limit
+	store    Store
+}
+
+/*
+New returns the limiter of the configured limits: "auth" limits the login and registration endpoints
+by IP, "api" every authenticated endpoint by user and API key and "client" the authenticated
+endpoints by IP before the credentials are checked. The store "memory" keeps the buckets in the
+process, "mysql" shares them between all instances through the database.
+*/
+func New(cfg config.RateLimitConfig) (*Limiter, error) {
+	limiter := &Limiter{policies: make(map[string]map[string]Limit)}
+	limits := []struct {
+		key, policy, principal, value string
+	}{
+		{"rate_limit.auth_ip", "auth", PrincipalIP, cfg.AuthIP},
+		{"rate_limit.api_user", "api", PrincipalUser, cfg.APIUser},
+		{"rate_limit.api_apikey", "api", PrincipalAPIKey, cfg.APIKey},
+		{"rate_limit.client_ip", "client", PrincipalIP, cfg.ClientIP},
+	}
+	for _, setting := range limits {
+		if limiter.policies[setting.policy] == nil {
+			limiter.policies[setting.policy] = make(map[string]Limit)
+		}
+		if setting.value == "" {
+			continue
+		}
+		limit, err := ParseLimit(setting.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", setting.key, err)
+		}
+		limiter.policies[setting.policy][setting.principal] = limit
+	}
+
+	switch cfg.Store {
+	case "mysql":
+		limiter.store = SQLStore{}
+	case "memory":
+		limiter.store = NewMemoryStore()
+	default:
+		return nil, fmt.Errorf("rate_limit.store: unknown store %q", cfg.Store)
+	}
+	return limiter, nil
+}
+
+// Policy returns the limits of a policy per principal, none for an unknown policy.
+func (l *Limiter) Policy(name string) map[string]Limit {
+	return l.policies[name]
+}
+
+// Store returns the store of the buckets.
+func (l *Limiter) Store() Store {
+	return l.store
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"GoGrab/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Limit
+	}{
+		{"20/m", Limit{Rate: 20.0 / 60, Burst: 20}},
+		{"600/m:100", Limit{Rate: 10, Burst: 100}},
+		{" 5/s ", Limit{Rate: 5, Burst: 5}},
+		{"3600/h:1", Limit{Rate: 1, Burst: 1}},
+		{"off", Limit{}},
+	}
+	for _, test := range tests {
+		got, err := ParseLimit(test.value)
+		if err != nil || got != test.want {
+			t.Errorf("ParseLimit(%q) = %v, %v, want %v", test.value, got, err, test.want)
+		}
+	}
+
+	for _, value := range []string{"", "20", "20/d", "0/m", "-1/m", "x/m", "20/m:", "20/m:0", "20/m:x"} {
+		if _, err := ParseLimit(value); err == nil {
+			t.Errorf("ParseLimit(%q) accepted an invalid limit", value)
+		}
+	}
+}
+
+func TestTake(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		wantTokens float64
+		wantOK     bool
+		wantWait   time.Duration
+	}{
+		{"full bucket", 3, 0, 2, true, 0},
+		{"last token", 1, 0, 0, true, 0},
+		{"empty bucket", 0, 0, 0, false, 500 * time.Millisecond},
+		{"half a token", 0.5, 0, 0.5, false, 250 * time.Millisecond},
+		{"refilled", 0, time.Second, 1, true, 0},
+		{"refilled up to the burst", 0, time.Hour, 2, true, 0},
+	}
+	for _, test := range tests {
+		tokens, ok, wait := take(test.tokens, start, start.Add(test.elapsed), limit)
+		if tokens != test.wantTokens || ok != test.wantOK || wait != test.wantWait {
+			t.Errorf("%s: got %g, %v, %v, want %g, %v, %v", test.name, tokens, ok, wait, test.wantTokens, test.wantOK, test.wantWait)
+		}
+	}
+}
+
+func TestMemoryStoreBurst(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 0.001, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if ok, _, err := store.Take("ip:192.0.2.1", limit); !ok || err != nil {
+			t.Fatalf("request %d refused within the burst: %v", i+1, err)
+		}
+	}
+	ok, wait, err := store.Take("ip:192.0.2.1", limit)
+	if ok || err != nil || wait <= 0 {
+		t.Errorf("got %v, %v, %v, want the request after the burst refused with a wait", ok, wait, err)
+	}
+	if ok, _, _ := store.Take("ip:192.0.2.2", limit); !ok {
+		t.Error("another key shares the bucket")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	limit := Limit{Rate: 1, Burst: 10}
+	store.buckets["refilled"] = &bucket{tokens: 5, updatedAt: now.Add(-10 * time.Second), limit: limit}
+	store.buckets["draining"] = &bucket{tokens: 5, updatedAt: now.Add(-time.Second), limit: limit}
+
+	store.sweep(now)
+	if _, ok := store.buckets["refilled"]; ok {
+		t.Error("a full bucket was kept")
+	}
+	if _, ok := store.buckets["draining"]; !ok {
+		t.Error("a bucket that is not full was dropped")
+	}
+}
+
+func TestNew(t *testing.T) {
+	limiter, err := New(config.Default().RateLimit)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	limits := limiter.Policy("api")
+	if _, ok := limits[PrincipalIP]; ok || limits[PrincipalUser] != (Limit{Rate: 10, Burst: 100}) {
+		t.Errorf("api policy %v, want the default user limit and no IP limit", limits)
+	}
+	if _, ok := limiter.Store().(*MemoryStore); !ok {
+		t.Errorf("got store %T, want the memory store by default", limiter.Store())
+	}
+
+	cfg := config.Default().RateLimit
+	cfg.ClientIP, cfg.APIKey = "60/m", "off"
+	if limiter, err = New(cfg); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if limit := limiter.Policy("client")[PrincipalIP]; limit != (Limit{Rate: 1, Burst: 60}) {
+		t.Errorf("client IP limit %v, want the configured one", limit)
+	}
+	if limit := limiter.Policy("api")[PrincipalAPIKey]; limit.Enabled() {
+		t.Errorf("API key limit %v, want it turned off", limit)
+	}
+
+	cfg.AuthIP = "often"
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "rate_limit.auth_ip") {
+		t.Errorf("got %v, want an invalid limit reported with its setting", err)
+	}
+}
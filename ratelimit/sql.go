@@ -0,0 +1,20 @@
+package ratelimit
+
+import (
+	"GoGrab/database"
+	"time"
+)
+
+// SQLStore keeps the buckets in the RateLimitBuckets table, so all instances share them.
+// Every request costs a short transaction on the bucket's row.
+type SQLStore struct{}
+
+func (SQLStore) Take(key string, limit Limit) (bool, time.Duration, error) {
+	var allowed bool
+	var wait time.Duration
+	err := database.UpdateRateLimitBucket(key, float64(limit.Burst), func(tokens float64, updatedAt time.Time) float64 {
+		tokens, allowed, wait = take(tokens, updatedAt, time.Now(), limit)
+		return tokens
+	})
+	return allowed, wait, err
+}
@@ -0,0 +1,184 @@
+package router
+
+import (
+	"GoGrab/utils"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+/*
+Router registers routes with method patterns like "GET /pages/{id}/versions" below a prefix.
+Every path is served by one handler on the underlying ServeMux that picks the handler of the
+request's method: GET routes answer HEAD as well unless they are Unsafe, OPTIONS lists the allowed methods and any
+other method gets a JSON 405 with an Allow header. Paths below the prefix without a route get a
+JSON 404.
+*/
+type Router struct {
+	mux    *http.ServeMux
+	prefix string
+	paths  map[string]*methods
+}
+
+// methods are the handlers of one path by method.
+type methods struct {
+	handlers map[string]http.Handler
+	// noHead is set when the GET of the path has side effects and must not answer HEAD
+	noHead bool
+}
+
+// Route is a registered route, used to add deprecated aliases to it.
+type Route struct {
+	router  *Router
+	method  string
+	path    string
+	handler http.Handler
+	// gets are the paths the route is registered on for GET, unsafe marks them as not answering HEAD
+	gets   []string
+	unsafe bool
+}
+
+// New returns a router registering its routes on mux below prefix, e.g. "/api/v1".
+func New(mux *http.ServeMux, prefix string) *Router {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" {
+		mux.HandleFunc(prefix+"/", NotFound)
+	}
+	return &Router{mux: mux, prefix: prefix, paths: make(map[string]*methods)}
+}
+
+// Handle registers handler for a pattern "METHOD /path", the path being relative to the prefix.
+// It panics on malformed or duplicate patterns, like http.ServeMux.
+func (rt *Router) Handle(pattern string, handler http.Handler) *Route {
+	method, path := splitPattern(pattern)
+	if method == "" {
+		panic(fmt.Sprintf("router: pattern %q has no method", pattern))
+	}
+	path = rt.prefix + path
+	route := &Route{router: rt, method: method, path: path, handler: handler}
+	route.register(method, path, handler)
+	return route
+}
+
+func (rt *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) *Route {
+	return rt.Handle(pattern, http.HandlerFunc(handler))
+}
+
+/*
+Alias registers the route on a further, absolute path that is deprecated in its favour, e.g. a path
+of the unversioned API. The path takes the same path parameters; a method in front of it replaces
+the route's method. Responses on the alias carry a Deprecation header and a Link to the route.
+*/
+func (route *Route) Alias(pattern string) *Route {
+	method, path := splitPattern(pattern)
+	if method == "" {
+		method = route.method
+	}
+	route.register(method, path, deprecated(route.path, route.handler))
+	return route
+}
+
+/*
+Unsafe marks a route whose GET has side effects, e.g. a logout kept on GET for old clients. HEAD
+requests are meant to be safe, so they don't fall back to its GET on the route and its aliases and
+get a 405 instead.
+*/
+func (route *Route) Unsafe() *Route {
+	route.unsafe = true
+	for _, path := range route.gets {
+		route.router.paths[path].noHead = true
+	}
+	return route
+}
+
+func (route *Route) register(method, path string, handler http.Handler) {
+	route.router.handle(method, path, handler)
+	if method == http.MethodGet {
+		route.gets = append(route.gets, path)
+		route.router.paths[path].noHead = route.unsafe
+	}
+}
+
+func (rt *Router) handle(method, path string, handler http.Handler) {
+	entry, ok := rt.paths[path]
+	if !ok {
+		entry = &methods{handlers: make(map[string]http.Handler)}
+		rt.paths[path] = entry
+		rt.mux.Handle(path, entry)
+	}
+	if _, exists := entry.handlers[method]; exists {
+		panic(fmt.Sprintf("router: %s %s is registered twice", method, path))
+	}
+	entry.handlers[method] = handler
+}
+
+func (m *methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := m.handlers[r.Method]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if handler, ok := m.handlers[http.MethodGet]; ok && r.Method == http.MethodHead && !m.noHead {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	allowed := m.allowed()
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	utils.WriteErrorDetails(w, "Method "+r.Method+" not allowed", http.StatusMethodNotAllowed, map[string][]string{"allowed_methods": allowed})
+}
+
+// allowed returns the methods of the path including the implicit HEAD of a safe GET and OPTIONS, sorted.
+func (m *methods) allowed() []string {
+	allowed := []string{http.MethodOptions}
+	for method := range m.handlers {
+		allowed = append(allowed, method)
+	}
+	if _, ok := m.handlers[http.MethodGet]; ok && !m.noHead {
+		if _, ok := m.handlers[http.MethodHead]; !ok {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// NotFound answers with a JSON 404, for paths of the API without a route.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	utils.WriteError(w, "No route for "+r.URL.Path, http.StatusNotFound)
+}
+
+/*
+deprecated marks the responses of an alias with the Deprecation header and links the path of the
+route that replaces it, with the path parameters of the request filled in.
+*/
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+fillPath(successor, r)+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func fillPath(path string, r *http.Request) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = r.PathValue(strings.TrimSuffix(strings.Trim(segment, "{}"), "..."))
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// splitPattern splits "METHOD /path" into its method and path, the method is empty for a bare path.
+func splitPattern(pattern string) (string, string) {
+	method, path, found := strings.Cut(strings.TrimSpace(pattern), " ")
+	if !found {
+		return "", method
+	}
+	return method, strings.TrimSpace(path)
+}
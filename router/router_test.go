@@ -0,0 +1,69 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestRouter routes GET /pages and an unsafe GET alias of POST /logout, counting the calls.
+func newTestRouter() (*http.ServeMux, map[string]int) {
+	calls := make(map[string]int)
+	count := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { calls[name]++ }
+	}
+	mux := http.NewServeMux()
+	rt := New(mux, "/api/v1")
+	rt.Handle("GET /pages", count("pages")).Alias("/api/pages")
+	rt.Handle("POST /logout", count("logout")).Alias("/api/logout").Alias("GET /api/logout").Unsafe()
+	return mux, calls
+}
+
+func serve(mux *http.ServeMux, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestHeadFallsBackToGet(t *testing.T) {
+	mux, calls := newTestRouter()
+	for _, path := range []string{"/api/v1/pages", "/api/pages"} {
+		if w := serve(mux, http.MethodHead, path); w.Code != http.StatusOK {
+			t.Errorf("HEAD %s: %d, want the GET to answer", path, w.Code)
+		}
+	}
+	if calls["pages"] != 2 {
+		t.Errorf("GET handler called %d times, want 2", calls["pages"])
+	}
+	if allow := serve(mux, http.MethodOptions, "/api/v1/pages").Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("Allow %q, want HEAD listed", allow)
+	}
+}
+
+func TestUnsafeRouteRejectsHead(t *testing.T) {
+	mux, calls := newTestRouter()
+	w := serve(mux, http.MethodHead, "/api/logout")
+	if w.Code != http.StatusMethodNotAllowed || calls["logout"] != 0 {
+		t.Errorf("HEAD /api/logout: %d with %d logouts, want 405 without logging out", w.Code, calls["logout"])
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
+		t.Errorf("Allow %q, want no HEAD", allow)
+	}
+
+	if w := serve(mux, http.MethodGet, "/api/logout"); w.Code != http.StatusOK || w.Header().Get("Deprecation") != "true" {
+		t.Errorf("GET /api/logout: %d, want the deprecated alias to log out", w.Code)
+	}
+	if w := serve(mux, http.MethodPost, "/api/v1/logout"); w.Code != http.StatusOK || calls["logout"] != 2 {
+		t.Errorf("POST /api/v1/logout: %d with %d logouts, want 2", w.Code, calls["logout"])
+	}
+}
+
+func TestUnknownMethodAndPath(t *testing.T) {
+	mux, _ := newTestRouter()
+	if w := serve(mux, http.MethodDelete, "/api/v1/pages"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /api/v1/pages: %d, want 405", w.Code)
+	}
+	if w := serve(mux, http.MethodGet, "/api/v1/nothing"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/v1/nothing: %d, want 404", w.Code)
+	}
+}
@@ -1,28 +1,139 @@
 package routes
 
 import (
+	"GoGrab/config"
 	_ "GoGrab/docs"
+	"GoGrab/export"
+	"GoGrab/functions"
 	"GoGrab/handlers"
 	"GoGrab/middleware"
+	"GoGrab/models"
+	"GoGrab/ratelimit"
+	"GoGrab/router"
+	"GoGrab/storage"
 	"net/http"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-func SetupRoutes() {
+// SetupRoutes registers the routes on http.DefaultServeMux. The handlers get the parts of the configuration
+// and the services they use, the rate limits come from the limiter.
+func SetupRoutes(cfg *config.Config, store *storage.Store, archives *export.Archives, janitor *functions.Janitor, limiter *ratelimit.Limiter) {
+	//the API lives below /api/v1, every route is registered for its methods only
+	//the routes of the unversioned API stay available as deprecated aliases of them
+	v1 := router.New(http.DefaultServeMux, "/api/v1")
+	http.HandleFunc("/api/", router.NotFound)
 
-	//user avaliable routes
-	http.Handle("/api/crawl", middleware.JWTAuthMiddleware(middleware.RequireRole("user", http.HandlerFunc(handlers.StartCrawlHandler))))
-	http.Handle("/api/get-data", middleware.JWTAuthMiddleware(middleware.RequireRole("user", http.HandlerFunc(handlers.GetScrapedDataHandler))))
-	http.Handle("/api/logout", middleware.JWTAuthMiddleware(middleware.RequireRole("user", http.HandlerFunc(handlers.LogoutHandler))))
+	//every authenticated route is rate limited per client IP before the credentials are checked,
+	//then per API key or user, see rate_limit.client_ip, rate_limit.api_user and rate_limit.api_apikey
+	authenticated := func(handler http.Handler) http.Handler {
+		return middleware.RateLimit(limiter, "client", middleware.JWTAuthMiddleware(middleware.RateLimit(limiter, "api", handler)))
+	}
+	//data routes need a permission of the user's role, API keys also need the matching scope
+	//they work on the workspace picked by the X-Organization-ID header, the user's personal pages without it
+	data := func(permission, scope string, handler http.HandlerFunc) http.Handler {
+		return authenticated(middleware.RequirePermission(permission, middleware.RequireScope(scope, middleware.RequireWorkspace(handler))))
+	}
+	//account routes are available to every role; they need an interactive login and don't accept API keys
+	account := func(handler http.HandlerFunc) http.Handler {
+		return authenticated(middleware.RequireSession(handler))
+	}
+	//administration routes, API keys can't be used for them
+	admin := func(permission string, handler http.HandlerFunc) http.Handler {
+		return authenticated(middleware.RequireSession(middleware.RequirePermission(permission, handler)))
+	}
+	//the login endpoints are rate limited per client IP, see rate_limit.auth_ip
+	//the password endpoints can be turned off with auth.local_login when everyone uses single sign-on
+	login := func(handler http.HandlerFunc) http.Handler {
+		return middleware.RateLimit(limiter, "auth", handler)
+	}
+	local := func(handler http.HandlerFunc) http.Handler {
+		return middleware.RateLimit(limiter, "auth", middleware.RequireLocalLogin(cfg.Auth.LocalLogin, handler))
+	}
 
-	//admin avaliable routes
-	http.Handle("/api/delete-data", middleware.JWTAuthMiddleware(middleware.RequireRole("admin", http.HandlerFunc(handlers.DeleteScrapedData))))
+	//data routes
+	v1.Handle("POST /crawl", data(models.PermCrawlCreate, models.ScopeCrawl, handlers.StartCrawlHandler(cfg.Crawler, store))).Alias("/api/crawl")
+	v1.Handle("POST /crawl/{id}/resume", data(models.PermCrawlCreate, models.ScopeCrawl, handlers.ResumeCrawlHandler(cfg.Crawler, store))).Alias("/api/crawl/{id}/resume")
+	v1.Handle("GET /data", data(models.PermDataRead, models.ScopeReadData, handlers.GetScrapedDataHandler(store))).Alias("/api/get-data")
+	v1.Handle("GET /pages", data(models.PermDataRead, models.ScopeReadData, handlers.PagesHandler(store))).Alias("/api/pages")
+	v1.Handle("GET /pages/{id}/versions", data(models.PermDataRead, models.ScopeReadData, handlers.PageVersionsHandler(store))).Alias("/api/pages/{id}/versions")
+	v1.Handle("GET /pages/{id}/diff", data(models.PermDataRead, models.ScopeReadData, handlers.PageDiffHandler(store))).Alias("/api/pages/{id}/diff")
+	v1.Handle("GET /archives", data(models.PermDataRead, models.ScopeReadData, handlers.ArchivesHandler(archives))).Alias("/api/archives")
+	v1.Handle("POST /archives", data(models.PermCrawlCreate, models.ScopeCrawl, handlers.ArchivesHandler(archives))).Alias("/api/archives")
+	v1.Handle("GET /archives/{id}", data(models.PermDataRead, models.ScopeReadData, handlers.ArchiveHandler(archives))).Alias("/api/archives/{id}")
+	v1.Handle("DELETE /archives/{id}", data(models.PermDataDelete, models.ScopeDeleteData, handlers.ArchiveHandler(archives))).Alias("/api/archives/{id}")
+	//data deletion is restricted to the user's own pages without data:delete:any
+	v1.Handle("DELETE /data", data(models.PermDataDelete, models.ScopeDeleteData, handlers.DeleteDataHandler(store))).Alias("/api/data")
+
+	//account routes
+	//logout used to be a GET, the alias keeps accepting it but not as HEAD
+	v1.Handle("POST /logout", account(handlers.LogoutHandler)).Alias("/api/logout").Alias("GET /api/logout").Unsafe()
+	v1.Handle("GET /sessions", account(handlers.SessionsHandler)).Alias("/api/sessions")
+	v1.Handle("DELETE /sessions/{id}", account(handlers.SessionHandler)).Alias("/api/sessions/{id}")
+	v1.Handle("POST /users/me/password", account(handlers.MyPasswordHandler)).Alias("/api/users/me/password")
+	v1.Handle("GET /users/me/usage", account(handlers.MyUsageHandler)).Alias("/api/users/me/usage")
+	v1.Handle("GET /users/me/2fa", account(handlers.MyTwoFactorHandler)).Alias("/api/users/me/2fa")
+	v1.Handle("POST /users/me/2fa", account(handlers.MyTwoFactorHandler)).Alias("/api/users/me/2fa")
+	v1.Handle("DELETE /users/me/2fa", account(handlers.MyTwoFactorHandler)).Alias("/api/users/me/2fa")
+	v1.Handle("POST /users/me/2fa/verify", account(handlers.MyTwoFactorVerifyHandler)).Alias("/api/users/me/2fa/verify")
+	v1.Handle("POST /users/me/2fa/recovery-codes", account(handlers.MyRecoveryCodesHandler)).Alias("/api/users/me/2fa/recovery-codes")
+	v1.Handle("GET /api-keys", account(handlers.APIKeysHandler)).Alias("/api/api-keys")
+	v1.Handle("POST /api-keys", account(handlers.APIKeysHandler)).Alias("/api/api-keys")
+	v1.Handle("DELETE /api-keys/{id}", account(handlers.APIKeyHandler)).Alias("/api/api-keys/{id}")
+	v1.Handle("GET /organizations", account(handlers.OrganizationsHandler)).Alias("/api/organizations")
+	v1.Handle("POST /organizations", account(handlers.OrganizationsHandler)).Alias("/api/organizations")
+	v1.Handle("GET /organizations/{id}", account(handlers.OrganizationHandler(store))).Alias("/api/organizations/{id}")
+	v1.Handle("PATCH /organizations/{id}", account(handlers.OrganizationHandler(store))).Alias("/api/organizations/{id}")
+	v1.Handle("DELETE /organizations/{id}", account(handlers.OrganizationHandler(store))).Alias("/api/organizations/{id}")
+	v1.Handle("GET /organizations/{id}/members", account(handlers.OrganizationMembersHandler)).Alias("/api/organizations/{id}/members")
+	v1.Handle("POST /organizations/{id}/members", account(handlers.OrganizationMembersHandler)).Alias("/api/organizations/{id}/members")
+	v1.Handle("PATCH /organizations/{id}/members/{user_id}", account(handlers.OrganizationMemberHandler)).Alias("/api/organizations/{id}/members/{user_id}")
+	v1.Handle("DELETE /organizations/{id}/members/{user_id}", account(handlers.OrganizationMemberHandler)).Alias("/api/organizations/{id}/members/{user_id}")
+
+	//administration routes
+	v1.Handle("DELETE /data/all", admin(models.PermDataDeleteAny, handlers.DeleteScrapedData(store))).Alias("/api/delete-data")
+	v1.Handle("GET /data/trash", admin(models.PermTrashManage, handlers.ListTrashHandler(store))).Alias("/api/data/trash")
+	v1.Handle("POST /data/trash/restore", admin(models.PermTrashManage, handlers.RestoreTrashHandler(store))).Alias("/api/data/trash/restore")
+	v1.Handle("GET /retention-policies", admin(models.PermRetentionManage, handlers.RetentionPoliciesHandler)).Alias("/api/retention-policies")
+	v1.Handle("POST /retention-policies", admin(models.PermRetentionManage, handlers.RetentionPoliciesHandler)).Alias("/api/retention-policies")
+	v1.Handle("DELETE /retention-policies", admin(models.PermRetentionManage, handlers.RetentionPoliciesHandler)).Alias("/api/retention-policies")
+	v1.Handle("GET /janitor", admin(models.PermRetentionManage, handlers.JanitorStatusHandler(janitor))).Alias("/api/janitor")
+	v1.Handle("POST /janitor", admin(models.PermRetentionManage, handlers.JanitorStatusHandler(janitor))).Alias("/api/janitor")
+	v1.Handle("GET /users", admin(models.PermUsersManage, handlers.UsersHandler)).Alias("/api/users")
+	v1.Handle("GET /users/{id}", admin(models.PermUsersManage, handlers.UserHandler(store))).Alias("/api/users/{id}")
+	v1.Handle("DELETE /users/{id}", admin(models.PermUsersManage, handlers.UserHandler(store))).Alias("/api/users/{id}")
+	v1.Handle("PUT /users/{id}/role", admin(models.PermUsersManage, handlers.UserRoleHandler)).Alias("/api/users/{id}/role")
+	v1.Handle("POST /users/{id}/lock", admin(models.PermUsersManage, handlers.UserLockHandler)).Alias("/api/users/{id}/lock")
+	v1.Handle("DELETE /users/{id}/lock", admin(models.PermUsersManage, handlers.UserLockHandler)).Alias("/api/users/{id}/lock")
+	v1.Handle("POST /users/{id}/password-reset", admin(models.PermUsersManage, handlers.UserPasswordResetHandler)).Alias("/api/users/{id}/password-reset")
+	v1.Handle("GET /login-lockouts", admin(models.PermUsersManage, handlers.LoginLockoutsHandler)).Alias("/api/login-lockouts")
+	v1.Handle("DELETE /login-lockouts", admin(models.PermUsersManage, handlers.LoginLockoutsHandler)).Alias("/api/login-lockouts")
+	v1.Handle("DELETE /users/{id}/2fa", admin(models.PermUsersManage, handlers.UserTwoFactorHandler)).Alias("/api/users/{id}/2fa")
+	v1.Handle("DELETE /users/{id}/sessions", admin(models.PermUsersManage, handlers.UserSessionsHandler)).Alias("/api/users/{id}/sessions")
+	v1.Handle("GET /roles", admin(models.PermRolesManage, handlers.RolesHandler)).Alias("/api/roles")
+	v1.Handle("POST /roles", admin(models.PermRolesManage, handlers.RolesHandler)).Alias("/api/roles")
+	v1.Handle("PUT /roles/{name}", admin(models.PermRolesManage, handlers.RoleHandler)).Alias("/api/roles/{name}")
+	v1.Handle("DELETE /roles/{name}", admin(models.PermRolesManage, handlers.RoleHandler)).Alias("/api/roles/{name}")
+	v1.Handle("GET /quotas", admin(models.PermUsersManage, handlers.QuotasHandler)).Alias("/api/quotas")
+	v1.Handle("PUT /quotas/{scope}/{target}", admin(models.PermUsersManage, handlers.QuotaHandler)).Alias("/api/quotas/{scope}/{target}")
+	v1.Handle("DELETE /quotas/{scope}/{target}", admin(models.PermUsersManage, handlers.QuotaHandler)).Alias("/api/quotas/{scope}/{target}")
+	v1.Handle("GET /usage", admin(models.PermUsageRead, handlers.UsageExportHandler)).Alias("/api/usage")
+	v1.Handle("GET /audit", admin(models.PermAuditRead, handlers.AuditEventsHandler)).Alias("/api/audit")
+	v1.Handle("GET /audit/verify", admin(models.PermAuditRead, handlers.AuditVerifyHandler)).Alias("/api/audit/verify")
+	v1.Handle("GET /permissions", admin(models.PermRolesManage, handlers.PermissionsHandler)).Alias("/api/permissions")
 
 	//public avaliable routes
-	http.HandleFunc("/api/register-user", handlers.RegisterHandler)
-	http.HandleFunc("/api/login-user", handlers.LoginHandler)
-	//http.HandleFunc("/api/get-data", handlers.GetScrapedDataHandler) //testing example
+	v1.Handle("POST /register", local(handlers.RegisterHandler)).Alias("/api/register-user")
+	v1.Handle("POST /login", local(handlers.LoginHandler)).Alias("/api/login-user")
+	v1.Handle("POST /change-password", local(handlers.ChangePasswordHandler)).Alias("/api/change-password")
+	v1.Handle("POST /password-reset", local(handlers.PasswordResetHandler)).Alias("/api/password-reset")
+	v1.HandleFunc("GET /auth/providers", handlers.AuthProvidersHandler(cfg.Auth)).Alias("/api/auth/providers")
+	v1.Handle("GET /oidc/login", login(handlers.OIDCLoginHandler(cfg.Auth.OIDC))).Alias("/api/oidc/login").Unsafe()
+	v1.Handle("GET /oidc/callback", login(handlers.OIDCCallbackHandler(cfg.Auth.OIDC))).Alias("/api/oidc/callback").Unsafe()
+	v1.Handle("POST /login/2fa", login(handlers.LoginTwoFactorHandler)).Alias("/api/login/2fa")
+	v1.Handle("POST /login/2fa/enroll", login(handlers.LoginTwoFactorEnrollHandler)).Alias("/api/login/2fa/enroll")
+	v1.Handle("POST /token/refresh", login(handlers.RefreshTokenHandler)).Alias("/api/token/refresh")
+	router.New(http.DefaultServeMux, "").HandleFunc("GET /.well-known/jwks.json", handlers.JWKSHandler)
 
 	//documentation routes
 	http.HandleFunc("/swagger/swagger.json", func(w http.ResponseWriter, r *http.Request) {
@@ -30,6 +141,6 @@ func SetupRoutes() {
 	})
 
 	http.Handle("/swagger/", httpSwagger.Handler(
-		httpSwagger.URL("http://localhost:8080/swagger/doc.json"),
+		httpSwagger.URL(cfg.Server.SwaggerURL),
 	))
 }
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"GoGrab/auth"
+	"GoGrab/config"
+	"GoGrab/database"
+	"GoGrab/export"
+	"GoGrab/functions"
+	"GoGrab/middleware"
+	"GoGrab/ratelimit"
+	"GoGrab/routes"
+	"GoGrab/storage"
+	"GoGrab/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Run connects to the database, checks the signing keys, creates the first admin if needed, starts the janitor, resumes the
+// crawls interrupted by the last shutdown and serves the API, all with the given configuration, until SIGINT or SIGTERM.
+func Run(cfg *config.Config) error {
+	log.Printf("Configuration:\n%s", cfg)
+	utils.SetTrustedProxies(cfg.Server.TrustedProxyPrefixes())
+	auth.Configure(cfg.Auth)
+	limiter, err := ratelimit.New(cfg.RateLimit)
+	if err != nil {
+		return err
+	}
+	functions.CheckDatabaseConnection(cfg.Database)
+	// without a signing key no login could work, so refuse to start
+	if err := auth.LoadSigningKeys(); err != nil {
+		return err
+	}
+	auth.StartKeyRotation()
+	if _, err := auth.Authenticators(); err != nil {
+		return err
+	}
+	if err := auth.BootstrapAdmin(); err != nil {
+		log.Printf("Admin bootstrap failed: %v", err)
+	}
+	store := storage.New(cfg.Storage)
+	archives := export.NewArchives(cfg.Storage, store)
+	janitor := functions.NewJanitor(cfg.Storage, store, archives)
+	janitor.Start()
+	functions.ResumeInterruptedCrawls(cfg.Crawler, store)
+	routes.SetupRoutes(cfg, store, archives, janitor, limiter)
+
+	server := &http.Server{Addr: cfg.Server.Addr, Handler: middleware.RequestID(http.DefaultServeMux)}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+
+	fmt.Println("Server started at port" + cfg.Server.Addr)
+	select {
+	case err := <-served:
+		return err
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down", sig)
+	}
+	signal.Stop(stop)
+	return shutdown(cfg, server, store)
+}
+
+/*
+shutdown stops taking requests and new crawl jobs, gives the requests and page fetches in flight
+until the shutdown timeout to finish and checkpoints the crawls that didn't, so they resume on the
+next start. Then it flushes the storage and closes the database.
+*/
+func shutdown(cfg *config.Config, server *http.Server, store *storage.Store) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// crawls run inside their requests, so the server only finishes once they are drained
+	crawlsStopped := make(chan error, 1)
+	go func() {
+		crawlsStopped <- functions.ShutdownCrawls(ctx)
+	}()
+	var errs []error
+	if err := server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("error shutting down the server: %v", err))
+	}
+	if err := <-crawlsStopped; err != nil {
+		errs = append(errs, err)
+	}
+
+	store.Close()
+	if sqlDB, err := database.DB.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing the database: %v", err))
+		}
+	}
+	log.Println("Shutdown complete")
+	return errors.Join(errs...)
+}
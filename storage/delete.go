@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"GoGrab/models"
+	"time"
+)
+
+// FileDeletion lists the pages removed (or that would be removed) from one host file.
+type FileDeletion struct {
+	File  string   `json:"file"`
+	Pages int      `json:"pages"`
+	URLs  []string `json:"urls"`
+}
+
+// DeletionResult reports the outcome of DeletePages.
+type DeletionResult struct {
+	DryRun    bool           `json:"dry_run"`
+	Matched   int            `json:"matched"`
+	Files     []FileDeletion `json:"files"`
+	TrashID   string         `json:"trash_id,omitempty"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+}
+
+/*
+DeletePages removes every stored page matching the filter and moves it into a trash batch,
+from which an admin can restore it until the grace period runs out.
+With dryRun set nothing is changed and the result only reports what would be removed.
+The rewritten host files are staged and the trash batch is written before any host file is replaced,
+so a failure never loses pages.
+*/
+func (s *Store) DeletePages(filter PageFilter, dryRun bool, deletedBy int) (*DeletionResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := &DeletionResult{DryRun: dryRun, Files: []FileDeletion{}}
+
+	files, err := s.ListHostFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	// split every host file into the pages we keep and the pages we remove
+	kept := make(map[string][]models.PageData)
+	var entries []TrashEntry
+	for _, fileName := range files {
+		pages, err := s.readHostFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		deletion := FileDeletion{File: fileName, URLs: []string{}}
+		var keep []models.PageData
+		for _, page := range pages {
+			if !filter.Matches(page) {
+				keep = append(keep, page)
+				continue
+			}
+			deletion.Pages++
+			deletion.URLs = append(deletion.URLs, page.URL)
+			entries = append(entries, TrashEntry{File: fileName, Page: page})
+		}
+
+		if deletion.Pages > 0 {
+			kept[fileName] = keep
+			result.Files = append(result.Files, deletion)
+			result.Matched += deletion.Pages
+		}
+	}
+
+	if dryRun || result.Matched == 0 {
+		return result, nil
+	}
+
+	// stage the rewritten host files first, nothing is changed yet if one of them can't be written
+	staged := make(map[string]string)
+	defer func() {
+		for _, tempPath := range staged {
+			removeStaged(tempPath) // no-op once committed
+		}
+	}()
+	for fileName, pages := range kept {
+		tempPath, err := s.stageHostFile(fileName, pages)
+		if err != nil {
+			return nil, err
+		}
+		staged[fileName] = tempPath
+	}
+
+	batch, err := s.writeTrashBatch(filter, deletedBy, entries)
+	if err != nil {
+		return nil, err
+	}
+	result.TrashID = batch.ID
+	result.ExpiresAt = &batch.ExpiresAt
+
+	// the pages of a host file are gone once its rewritten file is in place, so a failure
+	// halfway still counts the files replaced so far and keeps only their pages in the trash
+	removed := make(map[int]int64)
+	defer func() { s.recordStoredBytes(removed) }()
+	committed := make(map[string]bool)
+	for fileName, tempPath := range staged {
+		if err := s.commitHostFile(fileName, tempPath); err != nil {
+			s.keepTrashEntries(batch, committed)
+			return nil, err
+		}
+		committed[fileName] = true
+		for _, entry := range entries {
+			if entry.File == fileName {
+				removed[entry.Page.UserID] -= PageSize(entry.Page)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"GoGrab/config"
+	"GoGrab/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store in temporary folders that adds the stored bytes changes to the returned map.
+func newTestStore(t *testing.T) (*Store, map[int]int64) {
+	t.Helper()
+	stored := make(map[int]int64)
+	store := New(config.StorageConfig{DataFolder: t.TempDir(), TrashFolder: t.TempDir(), TrashGracePeriod: time.Hour})
+	store.addStoredBytes = func(changes map[int]int64) error {
+		for userID, change := range changes {
+			stored[userID] += change
+		}
+		return nil
+	}
+	return store, stored
+}
+
+// savePages stores the pages and fails the test if one can't be saved.
+func savePages(t *testing.T, store *Store, pages ...models.PageData) {
+	t.Helper()
+	for _, page := range pages {
+		if err := store.SavePageToFile(page); err != nil {
+			t.Fatalf("SavePageToFile(%s): %v", page.URL, err)
+		}
+	}
+}
+
+// storedURLs returns the URLs of every stored page, sorted.
+func storedURLs(t *testing.T, store *Store) []string {
+	t.Helper()
+	urls := []string{}
+	err := store.EachPage(PageFilter{}, func(page models.PageData) error {
+		urls = append(urls, page.URL)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachPage: %v", err)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"https://example.com/a", "https://example.com/a", true},
+		{"https://example.com/a", "https://example.com/ab", false},
+		{"https://example.com/*", "https://example.com/docs/page", true},
+		{"https://*.example.com/*", "https://blog.example.com/post", true},
+		{"https://*.example.com/*", "https://example.com/post", false},
+		{"*/docs/*", "https://example.org/docs/intro", true},
+		{"*", "", true},
+		{"https://example.com/?q=*", "https://example.com/?q=go", true},
+		{"https://example.com/?q=*", "https://example.com/Xq=go", false},
+	}
+	for _, test := range tests {
+		if got := wildcardMatch(test.pattern, test.value); got != test.want {
+			t.Errorf("wildcardMatch(%q, %q) = %t, want %t", test.pattern, test.value, got, test.want)
+		}
+	}
+}
+
+func TestPageFilterMatches(t *testing.T) {
+	crawledAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	page := models.PageData{URL: "https://Blog.Example.com/post/1", JobID: "job", UserID: 7, OrganizationID: 3, CrawledAt: crawledAt}
+
+	tests := []struct {
+		name   string
+		filter PageFilter
+		page   models.PageData
+		want   bool
+	}{
+		{"empty filter", PageFilter{}, page, true},
+		{"job", PageFilter{JobID: "job"}, page, true},
+		{"other job", PageFilter{JobID: "other"}, page, false},
+		{"other user", PageFilter{UserID: 8}, page, false},
+		{"organization", PageFilter{Scoped: true, OrganizationID: 3}, page, true},
+		{"personal workspace", PageFilter{Scoped: true}, page, false},
+		{"host ignores case", PageFilter{Host: "blog.example.com"}, page, true},
+		{"host is not a suffix", PageFilter{Host: "example.com"}, page, false},
+		{"url pattern", PageFilter{URLPattern: "https://*.Example.com/post/*"}, page, true},
+		{"url pattern is case sensitive", PageFilter{URLPattern: "https://*.example.com/post/*"}, page, false},
+		{"crawled before", PageFilter{CrawledBefore: crawledAt.Add(time.Hour)}, page, true},
+		{"crawled before is exclusive", PageFilter{CrawledBefore: crawledAt}, page, false},
+		{"crawled after", PageFilter{CrawledAfter: crawledAt.Add(-time.Hour)}, page, true},
+		{"crawled after is exclusive", PageFilter{CrawledAfter: crawledAt}, page, false},
+		{"no timestamp never matches a date", PageFilter{CrawledAfter: crawledAt}, models.PageData{URL: page.URL}, false},
+	}
+	for _, test := range tests {
+		if got := test.filter.Matches(test.page); got != test.want {
+			t.Errorf("%s: Matches = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDeletePages(t *testing.T) {
+	pages := []models.PageData{
+		{URL: "https://blog.example.com/a", Content: "a", UserID: 1},
+		{URL: "https://blog.example.com/b", Content: "b", UserID: 1},
+		{URL: "https://docs.example.com/c", Content: "c", UserID: 2},
+		{URL: "https://example.org/d", Content: "d", UserID: 2},
+	}
+
+	tests := []struct {
+		name    string
+		filter  PageFilter
+		dryRun  bool
+		matched int
+		left    []string
+	}{
+		{"dry run", PageFilter{Host: "blog.example.com"}, true, 2, []string{"https://blog.example.com/a", "https://blog.example.com/b", "https://docs.example.com/c", "https://example.org/d"}},
+		{"host", PageFilter{Host: "blog.example.com"}, false, 2, []string{"https://docs.example.com/c", "https://example.org/d"}},
+		{"wildcard hosts", PageFilter{URLPattern: "https://*.example.com/*"}, false, 3, []string{"https://example.org/d"}},
+		{"single page", PageFilter{URLPattern: "https://blog.example.com/b"}, false, 1, []string{"https://blog.example.com/a", "https://docs.example.com/c", "https://example.org/d"}},
+		{"no match", PageFilter{Host: "example.net"}, false, 0, []string{"https://blog.example.com/a", "https://blog.example.com/b", "https://docs.example.com/c", "https://example.org/d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, stored := newTestStore(t)
+			savePages(t, store, pages...)
+			before := stored[1] + stored[2]
+			var removed int64
+			if !test.dryRun {
+				store.EachPage(test.filter, func(page models.PageData) error {
+					removed += PageSize(page)
+					return nil
+				})
+			}
+
+			result, err := store.DeletePages(test.filter, test.dryRun, 1)
+			if err != nil {
+				t.Fatalf("DeletePages: %v", err)
+			}
+			if result.Matched != test.matched {
+				t.Errorf("matched %d pages, want %d", result.Matched, test.matched)
+			}
+			if got := storedURLs(t, store); !reflect.DeepEqual(got, test.left) {
+				t.Errorf("pages left %v, want %v", got, test.left)
+			}
+
+			batches, err := store.ListTrash()
+			if err != nil {
+				t.Fatalf("ListTrash: %v", err)
+			}
+			wantBatches := 1
+			if test.dryRun || test.matched == 0 {
+				wantBatches = 0
+			}
+			if len(batches) != wantBatches || (wantBatches == 1 && (batches[0].ID != result.TrashID || batches[0].Pages != test.matched)) {
+				t.Errorf("got trash %+v, want %d batch with the %d pages of %q", batches, wantBatches, test.matched, result.TrashID)
+			}
+
+			if got := before - stored[1] - stored[2]; got != removed {
+				t.Errorf("stored bytes dropped by %d, want %d", got, removed)
+			}
+		})
+	}
+}
+
+func TestDeletePagesRestore(t *testing.T) {
+	store, stored := newTestStore(t)
+	savePages(t, store,
+		models.PageData{URL: "https://example.com/a", Content: "a", UserID: 1},
+		models.PageData{URL: "https://example.com/b", Content: "b", UserID: 1},
+		models.PageData{URL: "https://example.org/c", Content: "c", UserID: 1},
+	)
+	before := stored[1]
+
+	result, err := store.DeletePages(PageFilter{URLPattern: "https://example.com/*"}, false, 1)
+	if err != nil {
+		t.Fatalf("DeletePages: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.dataFolder, "example.com.json")); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the emptied host file removed", err)
+	}
+
+	restored, err := store.RestoreTrash(result.TrashID)
+	if err != nil || restored != 2 {
+		t.Fatalf("RestoreTrash = %d, %v, want 2 pages", restored, err)
+	}
+	if got := storedURLs(t, store); len(got) != 3 {
+		t.Errorf("got pages %v after the restore, want all 3", got)
+	}
+	if stored[1] != before {
+		t.Errorf("stored bytes %d after the round trip, want %d", stored[1], before)
+	}
+	if _, err := store.RestoreTrash(result.TrashID); err != ErrTrashNotFound {
+		t.Errorf("second RestoreTrash: got %v, want ErrTrashNotFound", err)
+	}
+}
+
+func TestDeletePagesKeepsFilesWhenTrashFails(t *testing.T) {
+	store, stored := newTestStore(t)
+	savePages(t, store, models.PageData{URL: "https://example.com/a", Content: "a", UserID: 1})
+	before := stored[1]
+
+	// a file in the way of the trash folder makes writing the batch fail
+	store.trashFolder = filepath.Join(t.TempDir(), "trash")
+	if err := os.WriteFile(store.trashFolder, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.DeletePages(PageFilter{}, false, 1); err == nil {
+		t.Fatal("DeletePages succeeded without a trash folder")
+	}
+	if got := storedURLs(t, store); len(got) != 1 {
+		t.Errorf("got pages %v, want the page kept", got)
+	}
+	entries, err := os.ReadDir(store.dataFolder)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("got %d files, %v, want only the host file without staged files", len(entries), err)
+	}
+	if stored[1] != before {
+		t.Errorf("stored bytes changed to %d, want %d", stored[1], before)
+	}
+}
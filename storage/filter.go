@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"GoGrab/models"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PageFilter selects stored pages. Empty fields don't restrict the selection,
+// so the zero value matches every page. With Scoped set only pages of OrganizationID match,
+// 0 being the personal pages that belong to no organization.
+type PageFilter struct {
+	JobID          string    `json:"job_id,omitempty"`
+	UserID         int       `json:"user_id,omitempty"`
+	Scoped         bool      `json:"scoped,omitempty"`
+	OrganizationID int       `json:"organization_id,omitempty"`
+	Host           string    `json:"host,omitempty"`
+	URLPattern     string    `json:"url_pattern,omitempty"`
+	CrawledBefore  time.Time `json:"crawled_before,omitempty"`
+	CrawledAfter   time.Time `json:"crawled_after,omitempty"`
+}
+
+// IsEmpty reports whether the filter would match every page.
+func (f PageFilter) IsEmpty() bool {
+	return f.JobID == "" && f.UserID == 0 && !f.Scoped && f.Host == "" && f.URLPattern == "" &&
+		f.CrawledBefore.IsZero() && f.CrawledAfter.IsZero()
+}
+
+/*
+InWorkspace restricts the filter to the pages of a workspace: the pages of its organization,
+or in the personal workspace the user's own pages that belong to no organization.
+Across all workspaces nothing is restricted.
+*/
+func (f *PageFilter) InWorkspace(workspace models.Workspace, userID int) {
+	if workspace.All {
+		return
+	}
+	f.Scoped = true
+	f.OrganizationID = workspace.OrganizationID
+	if workspace.OrganizationID == 0 {
+		f.UserID = userID
+	}
+}
+
+/*
+Matches reports whether a page satisfies every field of the filter.
+URLPattern is matched against the full page URL and supports "*" as a wildcard for any run of characters.
+Pages saved before crawl timestamps were recorded never match a date bound, so they can't be removed by accident.
+*/
+func (f PageFilter) Matches(page models.PageData) bool {
+	if f.JobID != "" && page.JobID != f.JobID {
+		return false
+	}
+	if f.UserID != 0 && page.UserID != f.UserID {
+		return false
+	}
+	if f.Scoped && page.OrganizationID != f.OrganizationID {
+		return false
+	}
+	if f.Host != "" {
+		parsedURL, err := url.Parse(page.URL)
+		if err != nil || !strings.EqualFold(parsedURL.Hostname(), f.Host) {
+			return false
+		}
+	}
+	if f.URLPattern != "" && !wildcardMatch(f.URLPattern, page.URL) {
+		return false
+	}
+	if !f.CrawledBefore.IsZero() && (page.CrawledAt.IsZero() || !page.CrawledAt.Before(f.CrawledBefore)) {
+		return false
+	}
+	if !f.CrawledAfter.IsZero() && (page.CrawledAt.IsZero() || !page.CrawledAt.After(f.CrawledAfter)) {
+		return false
+	}
+	return true
+}
+
+// wildcardMatch matches the whole value against a pattern where "*" stands for any run of characters.
+func wildcardMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	re, err := regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+	if err != nil {
+		return false
+	}
+	return re.MatchString(value)
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"GoGrab/config"
+	"GoGrab/database"
+	"GoGrab/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Store keeps the scraped pages in its data folder, one JSON file per host, and the soft-deleted pages in
+its trash folder, one JSON file per deletion batch. The trash lives outside the data folder so deleted
+pages never show up in downloads.
+*/
+type Store struct {
+	dataFolder       string
+	trashFolder      string
+	trashGracePeriod time.Duration
+	// addStoredBytes updates the stored bytes counters of the quotas, database.AddStoredBytes outside of tests
+	addStoredBytes func(changes map[int]int64) error
+	// lock serializes every read-modify-write of the host files, so a crawl
+	// that appends a page can't race with a deletion or a restore rewriting the same file.
+	lock sync.Mutex
+}
+
+// New returns the store of the folders and the trash grace period of the configuration.
+func New(cfg config.StorageConfig) *Store {
+	return &Store{
+		dataFolder:       cfg.DataFolder,
+		trashFolder:      cfg.TrashFolder,
+		trashGracePeriod: cfg.TrashGracePeriod,
+		addStoredBytes:   database.AddStoredBytes,
+	}
+}
+
+/*
+Close waits for the write to the host files in progress and blocks every later one, for a shutdown.
+Host files are written to a temporary file, flushed and renamed, so they are complete once it returns.
+*/
+func (s *Store) Close() {
+	s.lock.Lock()
+}
+
+/*
+	 	SavePageToFile saves the page data (models.PageData) to a JSON file.
+		If the file already exists, it reads the existing content, appends the new page,
+		and then writes it back to the file. The file is stored in the data folder.
+		The page is stored as the next version of its URL, with its page ID and content hash filled in.
+		Returns an error if file operations fail.
+*/
+func (s *Store) SavePageToFile(page models.PageData) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Get base URL to use as the file name
+	baseURL, err := getBaseURL(page.URL)
+	if err != nil {
+		return err
+	}
+	fileName := sanitizeFileName(baseURL) + ".json"
+
+	// Read existing pages if any
+	pages, err := s.readHostFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	// Record the fetch as the next version of the page
+	page.PageID = PageIDFor(page.URL)
+	page.ContentHash = ContentHash(page.Content)
+	page.Version = nextVersion(pages, page)
+
+	// Add the new page to the list and write the updated pages back
+	pages = append(pages, page)
+	if err := s.writeHostFile(fileName, pages); err != nil {
+		return err
+	}
+	s.recordStoredBytes(map[int]int64{page.UserID: PageSize(page)})
+
+	// Get the absolute file path and print a success message
+	absPath, err := filepath.Abs(filepath.Join(s.dataFolder, fileName))
+	if err != nil {
+		return fmt.Errorf("error getting absolute path: %v", err)
+	}
+	fmt.Printf("Page data saved to: %s\n", absPath)
+	return nil
+}
+
+/*
+ListHostFiles returns the names of all host files in the data folder.
+A missing data folder is not an error, it just means nothing was scraped yet.
+*/
+func (s *Store) ListHostFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.dataFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading data folder: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+/*
+readHostFile decodes the pages stored in a host file.
+A file that doesn't exist yet is treated as an empty list of pages.
+Pages saved before versions were recorded get their version information filled in.
+The caller must hold the lock.
+*/
+func (s *Store) readHostFile(fileName string) ([]models.PageData, error) {
+	file, err := os.Open(filepath.Join(s.dataFolder, fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	var pages []models.PageData
+	if err := json.NewDecoder(file).Decode(&pages); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error decoding JSON: %v", err)
+	}
+	fillVersionInfo(pages)
+	return pages, nil
+}
+
+/*
+writeHostFile replaces the content of a host file with the given pages.
+The pages are written to a temporary file that is renamed over the host file, so readers never
+see a half-written file and files opened before the write (e.g. by a download) keep their content.
+When no pages are left the file is removed instead of keeping an empty array around.
+The caller must hold the lock.
+*/
+func (s *Store) writeHostFile(fileName string, pages []models.PageData) error {
+	tempPath, err := s.stageHostFile(fileName, pages)
+	if err != nil {
+		return err
+	}
+	defer removeStaged(tempPath) // no-op once the rename succeeded
+	return s.commitHostFile(fileName, tempPath)
+}
+
+/*
+stageHostFile writes the pages to a temporary file in the data folder and returns its path, for
+commitHostFile to rename over the host file. With no pages left there is nothing to write and the
+path is empty. The caller must hold the lock and remove the file with removeStaged if it isn't committed.
+*/
+func (s *Store) stageHostFile(fileName string, pages []models.PageData) (string, error) {
+	if len(pages) == 0 {
+		return "", nil
+	}
+
+	// Ensure the folder for storing pages exists
+	if err := os.MkdirAll(s.dataFolder, os.ModePerm); err != nil {
+		return "", fmt.Errorf("error creating folder: %v", err)
+	}
+
+	// the temporary name doesn't end in .json, so ListHostFiles never picks it up
+	file, err := os.CreateTemp(s.dataFolder, fileName+".tmp*")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %v", err)
+	}
+	tempPath := file.Name()
+	file.Chmod(0644)
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "    ") // Indent for better readability
+	if err := encoder.Encode(pages); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return "", fmt.Errorf("error encoding JSON: %v", err)
+	}
+	// flush the file before it replaces the old one, so a crash right after the rename can't leave it empty
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return "", fmt.Errorf("error writing file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("error writing file: %v", err)
+	}
+	return tempPath, nil
+}
+
+// commitHostFile renames a file staged by stageHostFile over the host file, or removes the host file for an empty path.
+func (s *Store) commitHostFile(fileName, tempPath string) error {
+	filePath := filepath.Join(s.dataFolder, fileName)
+	if tempPath == "" {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing file: %v", err)
+		}
+		return nil
+	}
+	if err := os.Rename(tempPath, filePath); err != nil {
+		return fmt.Errorf("error replacing file: %v", err)
+	}
+	return nil
+}
+
+// removeStaged removes a staged file that wasn't committed, it does nothing once the file was renamed.
+func removeStaged(tempPath string) {
+	if tempPath != "" {
+		os.Remove(tempPath)
+	}
+}
+
+/*
+		getBaseURL extracts and returns the scheme and host from a URL.
+	 	It is used to create a consistent base URL for file naming.
+	 	Returns an error if the URL can't be parsed.
+*/
+func getBaseURL(urlStr string) (string, error) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("error parsing URL: %v", err)
+	}
+	return fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host), nil
+}
+
+/*
+sanitizeFileName creates a safe file name based on the URL's hostname.
+If the hostname can't be parsed, it falls back to "invalid_url" or "default".
+*/
+func sanitizeFileName(urlStr string) string {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		log.Printf("error parsing URL: %v", err)
+		return "invalid_url"
+	}
+	fileName := parsedURL.Hostname()
+	if len(fileName) == 0 {
+		fileName = "default"
+	}
+	return fileName
+}
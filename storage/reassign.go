@@ -0,0 +1,44 @@
+package storage
+
+// ReassignPages hands every page crawled by one user over to another one and returns the number of pages moved.
+func (s *Store) ReassignPages(fromUserID, toUserID int) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.ListHostFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	reassigned := 0
+	moved := make(map[int]int64)
+	defer func() { s.recordStoredBytes(moved) }()
+	for _, fileName := range files {
+		pages, err := s.readHostFile(fileName)
+		if err != nil {
+			return reassigned, err
+		}
+
+		// the user ID is part of a stored page, so its size is taken before and after the change
+		var before, after int64
+		changed := 0
+		for i := range pages {
+			if pages[i].UserID == fromUserID {
+				before += PageSize(pages[i])
+				pages[i].UserID = toUserID
+				after += PageSize(pages[i])
+				changed++
+			}
+		}
+		if changed == 0 {
+			continue
+		}
+		if err := s.writeHostFile(fileName, pages); err != nil {
+			return reassigned, err
+		}
+		reassigned += changed
+		moved[fromUserID] -= before
+		moved[toUserID] += after
+	}
+	return reassigned, nil
+}
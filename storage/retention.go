@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"GoGrab/models"
+	"GoGrab/utils"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RetentionRemoval describes a page removed by ApplyRetention.
+type RetentionRemoval struct {
+	File      string    `json:"file"`
+	URL       string    `json:"url"`
+	CrawledAt time.Time `json:"crawled_at"`
+	PolicyID  int       `json:"policy_id"`
+}
+
+// policyFilter returns the filter selecting the pages a retention policy applies to.
+// A policy with an unknown scope selects nothing.
+func policyFilter(policy models.RetentionPolicy) (PageFilter, bool) {
+	switch policy.Scope {
+	case "user":
+		userID, err := strconv.Atoi(policy.Target)
+		if err != nil || userID == 0 {
+			return PageFilter{}, false
+		}
+		return PageFilter{UserID: userID}, true
+	case "job":
+		return PageFilter{JobID: policy.Target}, true
+	case "host":
+		return PageFilter{Host: policy.Target}, true
+	}
+	return PageFilter{}, false
+}
+
+/*
+ApplyRetention permanently removes the pages that are expired under any of the given policies.
+When several policies apply to a page the strictest one wins. Pages saved before crawl
+timestamps were recorded have no age, so only the keep-last rule can remove them.
+Retention removals skip the trash, expired content must not be kept around any longer.
+*/
+func (s *Store) ApplyRetention(policies []models.RetentionPolicy, now time.Time) ([]RetentionRemoval, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.ListHostFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	removals := []RetentionRemoval{}
+	removed := make(map[int]int64)
+	defer func() { s.recordStoredBytes(removed) }()
+	for _, fileName := range files {
+		pages, err := s.readHostFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		// removedBy maps the index of every expired page to the policy that expired it
+		removedBy := make(map[int]int)
+		for _, policy := range policies {
+			filter, ok := policyFilter(policy)
+			if !ok {
+				continue
+			}
+			for index := range expiredPages(pages, filter, policy, now) {
+				if _, exists := removedBy[index]; !exists {
+					removedBy[index] = policy.ID
+				}
+			}
+		}
+		if len(removedBy) == 0 {
+			continue
+		}
+
+		var keep []models.PageData
+		var expired []models.PageData
+		for index, page := range pages {
+			policyID, isRemoved := removedBy[index]
+			if !isRemoved {
+				keep = append(keep, page)
+				continue
+			}
+			expired = append(expired, page)
+			removals = append(removals, RetentionRemoval{File: fileName, URL: page.URL, CrawledAt: page.CrawledAt, PolicyID: policyID})
+		}
+		if err := s.writeHostFile(fileName, keep); err != nil {
+			return nil, err
+		}
+		for _, page := range expired {
+			removed[page.UserID] -= PageSize(page)
+		}
+		log.Printf("Retention removed %d pages from %s", len(removedBy), fileName)
+	}
+	return removals, nil
+}
+
+// expiredPages returns the indexes of the pages in the policy's scope that one of its rules expires.
+func expiredPages(pages []models.PageData, filter PageFilter, policy models.RetentionPolicy, now time.Time) map[int]bool {
+	expired := make(map[int]bool)
+
+	// group the pages in scope by URL, a page's position in the file is its crawl order
+	snapshots := make(map[string][]int)
+	for index, page := range pages {
+		if !filter.Matches(page) {
+			continue
+		}
+		if policy.MaxAgeDays > 0 && !page.CrawledAt.IsZero() && now.Sub(page.CrawledAt) > time.Duration(policy.MaxAgeDays)*24*time.Hour {
+			expired[index] = true
+		}
+		key := utils.NormalizeURL(page.URL)
+		snapshots[key] = append(snapshots[key], index)
+	}
+
+	if policy.KeepLast > 0 {
+		for _, indexes := range snapshots {
+			// newest first, falling back to file order for pages without a timestamp
+			sort.SliceStable(indexes, func(i, j int) bool {
+				a, b := pages[indexes[i]].CrawledAt, pages[indexes[j]].CrawledAt
+				if a.Equal(b) {
+					return indexes[i] > indexes[j]
+				}
+				return a.After(b)
+			})
+			for _, index := range indexes[min(policy.KeepLast, len(indexes)):] {
+				expired[index] = true
+			}
+		}
+	}
+	return expired
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"GoGrab/models"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// indexesOf returns the sorted indexes of an expiredPages result.
+func indexesOf(expired map[int]bool) []int {
+	indexes := []int{}
+	for index := range expired {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func TestExpiredPages(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	pages := []models.PageData{
+		0: {URL: "https://example.com/a", CrawledAt: now.Add(-3 * day)},
+		1: {URL: "https://example.com/a/", CrawledAt: now.Add(-1 * day)}, // the same page as 0 and 2
+		2: {URL: "https://example.com/a", CrawledAt: now.Add(-2 * day)},
+		3: {URL: "https://example.com/b", CrawledAt: now.Add(-40 * day)},
+		4: {URL: "https://example.com/c"}, // saved before crawl timestamps, in file order
+		5: {URL: "https://example.com/c"},
+		6: {URL: "https://example.org/a", CrawledAt: now.Add(-40 * day)},
+	}
+	host := PageFilter{Host: "example.com"}
+
+	tests := []struct {
+		name   string
+		filter PageFilter
+		policy models.RetentionPolicy
+		want   []int
+	}{
+		{"no rule", host, models.RetentionPolicy{}, []int{}},
+		{"keep last keeps the newest crawls", host, models.RetentionPolicy{KeepLast: 1}, []int{0, 2, 4}},
+		{"keep last two", host, models.RetentionPolicy{KeepLast: 2}, []int{0}},
+		{"keep more than stored", host, models.RetentionPolicy{KeepLast: 5}, []int{}},
+		{"max age", host, models.RetentionPolicy{MaxAgeDays: 30}, []int{3}},
+		{"max age spares a page exactly that old", host, models.RetentionPolicy{MaxAgeDays: 3}, []int{3}},
+		{"short max age spares pages without timestamp", host, models.RetentionPolicy{MaxAgeDays: 1}, []int{0, 2, 3}},
+		{"both rules", host, models.RetentionPolicy{KeepLast: 2, MaxAgeDays: 2}, []int{0, 3}},
+		{"other hosts are out of scope", PageFilter{Host: "example.org"}, models.RetentionPolicy{MaxAgeDays: 30}, []int{6}},
+	}
+	for _, test := range tests {
+		if got := indexesOf(expiredPages(pages, test.filter, test.policy, now)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	store, stored := newTestStore(t)
+	now := time.Now()
+	day := 24 * time.Hour
+	savePages(t, store,
+		models.PageData{URL: "https://example.com/", Content: "old", JobID: "job-a", UserID: 1, CrawledAt: now.Add(-10 * day)},
+		models.PageData{URL: "https://example.com/", Content: "new", JobID: "job-b", UserID: 1, CrawledAt: now.Add(-5 * day)},
+		models.PageData{URL: "https://example.com/docs", Content: "docs", JobID: "job-b", UserID: 1, CrawledAt: now.Add(-5 * day)},
+		models.PageData{URL: "https://example.org/", Content: "org", JobID: "job-b", UserID: 2, CrawledAt: now.Add(-5 * day)},
+	)
+	before := stored[1]
+
+	// the strictest policy wins, keeping the last crawl removes the old version although another policy keeps five;
+	// the job-b pages are younger than a week and a policy with an unknown scope selects nothing
+	policies := []models.RetentionPolicy{
+		{ID: 1, Scope: "host", Target: "example.com", KeepLast: 5},
+		{ID: 2, Scope: "host", Target: "example.com", KeepLast: 1},
+		{ID: 3, Scope: "job", Target: "job-b", MaxAgeDays: 7},
+		{ID: 4, Scope: "unknown", Target: "example.org", MaxAgeDays: 1},
+	}
+	removed, err := store.ApplyRetention(policies, now)
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+
+	var got []string
+	for _, removal := range removed {
+		got = append(got, removal.URL+" "+removal.CrawledAt.Format(time.DateOnly)+" by "+strconv.Itoa(removal.PolicyID))
+	}
+	want := []string{"https://example.com/ " + now.Add(-10*day).Format(time.DateOnly) + " by 2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got removals %v, want %v", got, want)
+	}
+	if urls := storedURLs(t, store); len(urls) != 3 {
+		t.Errorf("got pages %v, want 3 left", urls)
+	}
+	if stored[1] >= before || stored[2] == 0 {
+		t.Errorf("got stored bytes %v, want the removed page subtracted from user 1 only", stored)
+	}
+
+	// a max age removes what keep-last spares
+	removed, err = store.ApplyRetention([]models.RetentionPolicy{{ID: 5, Scope: "user", Target: "1", KeepLast: 1, MaxAgeDays: 1}}, now)
+	if err != nil || len(removed) != 2 {
+		t.Errorf("got %v, %v, want the 2 remaining pages of user 1 removed", removed, err)
+	}
+	if urls := storedURLs(t, store); !reflect.DeepEqual(urls, []string{"https://example.org/"}) {
+		t.Errorf("got pages %v, want only the page of user 2", urls)
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotFile is a host file opened as part of a Snapshot.
+type SnapshotFile struct {
+	Name    string
+	File    *os.File
+	Size    int64
+	ModTime time.Time
+}
+
+// Snapshot is a consistent, read-only view of all host files at one point in time.
+type Snapshot struct {
+	Files []SnapshotFile
+}
+
+/*
+OpenSnapshot opens every host file while holding the file lock. Host files are only ever
+replaced by renaming a new file over them, so the opened files keep the content they had
+when the snapshot was taken, no matter how long the caller needs to read them.
+The snapshot must be closed by the caller.
+*/
+func (s *Store) OpenSnapshot() (*Snapshot, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.ListHostFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	for _, fileName := range files {
+		file, err := os.Open(filepath.Join(s.dataFolder, fileName))
+		if err != nil {
+			snapshot.Close()
+			return nil, fmt.Errorf("error opening file: %v", err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			snapshot.Close()
+			return nil, fmt.Errorf("error reading file info: %v", err)
+		}
+		snapshot.Files = append(snapshot.Files, SnapshotFile{Name: fileName, File: file, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return snapshot, nil
+}
+
+// Close closes all files of the snapshot.
+func (s *Snapshot) Close() {
+	for _, file := range s.Files {
+		file.File.Close()
+	}
+}
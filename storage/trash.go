@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"GoGrab/models"
+	"GoGrab/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrTrashNotFound is returned when a trash batch doesn't exist or has already been purged.
+var ErrTrashNotFound = errors.New("trash batch not found")
+
+var trashIDPattern = regexp.MustCompile(`^[a-f0-9]+$`)
+
+// TrashEntry is a deleted page together with the host file it was removed from.
+type TrashEntry struct {
+	File string          `json:"file"`
+	Page models.PageData `json:"page"`
+}
+
+// TrashBatch groups the pages removed by a single deletion request.
+type TrashBatch struct {
+	ID        string       `json:"id"`
+	DeletedBy int          `json:"deleted_by"`
+	DeletedAt time.Time    `json:"deleted_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Filter    PageFilter   `json:"filter"`
+	Pages     int          `json:"pages"`
+	Entries   []TrashEntry `json:"entries,omitempty"`
+}
+
+// writeTrashBatch stores the removed pages as a new trash batch.
+func (s *Store) writeTrashBatch(filter PageFilter, deletedBy int, entries []TrashEntry) (*TrashBatch, error) {
+	id, err := utils.GenerateID()
+	if err != nil {
+		return nil, fmt.Errorf("error generating trash ID: %v", err)
+	}
+
+	now := time.Now()
+	batch := &TrashBatch{
+		ID:        id,
+		DeletedBy: deletedBy,
+		DeletedAt: now,
+		ExpiresAt: now.Add(s.trashGracePeriod),
+		Filter:    filter,
+		Pages:     len(entries),
+		Entries:   entries,
+	}
+
+	if err := s.saveTrashBatch(batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// saveTrashBatch writes a trash batch to its file, replacing an earlier version of it.
+func (s *Store) saveTrashBatch(batch *TrashBatch) error {
+	if err := os.MkdirAll(s.trashFolder, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating trash folder: %v", err)
+	}
+	file, err := os.Create(s.trashPath(batch.ID))
+	if err != nil {
+		return fmt.Errorf("error creating trash file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(batch); err != nil {
+		return fmt.Errorf("error encoding trash batch: %v", err)
+	}
+	return nil
+}
+
+/*
+keepTrashEntries drops the entries of the host files that weren't replaced from a trash batch,
+after a deletion failed halfway, so restoring it doesn't store their pages twice.
+The batch is removed when no entry is left. Errors are only logged, the deletion already failed.
+*/
+func (s *Store) keepTrashEntries(batch *TrashBatch, files map[string]bool) {
+	var entries []TrashEntry
+	for _, entry := range batch.Entries {
+		if files[entry.File] {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		if err := os.Remove(s.trashPath(batch.ID)); err != nil {
+			log.Printf("Error removing trash batch %s: %v", batch.ID, err)
+		}
+		return
+	}
+	batch.Entries = entries
+	batch.Pages = len(entries)
+	if err := s.saveTrashBatch(batch); err != nil {
+		log.Printf("Error updating trash batch %s: %v", batch.ID, err)
+	}
+}
+
+// readTrashBatch loads a trash batch with all of its entries.
+func (s *Store) readTrashBatch(id string) (*TrashBatch, error) {
+	if !trashIDPattern.MatchString(id) {
+		return nil, ErrTrashNotFound
+	}
+	file, err := os.Open(s.trashPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrTrashNotFound
+		}
+		return nil, fmt.Errorf("error opening trash file: %v", err)
+	}
+	defer file.Close()
+
+	var batch TrashBatch
+	if err := json.NewDecoder(file).Decode(&batch); err != nil {
+		return nil, fmt.Errorf("error decoding trash batch: %v", err)
+	}
+	return &batch, nil
+}
+
+/*
+ListTrash returns every trash batch that hasn't expired yet, newest first.
+The page entries are left out, only the page count is reported.
+Expired batches are purged on the way.
+*/
+func (s *Store) ListTrash() ([]TrashBatch, error) {
+	if _, err := s.PurgeExpiredTrash(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(s.trashFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TrashBatch{}, nil
+		}
+		return nil, fmt.Errorf("error reading trash folder: %v", err)
+	}
+
+	batches := []TrashBatch{}
+	for _, entry := range entries {
+		batch, err := s.readTrashBatch(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			log.Printf("Skipping trash file %s: %v", entry.Name(), err)
+			continue
+		}
+		batch.Entries = nil
+		batches = append(batches, *batch)
+	}
+
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].DeletedAt.After(batches[j].DeletedAt)
+	})
+	return batches, nil
+}
+
+/*
+RestoreTrash puts the pages of a trash batch back into their host files and removes the batch.
+Restored pages are appended after the pages that are currently stored.
+Returns the number of restored pages.
+*/
+func (s *Store) RestoreTrash(id string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	batch, err := s.readTrashBatch(id)
+	if err != nil {
+		return 0, err
+	}
+	if time.Now().After(batch.ExpiresAt) {
+		return 0, ErrTrashNotFound
+	}
+
+	// group the deleted pages by the host file they came from
+	byFile := make(map[string][]models.PageData)
+	for _, entry := range batch.Entries {
+		byFile[entry.File] = append(byFile[entry.File], entry.Page)
+	}
+
+	added := make(map[int]int64)
+	for fileName, restored := range byFile {
+		pages, err := s.readHostFile(fileName)
+		if err != nil {
+			return 0, err
+		}
+		if err := s.writeHostFile(fileName, append(pages, restored...)); err != nil {
+			return 0, err
+		}
+		for _, page := range restored {
+			added[page.UserID] += PageSize(page)
+		}
+	}
+	s.recordStoredBytes(added)
+
+	if err := os.Remove(s.trashPath(batch.ID)); err != nil {
+		return 0, fmt.Errorf("error removing trash file: %v", err)
+	}
+	return len(batch.Entries), nil
+}
+
+// PurgeExpiredTrash permanently removes the trash batches whose grace period is over.
+func (s *Store) PurgeExpiredTrash() (int, error) {
+	entries, err := os.ReadDir(s.trashFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error reading trash folder: %v", err)
+	}
+
+	purged := 0
+	now := time.Now()
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		batch, err := s.readTrashBatch(id)
+		if err != nil || now.Before(batch.ExpiresAt) {
+			continue
+		}
+		if err := os.Remove(s.trashPath(id)); err != nil {
+			return purged, fmt.Errorf("error removing trash file: %v", err)
+		}
+		log.Printf("Purged trash batch %s (%d pages)", id, batch.Pages)
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *Store) trashPath(id string) string {
+	return filepath.Join(s.trashFolder, id+".json")
+}
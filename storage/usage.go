@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"GoGrab/database"
+	"GoGrab/models"
+	"encoding/json"
+	"log"
+)
+
+// PageSize returns about how many bytes a page version takes up in its host file.
+func PageSize(page models.PageData) int64 {
+	encoded, err := json.Marshal(page)
+	if err != nil {
+		return int64(len(page.Content))
+	}
+	return int64(len(encoded))
+}
+
+/*
+recordStoredBytes adds the changes of the stored bytes, by user ID, to the counters in the database
+that the quotas are checked against. The host files are written already, so a failure is only
+logged; the janitor's recount corrects the counters.
+*/
+func (s *Store) recordStoredBytes(changes map[int]int64) {
+	if err := s.addStoredBytes(changes); err != nil {
+		log.Printf("Error updating the stored bytes: %v", err)
+	}
+}
+
+/*
+RecountStoredBytes counts how many bytes the stored page versions of each user take up and replaces
+the counters in the database with it, which fills them for pages stored before they existed.
+Pages in the trash don't count, they are gone once the grace period is over.
+The host files can't change while they are counted.
+*/
+func (s *Store) RecountStoredBytes() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.ListHostFiles()
+	if err != nil {
+		return err
+	}
+	stored := make(map[int]int64)
+	for _, fileName := range files {
+		pages, err := s.readHostFile(fileName)
+		if err != nil {
+			return err
+		}
+		for _, page := range pages {
+			stored[page.UserID] += PageSize(page)
+		}
+	}
+	return database.ReplaceStoredBytes(stored)
+}
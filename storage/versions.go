@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"GoGrab/models"
+	"GoGrab/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrPageNotFound is returned when no version of a page (or of the requested version) is stored.
+var ErrPageNotFound = errors.New("page not found")
+
+// PageSummary describes a page and its stored versions without their content.
+type PageSummary struct {
+	PageID         string    `json:"page_id"`
+	URL            string    `json:"url"`
+	Title          string    `json:"title"`
+	File           string    `json:"file"`
+	Versions       int       `json:"versions"`
+	LatestVersion  int       `json:"latest_version"`
+	FirstCrawledAt time.Time `json:"first_crawled_at"`
+	LastCrawledAt  time.Time `json:"last_crawled_at"`
+}
+
+// PageIDFor returns the stable page ID of a URL, derived from its normalized form.
+func PageIDFor(pageURL string) string {
+	sum := sha256.Sum256([]byte(utils.NormalizeURL(pageURL)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ContentHash returns the SHA-256 hash of a page's content.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+fillVersionInfo sets the page ID, version and content hash of pages saved before versions were
+recorded. Such pages are numbered in file order, after any version already stored for the same page.
+*/
+func fillVersionInfo(pages []models.PageData) {
+	latest := make(map[string]int)
+	for i := range pages {
+		if pages[i].PageID == "" {
+			pages[i].PageID = PageIDFor(pages[i].URL)
+		}
+		if pages[i].ContentHash == "" {
+			pages[i].ContentHash = ContentHash(pages[i].Content)
+		}
+		if pages[i].Version == 0 {
+			pages[i].Version = latest[pages[i].PageID] + 1
+		}
+		latest[pages[i].PageID] = max(latest[pages[i].PageID], pages[i].Version)
+	}
+}
+
+/*
+nextVersion returns the version number the next fetch of a page gets. Versions are numbered per
+workspace, so teams crawling the same URL each get their own history: per organization, and in the
+personal workspaces per user.
+*/
+func nextVersion(pages []models.PageData, next models.PageData) int {
+	version := 0
+	for _, page := range pages {
+		if page.PageID == next.PageID && sameWorkspace(page, next) {
+			version = max(version, page.Version)
+		}
+	}
+	return version + 1
+}
+
+// sameWorkspace reports whether two pages belong to the same workspace.
+func sameWorkspace(a, b models.PageData) bool {
+	if a.OrganizationID != b.OrganizationID {
+		return false
+	}
+	return a.OrganizationID != 0 || a.UserID == b.UserID
+}
+
+/*
+QueryPages returns a summary of every page that has at least one version matching the filter.
+Only matching versions are counted. Pages are sorted by URL.
+*/
+func (s *Store) QueryPages(filter PageFilter) ([]PageSummary, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.ListHostFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[string]*PageSummary)
+	for _, fileName := range files {
+		pages, err := s.readHostFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			if !filter.Matches(page) {
+				continue
+			}
+			summary, ok := summaries[page.PageID]
+			if !ok {
+				summary = &PageSummary{PageID: page.PageID, URL: page.URL, File: fileName, FirstCrawledAt: page.CrawledAt}
+				summaries[page.PageID] = summary
+			}
+			summary.Versions++
+			if page.Version > summary.LatestVersion {
+				summary.LatestVersion = page.Version
+				summary.Title = page.Title
+				summary.LastCrawledAt = page.CrawledAt
+			}
+		}
+	}
+
+	result := make([]PageSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].URL < result[j].URL
+	})
+	return result, nil
+}
+
+/*
+EachPage calls fn for every stored page version matching the filter, host file by host file.
+The file lock is only held while a host file is read, so a slow fn (e.g. streaming to a client)
+doesn't block the crawler. Iteration stops at the first error returned by fn.
+*/
+func (s *Store) EachPage(filter PageFilter, fn func(page models.PageData) error) error {
+	s.lock.Lock()
+	files, err := s.ListHostFiles()
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range files {
+		s.lock.Lock()
+		pages, err := s.readHostFile(fileName)
+		s.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, page := range pages {
+			if !filter.Matches(page) {
+				continue
+			}
+			if err := fn(page); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetPageVersions returns every stored version of a page, oldest first.
+func (s *Store) GetPageVersions(pageID string) ([]models.PageData, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.ListHostFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []models.PageData
+	for _, fileName := range files {
+		pages, err := s.readHostFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			if page.PageID == pageID {
+				versions = append(versions, page)
+			}
+		}
+		// all versions of a page live in the same host file
+		if len(versions) > 0 {
+			break
+		}
+	}
+	if len(versions) == 0 {
+		return nil, ErrPageNotFound
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+// GetPageVersion returns a single version of a page.
+func (s *Store) GetPageVersion(pageID string, version int) (*models.PageData, error) {
+	versions, err := s.GetPageVersions(pageID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].Version == version {
+			return &versions[i], nil
+		}
+	}
+	return nil, ErrPageNotFound
+}
@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"strings"
+)
+
+// DiffOp is one run of equal, inserted or deleted tokens in a diff.
+type DiffOp struct {
+	Op   string `json:"op"` // "equal", "insert" or "delete"
+	Text string `json:"text"`
+}
+
+/*
+DiffLines compares two texts line by line.
+The returned ops cover both texts completely, joining consecutive lines of the same kind.
+*/
+func DiffLines(oldText, newText string) []DiffOp {
+	return diffTokens(splitLines(oldText), splitLines(newText), "\n")
+}
+
+/*
+DiffWords compares two texts word by word, whitespace only separates words
+and is normalized to a single space in the result.
+*/
+func DiffWords(oldText, newText string) []DiffOp {
+	return diffTokens(strings.Fields(oldText), strings.Fields(newText), " ")
+}
+
+/*
+FormatDiff renders diff ops as text. Line diffs use the unified "+"/"-" prefixes,
+word diffs mark changes inline as [-removed-] and {+added+}.
+*/
+func FormatDiff(ops []DiffOp, words bool) string {
+	var result strings.Builder
+	for _, op := range ops {
+		if words {
+			if result.Len() > 0 {
+				result.WriteString(" ")
+			}
+			switch op.Op {
+			case "insert":
+				result.WriteString("{+" + op.Text + "+}")
+			case "delete":
+				result.WriteString("[-" + op.Text + "-]")
+			default:
+				result.WriteString(op.Text)
+			}
+			continue
+		}
+
+		prefix := "  "
+		switch op.Op {
+		case "insert":
+			prefix = "+ "
+		case "delete":
+			prefix = "- "
+		}
+		for _, line := range strings.Split(op.Text, "\n") {
+			result.WriteString(prefix + line + "\n")
+		}
+	}
+	return result.String()
+}
+
+// CountDiffChanges returns how many lines (or words) the ops add and remove, rather than how many runs.
+func CountDiffChanges(ops []DiffOp, words bool) (added, removed int) {
+	for _, op := range ops {
+		count := strings.Count(op.Text, "\n") + 1
+		if words {
+			count = len(strings.Fields(op.Text))
+		}
+		switch op.Op {
+		case "insert":
+			added += count
+		case "delete":
+			removed += count
+		}
+	}
+	return added, removed
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// maxDiffEdits bounds the work of the diff, texts differing in more tokens are reported
+// as a single deletion followed by a single insertion of the differing middle part.
+const maxDiffEdits = 1000
+
+// diffEdit is a single token tagged with its kind ("equal", "insert" or "delete").
+type diffEdit struct {
+	op    string
+	token string
+}
+
+/*
+diffTokens computes the shortest edit script between two token lists and groups it into ops,
+joining the tokens of each run with sep. The common prefix and suffix are stripped first,
+so the Myers search only runs on the part that actually changed.
+*/
+func diffTokens(a, b []string, sep string) []DiffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []diffEdit
+	for _, token := range a[:prefix] {
+		edits = append(edits, diffEdit{"equal", token})
+	}
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	middle, ok := myersDiff(middleA, middleB)
+	if !ok {
+		middle = nil
+		for _, token := range middleA {
+			middle = append(middle, diffEdit{"delete", token})
+		}
+		for _, token := range middleB {
+			middle = append(middle, diffEdit{"insert", token})
+		}
+	}
+	edits = append(edits, middle...)
+	for _, token := range a[len(a)-suffix:] {
+		edits = append(edits, diffEdit{"equal", token})
+	}
+
+	// merge consecutive tokens of the same kind into one op
+	ops := []DiffOp{}
+	var tokens []string
+	current := ""
+	for _, e := range edits {
+		if e.op != current && len(tokens) > 0 {
+			ops = append(ops, DiffOp{Op: current, Text: strings.Join(tokens, sep)})
+			tokens = nil
+		}
+		current = e.op
+		tokens = append(tokens, e.token)
+	}
+	if len(tokens) > 0 {
+		ops = append(ops, DiffOp{Op: current, Text: strings.Join(tokens, sep)})
+	}
+	return ops
+}
+
+/*
+myersDiff returns the shortest edit script between a and b using Myers' algorithm.
+It gives up and returns false once more than maxDiffEdits edits would be needed.
+*/
+func myersDiff(a, b []string) ([]diffEdit, bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	// forward pass, recording the furthest reaching x for every diagonal k after d edits
+	found := false
+search:
+	for d := 0; d <= limit; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break search
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	// backtrack from the end to recover the edit script, which comes out reversed
+	var reversed []diffEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffEdit{"equal", a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				reversed = append(reversed, diffEdit{"insert", b[y]})
+			} else {
+				x--
+				reversed = append(reversed, diffEdit{"delete", a[x]})
+			}
+		}
+	}
+
+	edits := make([]diffEdit, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		edits = append(edits, reversed[i])
+	}
+	return edits, true
+}
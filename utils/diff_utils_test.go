@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns count lines reading prefix followed by their number.
+func numberedLines(prefix string, count int) string {
+	lines := make([]string, count)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name             string
+		oldText, newText string
+		want             []DiffOp
+		added, removed   int
+	}{
+		{"both empty", "", "", []DiffOp{}, 0, 0},
+		{"from empty", "", "a\nb", []DiffOp{{"insert", "a\nb"}}, 2, 0},
+		{"to empty", "a\nb\nc", "", []DiffOp{{"delete", "a\nb\nc"}}, 0, 3},
+		{"unchanged", "a\nb", "a\nb", []DiffOp{{"equal", "a\nb"}}, 0, 0},
+		{"changed line", "a\nb\nc", "a\nB\nc", []DiffOp{{"equal", "a"}, {"delete", "b"}, {"insert", "B"}, {"equal", "c"}}, 1, 1},
+		{"inserted lines", "a\nd", "a\nb\nc\nd", []DiffOp{{"equal", "a"}, {"insert", "b\nc"}, {"equal", "d"}}, 2, 0},
+		{"removed and moved", "a\nb\nc\nd", "b\nd\nc", []DiffOp{{"delete", "a"}, {"equal", "b"}, {"delete", "c"}, {"equal", "d"}, {"insert", "c"}}, 1, 2},
+	}
+	for _, test := range tests {
+		ops := DiffLines(test.oldText, test.newText)
+		if !reflect.DeepEqual(ops, test.want) {
+			t.Errorf("%s: got ops %v, want %v", test.name, ops, test.want)
+		}
+		if added, removed := CountDiffChanges(ops, false); added != test.added || removed != test.removed {
+			t.Errorf("%s: got %d added and %d removed, want %d and %d", test.name, added, removed, test.added, test.removed)
+		}
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	ops := DiffWords("the quick  brown fox", "the slow brown\tdog")
+	want := []DiffOp{{"equal", "the"}, {"delete", "quick"}, {"insert", "slow"}, {"equal", "brown"}, {"delete", "fox"}, {"insert", "dog"}}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("got ops %v, want %v", ops, want)
+	}
+	if added, removed := CountDiffChanges(ops, true); added != 2 || removed != 2 {
+		t.Errorf("got %d added and %d removed words, want 2 and 2", added, removed)
+	}
+	if got := FormatDiff(ops, true); got != "the [-quick-] {+slow+} brown [-fox-] {+dog+}" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDiffLinesFallback(t *testing.T) {
+	// the middle parts share no line, so the edit script needs more than maxDiffEdits edits
+	size := maxDiffEdits/2 + 1
+	oldText := "header\n" + numberedLines("old ", size) + "\nfooter"
+	newText := "header\n" + numberedLines("new ", size) + "\nfooter"
+
+	ops := DiffLines(oldText, newText)
+	want := []DiffOp{
+		{"equal", "header"},
+		{"delete", numberedLines("old ", size)},
+		{"insert", numberedLines("new ", size)},
+		{"equal", "footer"},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("got %d ops, want the differing middle as one deletion and one insertion", len(ops))
+	}
+	if added, removed := CountDiffChanges(ops, false); added != size || removed != size {
+		t.Errorf("got %d added and %d removed, want %d each", added, removed, size)
+	}
+
+	// just below the limit the shortest edit script is still searched
+	small := maxDiffEdits/2 - 1
+	ops = DiffLines(numberedLines("old ", small)+"\nshared", "shared\n"+numberedLines("new ", small))
+	if len(ops) != 3 || ops[1] != (DiffOp{"equal", "shared"}) {
+		t.Errorf("got ops %v, want the shared line kept between the deletion and the insertion", ops)
+	}
+}
+
+func TestFormatDiffLines(t *testing.T) {
+	got := FormatDiff([]DiffOp{{"equal", "a"}, {"delete", "b\nc"}, {"insert", "d"}}, false)
+	if want := "  a\n- b\n- c\n+ d\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
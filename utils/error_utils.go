@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ErrorResponse is the body of every error response of the API.
+type ErrorResponse struct {
+	Code      string      `json:"code" example:"not_found"`
+	Message   string      `json:"message" example:"Page not found"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// WriteError answers with an ErrorResponse, the JSON counterpart of http.Error.
+func WriteError(w http.ResponseWriter, message string, status int) {
+	WriteErrorDetails(w, message, status, nil)
+}
+
+/*
+WriteErrorDetails answers with an ErrorResponse carrying details for clients, like the allowed
+methods of a 405. The code is derived from the status, e.g. "not_found" or "too_many_requests",
+and the request ID is taken from the X-Request-ID response header set by middleware.RequestID.
+*/
+func WriteErrorDetails(w http.ResponseWriter, message string, status int, details interface{}) {
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      ErrorCode(status),
+		Message:   message,
+		Details:   details,
+		RequestID: header.Get("X-Request-ID"),
+	})
+}
+
+// ErrorCode returns the machine readable code of an HTTP status, its status text in snake case.
+func ErrorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
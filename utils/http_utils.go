@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For ClientIP believes, set once on startup.
+var trustedProxies []netip.Prefix
+
+// SetTrustedProxies sets the reverse proxies in front of the server, it must be called before serving.
+func SetTrustedProxies(proxies []netip.Prefix) {
+	trustedProxies = proxies
+}
+
+/*
+ClientIP returns the IP address of the client that sent the request, without the port. Behind a
+trusted proxy it is taken from X-Forwarded-For: the hops are walked from the right, the ones the
+trusted proxies added, and the first address that isn't a trusted proxy is the client. Everything
+left of it was sent by the client itself and could be made up.
+*/
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// garbage in the header, the last proxy is as far as we can tell
+			break
+		}
+		host = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, proxy := range trustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
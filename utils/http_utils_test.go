@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::1/128")})
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct client", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"untrusted peer can't forward", "203.0.113.7:51234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hops left of the client", "10.0.0.2:443", []string{"192.0.2.66, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:443", []string{"198.51.100.1, 10.0.0.5", "10.0.0.3"}, "198.51.100.1"},
+		{"only trusted proxies", "10.0.0.2:443", []string{"10.0.0.5"}, "10.0.0.5"},
+		{"garbage hop", "10.0.0.2:443", []string{"198.51.100.1, unknown"}, "10.0.0.2"},
+		{"no header", "10.0.0.2:443", nil, "10.0.0.2"},
+		{"IPv6 proxy", "[2001:db8::1]:443", []string{"2001:db8::beef"}, "2001:db8::beef"},
+		{"IPv4 mapped proxy", "[::ffff:10.0.0.2]:443", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, value := range test.forwardedFor {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := ClientIP(r); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}